@@ -0,0 +1,30 @@
+// Command hubbroker is a stand-in for Redis that implements just the commands the
+// realtime hub uses, in memory (see pkg/hubbroker). It lets you run several
+// backend instances locally without installing Redis:
+//
+//	go run ./cmd/hubbroker -addr localhost:6379
+//	HUB_BACKEND=redis PORT=8080 go run .
+//	HUB_BACKEND=redis PORT=8081 go run .
+//
+// It is not meant for production: nothing is persisted and AUTH accepts anything.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"reda-social-network/pkg/hubbroker"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address to listen on")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("hubbroker listening on %s", *addr)
+	log.Fatal(hubbroker.New().Serve(listener))
+}
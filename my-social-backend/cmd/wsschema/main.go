@@ -0,0 +1,313 @@
+// Command wsschema generates the WebSocket protocol's JSON Schema and Markdown
+// reference from models.WSEvents. Run it through go generate in models:
+//
+//	go generate ./models
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"reda-social-network/models"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// schemaBuilder turns Go types into JSON Schema, collecting named structs in defs.
+type schemaBuilder struct {
+	defs map[string]interface{}
+}
+
+// field is one JSON field of a struct.
+type field struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+// jsonFields lists the fields encoding/json writes for struct type t. A field
+// without omitempty is always present, so it is required.
+func jsonFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{name: name, typ: f.Type, required: !strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		inner := b.schema(t.Elem())
+		return map[string]interface{}{"anyOf": []interface{}{inner, map[string]interface{}{"type": "null"}}}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, done := b.defs[name]; !done {
+			b.defs[name] = nil // placeholder, in case the type refers to itself
+			b.defs[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	required := []string{}
+	for _, f := range jsonFields(t) {
+		props[f.name] = b.schema(f.typ)
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// messageSchema describes the envelope of one message type.
+func (b *schemaBuilder) messageSchema(spec models.WSEventSpec) map[string]interface{} {
+	props := map[string]interface{}{
+		"type":    map[string]interface{}{"const": spec.Type},
+		"id":      map[string]interface{}{"type": "string", "maxLength": 64},
+		"version": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": models.WSProtocolVersion},
+		"data":    b.schema(reflect.TypeOf(spec.Data)),
+	}
+	required := []string{"type"}
+	if spec.Direction == models.WSFromServer {
+		props["seq"] = map[string]interface{}{"type": "integer", "minimum": 1}
+		required = append(required, "version", "data")
+	}
+	return map[string]interface{}{
+		"description":          spec.Description,
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func buildSchema() map[string]interface{} {
+	b := &schemaBuilder{defs: make(map[string]interface{})}
+	client, server := []interface{}{}, []interface{}{}
+	for _, spec := range models.WSEvents {
+		if spec.Direction == models.WSFromClient {
+			client = append(client, b.messageSchema(spec))
+		} else {
+			server = append(server, b.messageSchema(spec))
+		}
+	}
+	b.defs["ClientMessage"] = map[string]interface{}{"oneOf": client}
+	b.defs["ServerMessage"] = map[string]interface{}{"oneOf": server}
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       fmt.Sprintf("WebSocket protocol, version %d", models.WSProtocolVersion),
+		"description": "A message sent over GET /ws, by the client (ClientMessage) or the server (ServerMessage).",
+		"oneOf": []interface{}{
+			map[string]interface{}{"$ref": "#/$defs/ClientMessage"},
+			map[string]interface{}{"$ref": "#/$defs/ServerMessage"},
+		},
+		"$defs": b.defs,
+	}
+}
+
+// typeName is how t is written in the Markdown reference.
+func typeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string (RFC 3339 time)"
+	case t == rawMessageType:
+		return "any"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem()) + " or null"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array of " + typeName(t.Elem())
+	case reflect.Map:
+		return "object of " + typeName(t.Elem())
+	case reflect.Struct:
+		return "[" + t.Name() + "](#" + strings.ToLower(t.Name()) + ")"
+	}
+	return "any"
+}
+
+// collectStructs adds the named structs reachable from t to seen.
+func collectStructs(t reflect.Type, seen map[string]reflect.Type) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		collectStructs(t.Elem(), seen)
+	case reflect.Struct:
+		if t == timeType || seen[t.Name()] != nil {
+			return
+		}
+		seen[t.Name()] = t
+		for _, f := range jsonFields(t) {
+			collectStructs(f.typ, seen)
+		}
+	}
+}
+
+func writeFields(sb *strings.Builder, t reflect.Type) {
+	fields := jsonFields(t)
+	if len(fields) == 0 {
+		sb.WriteString("No fields.\n\n")
+		return
+	}
+	sb.WriteString("| Field | Type | Required |\n|---|---|---|\n")
+	for _, f := range fields {
+		required := "no"
+		if f.required {
+			required = "yes"
+		}
+		fmt.Fprintf(sb, "| `%s` | %s | %s |\n", f.name, typeName(f.typ), required)
+	}
+	sb.WriteString("\n")
+}
+
+func buildMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString("<!-- Code generated by cmd/wsschema from models/ws_models.go. DO NOT EDIT. -->\n\n")
+	fmt.Fprintf(&sb, "# WebSocket protocol (version %d)\n\n", models.WSProtocolVersion)
+	sb.WriteString("Connect to `GET /ws` with the session cookie (or `?token=`). Every message, in both\n")
+	sb.WriteString("directions, is a JSON envelope:\n\n")
+	sb.WriteString("| Field | Type | Description |\n|---|---|---|\n")
+	sb.WriteString("| `type` | string | The message type, listed below. |\n")
+	sb.WriteString("| `id` | string | Optional request ID (at most 64 characters) chosen by the client; replies and errors for the request carry it. |\n")
+	fmt.Fprintf(&sb, "| `version` | integer | Protocol version. Requests without one are read as version %d; the server always sets it. |\n", models.WSProtocolVersion)
+	sb.WriteString("| `seq` | integer | Server messages only: the event's position in the user's event log, for `resume` and `ack`. |\n")
+	sb.WriteString("| `data` | object | The message's data, described below. |\n\n")
+
+	sb.WriteString("## Errors\n\n")
+	sb.WriteString("A request that fails is answered with an `error` message whose `id` is the request's and\n")
+	sb.WriteString("whose `data.code` is one of:\n\n")
+	sb.WriteString("| Code | Meaning |\n|---|---|\n")
+	for _, e := range [][2]string{
+		{models.WSErrBadRequest, "The envelope or its data is malformed or invalid."},
+		{models.WSErrUnknownType, "There is no request of that type."},
+		{models.WSErrUnsupportedVersion, "The request's version is newer than the server's."},
+		{models.WSErrForbidden, "The request is not allowed, e.g. messaging a blocked user."},
+		{models.WSErrNotFound, "The request's target, e.g. a message's receiver, does not exist."},
+		{models.WSErrInternal, "The server failed; retrying may help."},
+		{models.WSErrRateLimited, "Too many requests of that type; `data.retry_after_ms` says when to retry. A client that keeps going is disconnected."},
+	} {
+		fmt.Fprintf(&sb, "| `%s` | %s |\n", e[0], e[1])
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString("## Server-Sent Events\n\n")
+	sb.WriteString("Clients that can't open a WebSocket can read the server messages from `GET /events/stream`\n")
+	sb.WriteString("instead. Each message is an event named after its `type`, whose data is the envelope above;\n")
+	sb.WriteString("messages with a `seq` use it as the event ID. A reconnecting `EventSource` sends\n")
+	sb.WriteString("`Last-Event-ID` and receives the events it missed, as with `resume` (a first connection can\n")
+	sb.WriteString("pass `?last_event_id=`). The stream is one-way: send messages through the REST API.\n\n")
+
+	structs := make(map[string]reflect.Type)
+	for _, section := range []struct{ direction, title string }{
+		{models.WSFromClient, "Client messages"},
+		{models.WSFromServer, "Server messages"},
+	} {
+		fmt.Fprintf(&sb, "## %s\n\n", section.title)
+		for _, spec := range models.WSEvents {
+			if spec.Direction != section.direction {
+				continue
+			}
+			t := reflect.TypeOf(spec.Data)
+			fmt.Fprintf(&sb, "### `%s`\n\n%s\n\n", spec.Type, spec.Description)
+			if t.Kind() != reflect.Struct {
+				fmt.Fprintf(&sb, "Data: %s.\n\n", typeName(t))
+				continue
+			}
+			fmt.Fprintf(&sb, "Data: `%s`\n\n", t.Name())
+			writeFields(&sb, t)
+			for _, f := range jsonFields(t) {
+				collectStructs(f.typ, structs)
+			}
+		}
+	}
+
+	if len(structs) > 0 {
+		sb.WriteString("## Types\n\n")
+		names := make([]string, 0, len(structs))
+		for name := range structs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&sb, "### %s\n\n", name)
+			writeFields(&sb, structs[name])
+		}
+	}
+	return sb.String()
+}
+
+func main() {
+	out := flag.String("out", "docs", "directory to write ws-protocol.schema.json and ws-protocol.md to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Fatal(err)
+	}
+	schema, err := json.MarshalIndent(buildSchema(), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*out, "ws-protocol.schema.json"), append(schema, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*out, "ws-protocol.md"), []byte(buildMarkdown()), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
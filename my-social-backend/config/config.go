@@ -0,0 +1,178 @@
+// Package config holds server settings read from environment variables.
+// Unset or invalid variables fall back to the defaults below.
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MediaConfig controls how uploaded images are validated and resized.
+type MediaConfig struct {
+	MaxUploadBytes int64 // MEDIA_MAX_UPLOAD_BYTES: largest accepted upload
+	MaxPixels      int   // MEDIA_MAX_PIXELS: largest accepted width*height
+	MaxGIFFrames   int   // MEDIA_MAX_GIF_FRAMES: most frames accepted in an animated GIF
+	MaxGIFPixels   int   // MEDIA_MAX_GIF_PIXELS: largest accepted frames*width*height of an animated GIF
+	ThumbnailSize  int   // MEDIA_THUMBNAIL_SIZE: longest side of the thumbnail variant
+	MediumSize     int   // MEDIA_MEDIUM_SIZE: longest side of the medium variant
+	UserQuotaBytes int64 // MEDIA_USER_QUOTA_BYTES: total storage each user's uploads may use
+
+	// MEDIA_ORPHAN_TTL_HOURS: how long an upload may stay unused before it is deleted
+	OrphanTTL time.Duration
+}
+
+// S3Config points the s3 storage backend at a bucket of an S3-compatible service.
+type S3Config struct {
+	Endpoint  string // MEDIA_S3_ENDPOINT, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Bucket    string // MEDIA_S3_BUCKET
+	Region    string // MEDIA_S3_REGION
+	AccessKey string // MEDIA_S3_ACCESS_KEY
+	SecretKey string // MEDIA_S3_SECRET_KEY
+	PathStyle bool   // MEDIA_S3_PATH_STYLE: address objects as endpoint/bucket/key (needed for MinIO)
+	PublicURL string // MEDIA_S3_PUBLIC_URL: optional base URL clients fetch avatars from directly; post media always goes through the backend
+}
+
+// StorageConfig selects and configures where uploaded media is stored.
+type StorageConfig struct {
+	Backend   string // MEDIA_STORE: "local" or "s3"
+	LocalDir  string // MEDIA_LOCAL_DIR: root directory of the local backend
+	URLPrefix string // URL path the server serves media under
+	S3        S3Config
+}
+
+// HubConfig selects how realtime messages and presence are shared. The memory hub
+// only knows about its own process; to run several backend instances behind a
+// load balancer they all use the same broker.
+type HubConfig struct {
+	Backend       string // HUB_BACKEND: "memory" or "redis"
+	RedisAddr     string // HUB_REDIS_ADDR: host:port of a Redis-compatible broker
+	RedisPassword string // HUB_REDIS_PASSWORD
+	InstanceID    string // HUB_INSTANCE_ID: unique name of this instance; defaults to host name and process ID
+}
+
+// RateLimitConfig limits how fast each user may send, over the WebSocket and REST
+// alike. Each action has a bucket of Burst tokens refilled at PerMinute.
+type RateLimitConfig struct {
+	MessagesPerMinute int // RATE_LIMIT_MESSAGES_PER_MINUTE: direct messages
+	MessageBurst      int // RATE_LIMIT_MESSAGE_BURST
+	GroupPerMinute    int // RATE_LIMIT_GROUP_MESSAGES_PER_MINUTE: group chat messages
+	GroupBurst        int // RATE_LIMIT_GROUP_MESSAGE_BURST
+	TypingPerMinute   int // RATE_LIMIT_TYPING_PER_MINUTE: typing indicators
+	TypingBurst       int // RATE_LIMIT_TYPING_BURST
+
+	// RATE_LIMIT_WS_STRIKES: limited requests within a minute after which a
+	// WebSocket is disconnected
+	WSStrikes int
+	// WS_MAX_FRAME_BYTES: largest WebSocket message accepted from a client
+	WSMaxFrameBytes int
+}
+
+// Config is the complete server configuration.
+type Config struct {
+	Media     MediaConfig
+	Storage   StorageConfig
+	Hub       HubConfig
+	RateLimit RateLimitConfig
+
+	// DEBUG_ADDR: internal listener serving /debug/vars (runtime and WebSocket
+	// queue metrics); "off" disables it. Keep it off the public network.
+	DebugAddr string
+}
+
+// App is the configuration loaded at startup.
+var App = Load()
+
+// Load reads the configuration from the environment.
+func Load() Config {
+	return Config{
+		Media: MediaConfig{
+			MaxUploadBytes: int64(envInt("MEDIA_MAX_UPLOAD_BYTES", 10<<20)),
+			MaxPixels:      envInt("MEDIA_MAX_PIXELS", 40_000_000),
+			MaxGIFFrames:   envInt("MEDIA_MAX_GIF_FRAMES", 300),
+			MaxGIFPixels:   envInt("MEDIA_MAX_GIF_PIXELS", 100_000_000),
+			ThumbnailSize:  envInt("MEDIA_THUMBNAIL_SIZE", 320),
+			MediumSize:     envInt("MEDIA_MEDIUM_SIZE", 1280),
+			UserQuotaBytes: int64(envInt("MEDIA_USER_QUOTA_BYTES", 200<<20)),
+			OrphanTTL:      time.Duration(envInt("MEDIA_ORPHAN_TTL_HOURS", 24)) * time.Hour,
+		},
+		Storage: StorageConfig{
+			Backend:   envString("MEDIA_STORE", "local"),
+			LocalDir:  envString("MEDIA_LOCAL_DIR", "./uploads"),
+			URLPrefix: "/uploads/",
+			S3: S3Config{
+				Endpoint:  os.Getenv("MEDIA_S3_ENDPOINT"),
+				Bucket:    os.Getenv("MEDIA_S3_BUCKET"),
+				Region:    envString("MEDIA_S3_REGION", "us-east-1"),
+				AccessKey: os.Getenv("MEDIA_S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("MEDIA_S3_SECRET_KEY"),
+				PathStyle: envBool("MEDIA_S3_PATH_STYLE", true),
+				PublicURL: os.Getenv("MEDIA_S3_PUBLIC_URL"),
+			},
+		},
+		Hub: HubConfig{
+			Backend:       envString("HUB_BACKEND", "memory"),
+			RedisAddr:     envString("HUB_REDIS_ADDR", "localhost:6379"),
+			RedisPassword: os.Getenv("HUB_REDIS_PASSWORD"),
+			InstanceID:    envString("HUB_INSTANCE_ID", defaultInstanceID()),
+		},
+		RateLimit: RateLimitConfig{
+			MessagesPerMinute: envInt("RATE_LIMIT_MESSAGES_PER_MINUTE", 30),
+			MessageBurst:      envInt("RATE_LIMIT_MESSAGE_BURST", 10),
+			GroupPerMinute:    envInt("RATE_LIMIT_GROUP_MESSAGES_PER_MINUTE", 30),
+			GroupBurst:        envInt("RATE_LIMIT_GROUP_MESSAGE_BURST", 10),
+			TypingPerMinute:   envInt("RATE_LIMIT_TYPING_PER_MINUTE", 60),
+			TypingBurst:       envInt("RATE_LIMIT_TYPING_BURST", 10),
+			WSStrikes:         envInt("RATE_LIMIT_WS_STRIKES", 20),
+			WSMaxFrameBytes:   envInt("WS_MAX_FRAME_BYTES", 64<<10),
+		},
+		DebugAddr: envString("DEBUG_ADDR", "127.0.0.1:6060"),
+	}
+}
+
+// defaultInstanceID names this process for the hub, unique as long as no two
+// instances share a host name and process ID.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// envString reads a string variable.
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envBool reads a boolean variable such as "true", "false", "1" or "0".
+func envBool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Config: ignoring invalid %s=%q, using %t", name, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+// envInt reads a positive integer variable.
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Config: ignoring invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
@@ -4,17 +4,27 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
 
 var DB *sql.DB
 
+// connParams makes writers wait for each other instead of failing with "database
+// is locked", and WAL keeps readers (such as a replay to a slow client) from
+// holding writers up.
+const connParams = "_busy_timeout=5000&_journal_mode=WAL"
+
 // InitDB initializes the database connection and creates tables if they don't exist.
 func InitDB(dataSourceName string) error {
 	var err error
+	sep := "?"
+	if strings.Contains(dataSourceName, "?") {
+		sep = "&"
+	}
 	// Open the SQLite database file
-	DB, err = sql.Open("sqlite3", dataSourceName)
+	DB, err = sql.Open("sqlite3", dataSourceName+sep+connParams)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -49,21 +59,13 @@ func InitDB(dataSourceName string) error {
         user_id INTEGER NOT NULL REFERENCES users(id),
         content TEXT NOT NULL,
         image_path TEXT,
-        privacy INTEGER DEFAULT 0, -- 0: public, 1: followers_only, 2: close_friends
+        privacy INTEGER DEFAULT 0, -- 0: public, 1: followers_only, 2: audience lists (close friends by default)
+        status TEXT NOT NULL DEFAULT 'published' CHECK(status IN ('draft', 'scheduled', 'published')),
+        publish_at DATETIME, -- when a scheduled post goes live
         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
         updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
     );
 
-    CREATE TABLE IF NOT EXISTS close_friends (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        user_id INTEGER NOT NULL,
-        close_friend_id INTEGER NOT NULL,
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-        FOREIGN KEY (close_friend_id) REFERENCES users(id) ON DELETE CASCADE,
-        UNIQUE(user_id, close_friend_id)
-    );
-
     CREATE TABLE IF NOT EXISTS comments (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         post_id INTEGER NOT NULL REFERENCES posts(id),
@@ -157,6 +159,7 @@ CREATE TABLE IF NOT EXISTS private_messages (
     receiver_id INTEGER NOT NULL REFERENCES users(id),
     content TEXT NOT NULL,
     is_read BOOLEAN DEFAULT FALSE,
+    read_at DATETIME, -- when the receiver read it; NULL for messages read before it was recorded
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -174,10 +177,18 @@ CREATE TABLE IF NOT EXISTS conversations (
     user2_id INTEGER NOT NULL REFERENCES users(id),
     last_message_id INTEGER REFERENCES private_messages(id),
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user1_unread_count INTEGER NOT NULL DEFAULT 0, -- messages from user2 that user1 hasn't read
+    user2_unread_count INTEGER NOT NULL DEFAULT 0,
+    user1_last_read_id INTEGER NOT NULL DEFAULT 0, -- newest message from user2 that user1 read
+    user2_last_read_id INTEGER NOT NULL DEFAULT 0,
     UNIQUE(user1_id, user2_id),
     CHECK(user1_id < user2_id) -- Ensure consistent ordering
 );
 
+CREATE INDEX IF NOT EXISTS idx_conversations_user1 ON conversations(user1_id, last_message_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_user2 ON conversations(user2_id, last_message_id);
+CREATE INDEX IF NOT EXISTS idx_private_messages_pair ON private_messages(sender_id, receiver_id, is_read);
+
 CREATE TABLE IF NOT EXISTS notifications (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL REFERENCES users(id),
@@ -190,6 +201,147 @@ CREATE TABLE IF NOT EXISTS notifications (
     is_read BOOLEAN DEFAULT FALSE,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE TABLE IF NOT EXISTS polls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),             -- set for polls on regular posts
+    group_post_id INTEGER REFERENCES group_posts(id), -- set for polls on group posts
+    creator_id INTEGER NOT NULL REFERENCES users(id),
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at DATETIME, -- optional automatic close time
+    closed_at DATETIME, -- set once the poll is closed
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((post_id IS NOT NULL) + (group_post_id IS NOT NULL) = 1)
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL REFERENCES polls(id),
+    text TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    UNIQUE(poll_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL REFERENCES polls(id),
+    option_id INTEGER NOT NULL REFERENCES poll_options(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(option_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS media_uploads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id), -- the uploader; only they can attach it
+    file_path TEXT NOT NULL UNIQUE,
+    mime_type TEXT NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    content_hash TEXT,   -- SHA-256 of the stored (re-encoded) file
+    thumbnail_path TEXT, -- generated variants; NULL for uploads that predate processing
+    medium_path TEXT,
+    kind TEXT NOT NULL DEFAULT 'post' CHECK(kind IN ('post', 'avatar')),
+    storage_bytes INTEGER NOT NULL DEFAULT 0, -- original plus variants; counted against the quota
+    ref_count INTEGER NOT NULL DEFAULT 0,     -- posts/group posts/profiles using this upload
+    unreferenced_since DATETIME,              -- when ref_count last dropped to 0; the sweeper deletes old ones
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS post_media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),             -- set for media on regular posts
+    group_post_id INTEGER REFERENCES group_posts(id), -- set for media on group posts
+    media_id INTEGER NOT NULL REFERENCES media_uploads(id),
+    position INTEGER NOT NULL, -- display order, starting at 0
+    alt_text TEXT NOT NULL DEFAULT '',
+    CHECK ((post_id IS NOT NULL) + (group_post_id IS NOT NULL) = 1)
+);
+
+CREATE TABLE IF NOT EXISTS user_blocks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    blocker_id INTEGER NOT NULL REFERENCES users(id),
+    blocked_id INTEGER NOT NULL REFERENCES users(id), -- blocks apply in both directions
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(blocker_id, blocked_id)
+);
+
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id), -- the user who muted; never visible to the target
+    target_type TEXT NOT NULL CHECK(target_type IN ('user', 'conversation', 'group_chat')),
+    target_id INTEGER NOT NULL, -- user ID for 'user' and 'conversation', group ID for 'group_chat'
+    muted_until DATETIME,       -- NULL mutes indefinitely
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, target_type, target_id)
+);
+
+CREATE TABLE IF NOT EXISTS follow_suggestions ( -- cached "people you may know", refreshed in the background
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    suggested_user_id INTEGER NOT NULL REFERENCES users(id),
+    score INTEGER NOT NULL,
+    mutual_follows INTEGER NOT NULL DEFAULT 0,
+    shared_groups INTEGER NOT NULL DEFAULT 0,
+    interactions INTEGER NOT NULL DEFAULT 0,
+    computed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, suggested_user_id)
+);
+
+CREATE TABLE IF NOT EXISTS suggestion_dismissals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    suggested_user_id INTEGER NOT NULL REFERENCES users(id), -- never suggested to user_id again
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, suggested_user_id)
+);
+
+CREATE TABLE IF NOT EXISTS profile_field_visibility ( -- missing rows mean 'everyone'
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    field TEXT NOT NULL CHECK(field IN ('email', 'date_of_birth', 'about_me')),
+    visibility TEXT NOT NULL CHECK(visibility IN ('everyone', 'followers', 'only_me')),
+    PRIMARY KEY (user_id, field)
+);
+
+CREATE TABLE IF NOT EXISTS audience_lists ( -- close friends is the built-in list with is_close_friends set
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    is_close_friends BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audience_lists_close_friends ON audience_lists(user_id) WHERE is_close_friends;
+
+CREATE TABLE IF NOT EXISTS audience_list_members (
+    list_id INTEGER NOT NULL REFERENCES audience_lists(id) ON DELETE CASCADE,
+    member_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list_id, member_id)
+);
+CREATE INDEX IF NOT EXISTS idx_audience_list_members_member_id ON audience_list_members(member_id);
+
+CREATE TABLE IF NOT EXISTS post_audiences ( -- lists a privacy 2 post is shared with
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    list_id INTEGER NOT NULL REFERENCES audience_lists(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, list_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_event_counters ( -- per-user realtime event sequence
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    last_seq INTEGER NOT NULL DEFAULT 0,
+    acked_seq INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_events ( -- realtime events kept for replay after reconnect
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    seq INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    data TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, seq)
+);
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
     
     `
 
@@ -221,7 +373,24 @@ func runMigrations() error {
 		`ALTER TABLE users ADD COLUMN date_of_birth TEXT`,
 		`ALTER TABLE posts ADD COLUMN image_path TEXT`,
 		`ALTER TABLE posts ADD COLUMN privacy INTEGER DEFAULT 0`,
+		`ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'published' CHECK(status IN ('draft', 'scheduled', 'published'))`,
+		`ALTER TABLE posts ADD COLUMN publish_at DATETIME`,
 		`ALTER TABLE likes ADD COLUMN is_like BOOLEAN DEFAULT TRUE`,
+		`ALTER TABLE media_uploads ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE media_uploads ADD COLUMN content_hash TEXT`,
+		`ALTER TABLE media_uploads ADD COLUMN thumbnail_path TEXT`,
+		`ALTER TABLE media_uploads ADD COLUMN medium_path TEXT`,
+		`ALTER TABLE media_uploads ADD COLUMN kind TEXT NOT NULL DEFAULT 'post' CHECK(kind IN ('post', 'avatar'))`,
+		`ALTER TABLE media_uploads ADD COLUMN storage_bytes INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE media_uploads ADD COLUMN ref_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE media_uploads ADD COLUMN unreferenced_since DATETIME`,
+		`ALTER TABLE conversations ADD COLUMN user1_unread_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE conversations ADD COLUMN user2_unread_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE conversations ADD COLUMN user1_last_read_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE conversations ADD COLUMN user2_last_read_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE private_messages ADD COLUMN read_at DATETIME`,
+		`ALTER TABLE users ADD COLUMN read_receipts BOOLEAN NOT NULL DEFAULT TRUE`,
+		`ALTER TABLE users ADD COLUMN suggestions_computed_at DATETIME`,
 	}
 
 	for _, migration := range migrations {
@@ -10,6 +10,8 @@ require github.com/rs/cors v1.11.1
 
 require github.com/gorilla/websocket v1.5.3
 
+require golang.org/x/image v0.25.0
+
 require (
 	github.com/golang-migrate/migrate/v4 v4.18.3
 	github.com/hashicorp/errwrap v1.1.0 // indirect
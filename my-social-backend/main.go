@@ -1,15 +1,18 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"reda-social-network/config"
 	"reda-social-network/database"
 	"reda-social-network/middleware"
 	"reda-social-network/pkg/db/sqlite"
+	"reda-social-network/pkg/storage"
 	"reda-social-network/util"
 	"reda-social-network/util/api"
 
@@ -47,6 +50,8 @@ func main() {
 	dbPath := "./social_network.db"
 	log.Printf("Using database at: %s", dbPath)
 
+	backfillConversations := flag.Bool("backfill-conversations", false,
+		"rebuild the conversations table (last messages, unread counts, read markers) from private_messages, then exit")
 	flag.Parse()
 
 	// Apply migrations before initializing the database
@@ -62,8 +67,40 @@ func main() {
 	}
 	// defer database.DB.Close() // DB is a global var, typically closed on app shutdown if needed explicitly.
 
+	if *backfillConversations {
+		n, err := api.NewMessagingService(database.DB).BackfillConversations()
+		if err != nil {
+			log.Fatalf("Failed to backfill conversations: %v", err)
+		}
+		log.Printf("Backfilled %d conversations", n)
+		return
+	}
+
+	// Set up the media store (local disk or S3-compatible, see config)
+	if err := storage.InitMediaStore(config.App.Storage); err != nil {
+		log.Fatalf("Failed to initialize media store: %v", err)
+	}
+	log.Printf("Using %s media store", config.App.Storage.Backend)
+
+	// Set up the realtime hub (this process only, or shared through a broker)
+	if err := api.InitHub(config.App.Hub); err != nil {
+		log.Fatalf("Failed to initialize realtime hub: %v", err)
+	}
+	log.Printf("Using %s realtime hub", config.App.Hub.Backend)
+
+	// Start in-process background jobs (post scheduler, ...)
+	api.StartBackgroundJobs()
+
+	// Metrics (memory, WebSocket queue depth and drop counters) are for operators
+	// only, so they get their own listener instead of a route on the public mux
+	if addr := config.App.DebugAddr; addr != "off" {
+		go serveDebug(addr)
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/ws", middleware.AuthMiddleware(http.HandlerFunc(api.WebSocketHandler)))
+	// Server-Sent Events, for clients that can't use /ws
+	mux.Handle("GET /events/stream", middleware.AuthMiddleware(http.HandlerFunc(api.EventStreamHandler)))
 	// Auth handlers
 	mux.HandleFunc("POST /register", api.RegisterHandler)
 	mux.HandleFunc("POST /login", api.LoginHandler)
@@ -76,8 +113,16 @@ func main() {
 	// Post handlers
 	mux.Handle("POST /posts", middleware.AuthMiddleware(http.HandlerFunc(api.CreatePostHandler)))
 	mux.Handle("GET /posts", middleware.AuthMiddleware(http.HandlerFunc(api.GetPostsHandler)))
+	mux.Handle("GET /posts/drafts", middleware.AuthMiddleware(http.HandlerFunc(api.ListDraftPostsHandler)))
+	mux.Handle("GET /posts/scheduled", middleware.AuthMiddleware(http.HandlerFunc(api.ListScheduledPostsHandler)))
+	mux.Handle("POST /posts/{postID}/publish", middleware.AuthMiddleware(http.HandlerFunc(api.PublishPostHandler)))
 	mux.Handle("DELETE /posts/{postID}", middleware.AuthMiddleware(http.HandlerFunc(api.DeletePostHandler)))
 
+	// Poll routes
+	mux.Handle("GET /polls/{pollID}", middleware.AuthMiddleware(http.HandlerFunc(api.GetPollHandler)))
+	mux.Handle("POST /polls/{pollID}/votes", middleware.AuthMiddleware(http.HandlerFunc(api.VotePollHandler)))
+	mux.Handle("DELETE /polls/{pollID}/votes", middleware.AuthMiddleware(http.HandlerFunc(api.UnvotePollHandler)))
+
 	// Image upload handler
 	mux.Handle("POST /upload-image", middleware.AuthMiddleware(http.HandlerFunc(api.ImageUploadHandler)))
 
@@ -105,13 +150,37 @@ func main() {
 	mux.Handle("GET /follow-requests", middleware.AuthMiddleware(http.HandlerFunc(api.GetPendingFollowRequestsHandler)))
 	// To accept/reject a follow request made by {followerID} to the authenticated user:
 	mux.Handle("PATCH /follow-requests/{followerID}", middleware.AuthMiddleware(http.HandlerFunc(api.HandleFollowRequestHandler)))
+	// To list and cancel follow requests sent by the authenticated user:
+	mux.Handle("GET /follow-requests/sent", middleware.AuthMiddleware(http.HandlerFunc(api.GetSentFollowRequestsHandler)))
+	mux.Handle("DELETE /follow-requests/sent/{targetUserID}", middleware.AuthMiddleware(http.HandlerFunc(api.CancelFollowRequestHandler)))
+	// To remove one of the authenticated user's followers:
+	mux.Handle("DELETE /users/me/followers/{followerID}", middleware.AuthMiddleware(http.HandlerFunc(api.RemoveFollowerHandler)))
+
+	// Block handlers
+	mux.Handle("POST /users/{targetUserID}/block", middleware.AuthMiddleware(http.HandlerFunc(api.BlockUserHandler)))
+	mux.Handle("DELETE /users/{targetUserID}/block", middleware.AuthMiddleware(http.HandlerFunc(api.UnblockUserHandler)))
+	mux.Handle("GET /blocks", middleware.AuthMiddleware(http.HandlerFunc(api.GetBlockedUsersHandler)))
+
+	// Mute handlers
+	mux.Handle("POST /users/{targetUserID}/mute", middleware.AuthMiddleware(http.HandlerFunc(api.MuteUserHandler)))
+	mux.Handle("DELETE /users/{targetUserID}/mute", middleware.AuthMiddleware(http.HandlerFunc(api.UnmuteUserHandler)))
+	mux.Handle("POST /conversations/{otherUserID}/mute", middleware.AuthMiddleware(http.HandlerFunc(api.MuteConversationHandler)))
+	mux.Handle("DELETE /conversations/{otherUserID}/mute", middleware.AuthMiddleware(http.HandlerFunc(api.UnmuteConversationHandler)))
+	mux.Handle("POST /groups/{groupID}/chat/mute", middleware.AuthMiddleware(http.HandlerFunc(api.MuteGroupChatHandler)))
+	mux.Handle("DELETE /groups/{groupID}/chat/mute", middleware.AuthMiddleware(http.HandlerFunc(api.UnmuteGroupChatHandler)))
+	mux.Handle("GET /mutes", middleware.AuthMiddleware(http.HandlerFunc(api.GetMutesHandler)))
 
 	// User Profile & Settings handlers
 	// New V2 User Profile Endpoint
 	mux.Handle("GET /v2/users/{userID}", middleware.AuthMiddleware(http.HandlerFunc(api.GetUserProfileV2Handler)))
 	mux.Handle("GET /v2/users/me", middleware.AuthMiddleware(http.HandlerFunc(api.GetUserProfileV2Handler)))
 	mux.Handle("PUT /v2/users/me", middleware.AuthMiddleware(http.HandlerFunc(api.UpdateUserProfileV2Handler)))
+	mux.Handle("GET /users/me/field-visibility", middleware.AuthMiddleware(http.HandlerFunc(api.GetProfileFieldVisibilityHandler)))
+	mux.Handle("PUT /users/me/field-visibility", middleware.AuthMiddleware(http.HandlerFunc(api.UpdateProfileFieldVisibilityHandler)))
+	mux.Handle("GET /users", middleware.AuthMiddleware(http.HandlerFunc(api.SearchUsersHandler)))
 	mux.Handle("GET /users/available-for-invite", middleware.AuthMiddleware(http.HandlerFunc(api.GetAvailableUsersHandler)))
+	mux.Handle("GET /users/suggestions", middleware.AuthMiddleware(http.HandlerFunc(api.GetFollowSuggestionsHandler)))
+	mux.Handle("POST /users/suggestions/{suggestedUserID}/dismiss", middleware.AuthMiddleware(http.HandlerFunc(api.DismissSuggestionHandler)))
 	mux.Handle("GET /whoami", middleware.AuthMiddleware(http.HandlerFunc(api.WhoAmIHandler)))
 
 	// Close Friends handlers
@@ -119,6 +188,13 @@ func main() {
 	mux.Handle("DELETE /close-friends/{targetUserID}", middleware.AuthMiddleware(http.HandlerFunc(api.RemoveCloseFriendHandler)))
 	mux.Handle("GET /close-friends", middleware.AuthMiddleware(http.HandlerFunc(api.GetCloseFriendsHandler)))
 	mux.Handle("GET /close-friends/check/{targetUserID}", middleware.AuthMiddleware(http.HandlerFunc(api.CheckCloseFriendHandler)))
+	mux.Handle("GET /close-friends/lists", middleware.AuthMiddleware(http.HandlerFunc(api.GetAudienceListsHandler)))
+	mux.Handle("POST /close-friends/lists", middleware.AuthMiddleware(http.HandlerFunc(api.CreateAudienceListHandler)))
+	mux.Handle("PATCH /close-friends/lists/{listID}", middleware.AuthMiddleware(http.HandlerFunc(api.RenameAudienceListHandler)))
+	mux.Handle("DELETE /close-friends/lists/{listID}", middleware.AuthMiddleware(http.HandlerFunc(api.DeleteAudienceListHandler)))
+	mux.Handle("GET /close-friends/lists/{listID}/members", middleware.AuthMiddleware(http.HandlerFunc(api.GetAudienceListMembersHandler)))
+	mux.Handle("POST /close-friends/lists/{listID}/members", middleware.AuthMiddleware(http.HandlerFunc(api.AddAudienceListMemberHandler)))
+	mux.Handle("DELETE /close-friends/lists/{listID}/members/{targetUserID}", middleware.AuthMiddleware(http.HandlerFunc(api.RemoveAudienceListMemberHandler)))
 
 	// ... other handlers for groups, events, notifications, etc. would go here ...
 	// ...existing code...
@@ -130,6 +206,9 @@ func main() {
 	mux.Handle("GET /chat/users", middleware.AuthMiddleware(http.HandlerFunc(api.GetChattableUsersHandler)))
 	mux.Handle("GET /messages/{otherUserID}", middleware.AuthMiddleware(http.HandlerFunc(api.GetMessagesHandler)))
 	mux.Handle("PATCH /messages/{messageID}/read", middleware.AuthMiddleware(http.HandlerFunc(api.MarkMessageAsReadHandler)))
+	mux.Handle("POST /conversations/{otherUserID}/read", middleware.AuthMiddleware(http.HandlerFunc(api.MarkConversationReadHandler)))
+	mux.Handle("GET /users/me/message-settings", middleware.AuthMiddleware(http.HandlerFunc(api.GetMessageSettingsHandler)))
+	mux.Handle("PUT /users/me/message-settings", middleware.AuthMiddleware(http.HandlerFunc(api.UpdateMessageSettingsHandler)))
 	// Group management routes
 	mux.Handle("POST /groups", middleware.AuthMiddleware(http.HandlerFunc(api.CreateGroupHandler)))
 	mux.Handle("GET /groups", middleware.AuthMiddleware(http.HandlerFunc(api.ListGroupsHandler)))
@@ -172,14 +251,14 @@ func main() {
 	mux.Handle("PATCH /notifications/{notificationID}/read", middleware.AuthMiddleware(http.HandlerFunc(api.MarkNotificationAsReadHandler)))
 	mux.Handle("POST /notifications/mark-all-read", middleware.AuthMiddleware(http.HandlerFunc(api.MarkAllNotificationsAsReadHandler)))
 
-	// Static file server for uploaded images
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads/"))))
+	// Uploaded images, served from the media store
+	mux.HandleFunc("GET /uploads/{key...}", api.ServeMediaHandler)
 
 	// --- CORS Middleware ---
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Last-Event-ID"},
 		AllowCredentials: true, // Required for cookies!
 	})
 
@@ -193,3 +272,13 @@ func main() {
 	fmt.Printf("Server running on localhost:%s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
+
+// serveDebug serves /debug/vars on addr.
+func serveDebug(addr string) {
+	debugMux := http.NewServeMux()
+	debugMux.Handle("GET /debug/vars", expvar.Handler())
+	log.Printf("Serving /debug/vars on %s", addr)
+	if err := http.ListenAndServe(addr, debugMux); err != nil {
+		log.Printf("Debug listener stopped: %v", err)
+	}
+}
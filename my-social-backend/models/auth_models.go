@@ -81,6 +81,23 @@ type UserRelationshipV2 struct {
 	IsCloseFriend               bool `json:"is_close_friend"`
 }
 
+// UserGroupV2 is a group the profile owner is a member of.
+type UserGroupV2 struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Role  string `json:"role"`
+}
+
+// ProfileSectionsV2 tells the viewer which sections of the profile they are allowed to see.
+// Hidden sections are returned empty.
+type ProfileSectionsV2 struct {
+	Posts     bool `json:"posts"`
+	Stats     bool `json:"stats"`
+	Followers bool `json:"followers"`
+	Following bool `json:"following"`
+	Groups    bool `json:"groups"`
+}
+
 // UserProfileV2Response is the response structure for the V2 user profile endpoint.
 // It uses the existing PostResponse for consistency.
 type UserProfileV2Response struct {
@@ -88,4 +105,14 @@ type UserProfileV2Response struct {
 	Stats        UserStatsV2         `json:"stats"`
 	Relationship *UserRelationshipV2 `json:"relationship,omitempty"` // Pointer to allow null if not applicable (e.g., viewing own profile or not logged in)
 	Posts        []PostResponse      `json:"posts,omitempty"`        // Reusing your existing PostResponse
+	Groups       []UserGroupV2       `json:"groups"`
+	Sections     ProfileSectionsV2   `json:"sections"`
+}
+
+// ProfileFieldVisibility holds who can see each optional profile field: "everyone"
+// (anyone who can see the profile), "followers" or "only_me".
+type ProfileFieldVisibility struct {
+	Email       string `json:"email"`
+	DateOfBirth string `json:"date_of_birth"`
+	AboutMe     string `json:"about_me"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// BlockedUserResponse describes a user the viewer has blocked.
+type BlockedUserResponse struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Avatar    string    `json:"avatar"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockStatusResponse indicates the result of a block/unblock action.
+type BlockStatusResponse struct {
+	TargetUserID int64  `json:"target_user_id"`
+	Blocked      bool   `json:"blocked"`
+	Message      string `json:"message,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// UserCardRelationship is the viewer's relationship with a user in the directory.
+type UserCardRelationship struct {
+	IsFollowing   bool `json:"is_following"`   // viewer follows them (accepted)
+	FollowPending bool `json:"follow_pending"` // viewer's follow request is pending
+	FollowsViewer bool `json:"follows_viewer"` // they follow the viewer (accepted)
+	Blocked       bool `json:"blocked"`        // viewer blocked them
+	MutualCount   int  `json:"mutual_count"`   // people the viewer follows who follow them
+}
+
+// UserCard is a user as listed in the directory.
+type UserCard struct {
+	ID           int64                `json:"id"`
+	Username     string               `json:"username"`
+	FirstName    string               `json:"first_name"`
+	LastName     string               `json:"last_name"`
+	Nickname     string               `json:"nickname,omitempty"`
+	Avatar       string               `json:"avatar"`
+	IsPrivate    bool                 `json:"is_private"`
+	Relationship UserCardRelationship `json:"relationship"`
+}
+
+// UserDirectoryResponse is one page of the user directory. NextCursor is empty on
+// the last page.
+type UserDirectoryResponse struct {
+	Users      []UserCard `json:"users"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Limits for media attached to a post or group post.
+const (
+	PostMaxMedia      = 10
+	MediaMaxAltLength = 1000
+)
+
+// MediaVariant is a resized copy generated for an upload.
+type MediaVariant struct {
+	ImagePath string `json:"image_path"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+}
+
+// MediaUploadResponse describes a stored upload. Its ID is what gets attached to posts.
+type MediaUploadResponse struct {
+	ID          int64         `json:"media_id"`
+	ImagePath   string        `json:"image_path"`
+	MimeType    string        `json:"mime_type"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	SizeBytes   int64         `json:"size_bytes"`
+	ContentHash string        `json:"content_hash"`
+	Thumbnail   *MediaVariant `json:"thumbnail,omitempty"`
+	Medium      *MediaVariant `json:"medium,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// AvatarUploadResponse describes a processed avatar upload.
+type AvatarUploadResponse struct {
+	AvatarURL   string        `json:"avatar_url"`
+	URL         string        `json:"url"` // Same as AvatarURL, kept for older clients
+	MimeType    string        `json:"mime_type"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	SizeBytes   int64         `json:"size_bytes"`
+	ContentHash string        `json:"content_hash"`
+	Thumbnail   *MediaVariant `json:"thumbnail,omitempty"`
+	Medium      *MediaVariant `json:"medium,omitempty"`
+}
+
+// AttachMediaRequest attaches one of the caller's uploads to a post. Items are
+// displayed in the order they are sent.
+type AttachMediaRequest struct {
+	MediaID int64  `json:"media_id"`
+	AltText string `json:"alt_text,omitempty"`
+}
+
+// PostMediaResponse is a media item attached to a post or group post.
+type PostMediaResponse struct {
+	MediaID       int64  `json:"media_id"`
+	ImagePath     string `json:"image_path"`
+	ThumbnailPath string `json:"thumbnail_path,omitempty"`
+	MediumPath    string `json:"medium_path,omitempty"`
+	MimeType      string `json:"mime_type"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Position      int    `json:"position"`
+	AltText       string `json:"alt_text"`
+}
@@ -17,15 +17,26 @@ type MessageResponse struct {
     ReceiverID     int64     `json:"receiver_id"`
     SenderUsername string    `json:"sender_username"`
     Content        string    `json:"content"`
-    IsRead         bool      `json:"is_read"`
-    CreatedAt      time.Time `json:"created_at"`
-    IsSentByViewer bool      `json:"is_sent_by_viewer"`
+    IsRead         bool       `json:"is_read"`
+    ReadAt         *time.Time `json:"read_at,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    IsSentByViewer bool       `json:"is_sent_by_viewer"`
 }
 
 type SendMessageRequest struct {
     Content string `json:"content"`
 }
 
+// MarkConversationReadRequest is the body of POST /conversations/{otherUserID}/read.
+type MarkConversationReadRequest struct {
+    UpToMessageID int64 `json:"up_to_message_id"` // newest message read; everything before it is read too
+}
+
+// MessageSettings are a user's messaging preferences.
+type MessageSettings struct {
+    ReadReceipts bool `json:"read_receipts"` // let others see when you read their messages
+}
+
 type Conversation struct {
     ID            int64     `json:"id"`
     User1ID       int64     `json:"user1_id"`
@@ -43,9 +54,18 @@ type ConversationResponse struct {
     LastMessageText   string     `json:"last_message_text,omitempty"`
     LastMessageTime   *time.Time `json:"last_message_time,omitempty"`
     UnreadCount       int        `json:"unread_count"`
+    LastMessageID     int64      `json:"last_message_id"`
+    LastReadID        int64      `json:"last_read_id"` // newest message from the other user that the viewer read
+    OtherLastReadID   int64      `json:"other_last_read_id"` // newest message from the viewer that the other user read; 0 if they hide read receipts
     IsOnline          bool       `json:"is_online"` // New field
 }
 
+// ConversationListResponse is a page of GET /conversations, most recent first.
+type ConversationListResponse struct {
+    Conversations []ConversationResponse `json:"conversations"`
+    NextCursor    string                 `json:"next_cursor,omitempty"`
+}
+
 type TypingIndicatorRequest struct {
     ReceiverID int64 `json:"receiver_id"`
     IsTyping   bool  `json:"is_typing"`
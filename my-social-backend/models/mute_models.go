@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MuteRequest is the optional body accepted when muting a user, conversation or group chat.
+type MuteRequest struct {
+	Until *time.Time `json:"until,omitempty"` // Optional: the mute ends at this time
+}
+
+// MuteResponse describes an active mute.
+type MuteResponse struct {
+	TargetType string     `json:"target_type"` // "user", "conversation" or "group_chat"
+	TargetID   int64      `json:"target_id"`
+	Until      *time.Time `json:"until,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Poll limits enforced when a poll is attached to a post.
+const (
+	PollMinOptions = 2
+	PollMaxOptions = 10
+)
+
+// CreatePollRequest is the poll attachment accepted when creating a post or group post.
+type CreatePollRequest struct {
+	Options        []string   `json:"options"`             // 2-10 option labels, in display order
+	MultipleChoice bool       `json:"multiple_choice"`     // Allow voting for more than one option
+	ClosesAt       *time.Time `json:"closes_at,omitempty"` // Optional: poll closes automatically at this time
+}
+
+// PollVoteRequest defines the options a user votes for.
+type PollVoteRequest struct {
+	OptionIDs []int64 `json:"option_ids"`
+}
+
+// PollOptionResponse is a single poll option. VoteCount is only set when the
+// viewer is allowed to see the results.
+type PollOptionResponse struct {
+	ID        int64  `json:"id"`
+	Text      string `json:"text"`
+	Position  int    `json:"position"`
+	VoteCount *int   `json:"vote_count,omitempty"`
+}
+
+// PollResponse describes a poll as seen by a particular viewer.
+// Results are hidden until the viewer has voted, the poll is closed, or the viewer created it.
+type PollResponse struct {
+	ID             int64                `json:"id"`
+	PostID         *int64               `json:"post_id,omitempty"`
+	GroupPostID    *int64               `json:"group_post_id,omitempty"`
+	CreatorID      int64                `json:"creator_id"`
+	MultipleChoice bool                 `json:"multiple_choice"`
+	ClosesAt       *time.Time           `json:"closes_at,omitempty"`
+	ClosedAt       *time.Time           `json:"closed_at,omitempty"`
+	IsClosed       bool                 `json:"is_closed"`
+	Options        []PollOptionResponse `json:"options"`
+	ResultsVisible bool                 `json:"results_visible"`
+	TotalVoters    *int                 `json:"total_voters,omitempty"`
+	UserVotes      []int64              `json:"user_votes"` // Option IDs the viewer voted for
+	CreatedAt      time.Time            `json:"created_at"`
+}
@@ -2,33 +2,56 @@ package models
 
 import "time"
 
+// Post publication states stored in posts.status.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 // CreatePostRequest defines the structure for creating a new post.
 type CreatePostRequest struct {
-	Content   string `json:"content"`
-	ImagePath string `json:"image_path,omitempty"` // Optional: Path to uploaded image
-	Privacy   int    `json:"privacy"`              // 0=public, 1=followers, 2=close_friends
+	Content   string               `json:"content"`
+	ImagePath string               `json:"image_path,omitempty"` // Deprecated: use Media; resolved to the caller's upload with this path
+	Media     []AttachMediaRequest `json:"media,omitempty"`      // Optional: up to PostMaxMedia uploads, in display order
+	Privacy   int                  `json:"privacy"`              // 0=public, 1=followers, 2=audience lists
+	Status    string               `json:"status,omitempty"`     // draft, scheduled or published (default)
+	PublishAt *time.Time           `json:"publish_at,omitempty"` // Required when status is scheduled
+	Poll      *CreatePollRequest   `json:"poll,omitempty"`       // Optional poll attachment
+	// AudienceListIDs are the caller's lists a privacy 2 post is shared with.
+	// Empty means the built-in close friends list.
+	AudienceListIDs []int64 `json:"audience_list_ids,omitempty"`
+}
+
+// PublishPostRequest is the optional body for publishing or scheduling an existing draft.
+type PublishPostRequest struct {
+	PublishAt *time.Time `json:"publish_at,omitempty"` // Omit to publish immediately
 }
 
 // PostResponse defines the structure for a post returned by the API.
 // This includes fields that were added in previous steps like LikeCount and UserLiked.
 // ...existing code...
 type PostResponse struct {
-	ID              int64     `json:"id"`
-	UserID          int64     `json:"user_id"` // Author's UserID
-	AuthorUsername  string    `json:"author_username"`
-	AuthorFirstName string    `json:"author_first_name"`
-	AuthorLastName  string    `json:"author_last_name"`
-	AuthorAvatar    string    `json:"author_avatar"`
-	Content         string    `json:"content"`
-	ImagePath       string    `json:"image_path,omitempty"` // Path to post image
-	Title           string    `json:"title,omitempty"`      // Added Title field
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-	LikeCount       int       `json:"like_count"`
-	DislikeCount    int       `json:"dislike_count"`
-	UserLiked       bool      `json:"user_liked"`
-	UserDisliked    bool      `json:"user_disliked"`
-	Privacy         int       `json:"privacy,omitempty"` // Added Privacy field
+	ID              int64               `json:"id"`
+	UserID          int64               `json:"user_id"` // Author's UserID
+	AuthorUsername  string              `json:"author_username"`
+	AuthorFirstName string              `json:"author_first_name"`
+	AuthorLastName  string              `json:"author_last_name"`
+	AuthorAvatar    string              `json:"author_avatar"`
+	Content         string              `json:"content"`
+	ImagePath       string              `json:"image_path,omitempty"` // Path of the first media item, kept for older clients
+	Media           []PostMediaResponse `json:"media"`
+	Title           string              `json:"title,omitempty"` // Added Title field
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+	LikeCount       int                 `json:"like_count"`
+	DislikeCount    int                 `json:"dislike_count"`
+	UserLiked       bool                `json:"user_liked"`
+	UserDisliked    bool                `json:"user_disliked"`
+	Privacy         int                 `json:"privacy,omitempty"` // Added Privacy field
+	Status          string              `json:"status,omitempty"`
+	PublishAt       *time.Time          `json:"publish_at,omitempty"`
+	Poll            *PollResponse       `json:"poll,omitempty"`
 }
 
 // Close Friends Models
@@ -44,3 +67,18 @@ type CloseFriendResponse struct {
 	Avatar        string `json:"avatar"`
 	IsCloseFriend bool   `json:"is_close_friend"`
 }
+
+// AudienceListRequest is the body for creating or renaming an audience list.
+type AudienceListRequest struct {
+	Name string `json:"name"`
+}
+
+// AudienceListResponse describes one of the caller's audience lists. The close
+// friends list is built in: it can't be renamed or deleted.
+type AudienceListResponse struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	IsCloseFriends bool      `json:"is_close_friends"`
+	MemberCount    int       `json:"member_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// FollowSuggestionResponse is a "people you may know" entry, with the signals it was ranked by.
+type FollowSuggestionResponse struct {
+	ID            int64  `json:"id"`
+	Username      string `json:"username"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Avatar        string `json:"avatar"`
+	IsPrivate     bool   `json:"is_private"`
+	MutualFollows int    `json:"mutual_follows"` // People the viewer follows who follow this user
+	SharedGroups  int    `json:"shared_groups"`  // Groups both are members of
+	Interactions  int    `json:"interactions"`   // Likes and comments between the two, either way
+}
@@ -0,0 +1,340 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WSProtocolVersion is the version of the WebSocket protocol the server speaks.
+// Requests without a version are treated as this version.
+const WSProtocolVersion = 1
+
+// WSEnvelope wraps every WebSocket message in both directions. ID is chosen by
+// the client for requests and echoed on the replies and errors they cause; Seq is
+// set on server events that are kept for replay (see the resume request).
+type WSEnvelope struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Version int         `json:"version,omitempty"`
+	Seq     int64       `json:"seq,omitempty"`
+	Data    interface{} `json:"data"`
+}
+
+// WSRequestEnvelope is WSEnvelope as read from the client, with Data left raw until
+// the type is known.
+type WSRequestEnvelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Error codes sent in WSErrorData.Code.
+const (
+	WSErrBadRequest         = "bad_request"         // malformed envelope or data
+	WSErrUnknownType        = "unknown_type"        // no such request type
+	WSErrUnsupportedVersion = "unsupported_version" // version newer than WSProtocolVersion
+	WSErrForbidden          = "forbidden"           // not allowed, e.g. blocked or not a group member
+	WSErrNotFound           = "not_found"           // the target, e.g. a message's receiver, doesn't exist
+	WSErrInternal           = "internal_error"      // the server failed; retrying may help
+	WSErrRateLimited        = "rate_limited"        // too many requests of that type; retry after RetryAfterMs
+)
+
+// WSErrorData is the data of an "error" event. The envelope ID is the ID of the
+// request that failed.
+type WSErrorData struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // rate_limited only: when the request would be allowed
+}
+
+// Client requests.
+
+type WSDirectMessageRequest struct {
+	ReceiverID int64  `json:"receiver_id"`
+	Content    string `json:"content"`
+}
+
+type WSTypingIndicatorRequest struct {
+	ReceiverID int64 `json:"receiver_id"`
+	IsTyping   bool  `json:"is_typing"`
+}
+
+type WSMessageReadRequest struct {
+	MessageID int64 `json:"message_id"`
+}
+
+type WSGroupMessageRequest struct {
+	GroupID int64  `json:"group_id"`
+	Content string `json:"content"`
+}
+
+type WSOpenConversationRequest struct {
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+type WSResumeRequest struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+type WSAckRequest struct {
+	Seq int64 `json:"seq"`
+}
+
+// WSEmptyRequest is the data of requests that carry none.
+type WSEmptyRequest struct{}
+
+// Server events.
+
+type WSConnected struct {
+	Status  string `json:"status"`
+	Seq     int64  `json:"seq"`
+	Version int    `json:"version"`
+}
+
+type WSDirectMessage struct {
+	ID         int64     `json:"id"`
+	SenderID   int64     `json:"sender_id"`
+	ReceiverID int64     `json:"receiver_id"`
+	Username   string    `json:"username"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WSNewMessage is a direct message delivered to its receiver.
+type WSNewMessage struct {
+	ID             int64     `json:"id"`
+	SenderID       int64     `json:"sender_id"`
+	ReceiverID     int64     `json:"receiver_id"`
+	SenderUsername string    `json:"sender_username"`
+	SenderAvatar   string    `json:"sender_avatar"`
+	Content        string    `json:"content"`
+	IsRead         bool      `json:"is_read"`
+	CreatedAt      time.Time `json:"created_at"`
+	IsSentByViewer bool      `json:"is_sent_by_viewer"`
+}
+
+type WSNewMessagePopup struct {
+	SenderID       int64     `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	SenderAvatar   string    `json:"sender_avatar"`
+	Message        string    `json:"message"`
+	MessageID      int64     `json:"message_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WSMessageDelivered struct {
+	MessageID   int64     `json:"message_id"`
+	DeliveredTo int64     `json:"delivered_to"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Status      string    `json:"status"`
+}
+
+type WSConversationUpdated struct {
+	UnreadCount    int       `json:"unread_count"`
+	LastMessage    string    `json:"last_message"`
+	MessageTime    time.Time `json:"message_time"`
+	SenderID       int64     `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+}
+
+type WSOfflineMessagesNotification struct {
+	Count     int       `json:"count"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WSTypingIndicator is sent for both the WebSocket request and POST
+// /messages/typing; only the latter fills in the username and timestamp.
+type WSTypingIndicator struct {
+	SenderID       int64      `json:"sender_id"`
+	SenderUsername string     `json:"sender_username,omitempty"`
+	IsTyping       bool       `json:"is_typing"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+}
+
+// WSConversationRead moves a conversation's read marker: ReaderID has read every
+// message OtherUserID sent them up to LastReadMessageID.
+type WSConversationRead struct {
+	ReaderID          int64     `json:"reader_id"`
+	OtherUserID       int64     `json:"other_user_id"`
+	LastReadMessageID int64     `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+type WSUnreadMessagesCount struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+type WSGroupMessage struct {
+	ID        int64     `json:"id"`
+	GroupID   int64     `json:"group_id"`
+	SenderID  int64     `json:"sender_id"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WSGroupMessageNotification struct {
+	GroupID        int64     `json:"group_id"`
+	GroupMessageID int64     `json:"group_message_id"`
+	SenderID       int64     `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WSUserStatus struct {
+	UserID int64 `json:"user_id"`
+}
+
+type WSPostLikeUpdated struct {
+	PostID       int64 `json:"post_id"`
+	LikeCount    int   `json:"like_count"`
+	DislikeCount int   `json:"dislike_count"`
+}
+
+type WSNotification struct {
+	Type        string  `json:"type"`
+	Title       string  `json:"title"`
+	Message     string  `json:"message"`
+	RelatedID   *int    `json:"related_id"`
+	RelatedType *string `json:"related_type"`
+	ActorID     *int    `json:"actor_id"`
+}
+
+type WSNotificationCount struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+type WSFollowRequestCancelled struct {
+	FollowerID int64 `json:"follower_id"`
+}
+
+type WSFollowerRemoved struct {
+	FollowedID int64 `json:"followed_id"`
+}
+
+type WSGroupMemberJoined struct {
+	UserID int64 `json:"user_id"`
+}
+
+type WSGroupPost struct {
+	ID        int64               `json:"id"`
+	GroupID   int64               `json:"group_id"`
+	UserID    int64               `json:"user_id"`
+	Content   string              `json:"content"`
+	Media     []PostMediaResponse `json:"media"`
+	Poll      *PollResponse       `json:"poll,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+type WSGroupPostComment struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WSGroupEvent struct {
+	ID          int64     `json:"id"`
+	GroupID     int64     `json:"group_id"`
+	CreatorID   int64     `json:"creator_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	EventTime   time.Time `json:"event_time"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WSGroupEventRSVP struct {
+	EventID  int64  `json:"event_id"`
+	UserID   int64  `json:"user_id"`
+	Response string `json:"response"`
+}
+
+type WSResumed struct {
+	Seq      int64 `json:"seq"`
+	Replayed int   `json:"replayed"`
+}
+
+type WSResyncRequired struct {
+	Seq int64 `json:"seq"`
+}
+
+// Message directions in WSEventSpec.
+const (
+	WSFromClient = "client"
+	WSFromServer = "server"
+)
+
+// WSEventSpec documents one message type. Data is a zero value of the message's
+// data type and is what the protocol document and JSON Schema are generated from.
+type WSEventSpec struct {
+	Type        string
+	Direction   string
+	Description string
+	Data        interface{}
+}
+
+// WSEvents lists every message of the protocol; a test in util/api fails if a
+// client type here has no handler or the reverse. docs/ws-protocol.md and
+// docs/ws-protocol.schema.json are generated from it:
+//
+//go:generate go run ../cmd/wsschema -out ../docs
+var WSEvents = []WSEventSpec{
+	{"direct_message", WSFromClient, "Send a direct message.", WSDirectMessageRequest{}},
+	{"typing_indicator", WSFromClient, "Tell the other user you are (or stopped) typing.", WSTypingIndicatorRequest{}},
+	{"message_read", WSFromClient, "Mark a direct message you received, and the ones before it, as read.", WSMessageReadRequest{}},
+	{"group_message", WSFromClient, "Send a message to a group chat you are a member of.", WSGroupMessageRequest{}},
+	{"open_conversation", WSFromClient, "Tell the server a conversation is open.", WSOpenConversationRequest{}},
+	{"request_online_status", WSFromClient, "Ask for user_online events for everyone you can chat with who is online.", WSEmptyRequest{}},
+	{"heartbeat", WSFromClient, "Keep the connection alive.", WSEmptyRequest{}},
+	{"ping", WSFromClient, "Ask for a pong.", WSEmptyRequest{}},
+	{"resume", WSFromClient, "After reconnecting, replay every event after last_seq.", WSResumeRequest{}},
+	{"ack", WSFromClient, "Confirm every event up to seq was processed.", WSAckRequest{}},
+
+	{"connected", WSFromServer, "First message on a new connection.", WSConnected{}},
+	{"error", WSFromServer, "A request failed; the envelope id is the request's.", WSErrorData{}},
+	{"direct_message_sent", WSFromServer, "A direct message you sent, on all your devices.", WSDirectMessage{}},
+	{"new_message", WSFromServer, "A direct message sent to you, when you are online and take instant messages from the sender.", WSNewMessage{}},
+	{"new_message_popup", WSFromServer, "A direct message to show as a popup.", WSNewMessagePopup{}},
+	{"message_delivered", WSFromServer, "A direct message you sent reached the receiver.", WSMessageDelivered{}},
+	{"conversation_read", WSFromServer, "A conversation was read up to a message, by you on another device or by the other user.", WSConversationRead{}},
+	{"unread_messages_count", WSFromServer, "Your unread direct message count changed.", WSUnreadMessagesCount{}},
+	{"conversation_updated", WSFromServer, "A conversation got a new message.", WSConversationUpdated{}},
+	{"offline_messages_notification", WSFromServer, "Messages arrived while you were offline.", WSOfflineMessagesNotification{}},
+	{"typing_indicator", WSFromServer, "Someone is (or stopped) typing to you.", WSTypingIndicator{}},
+	{"group_message", WSFromServer, "A message in one of your group chats.", WSGroupMessage{}},
+	{"group_message_sent", WSFromServer, "A group message you sent, on all your devices.", WSGroupMessage{}},
+	{"group_message_notification", WSFromServer, "Notification of a group chat message.", WSGroupMessageNotification{}},
+	{"group_member_joined", WSFromServer, "Someone joined one of your groups.", WSGroupMemberJoined{}},
+	{"group_post_created", WSFromServer, "A post in one of your groups.", WSGroupPost{}},
+	{"group_post_comment_created", WSFromServer, "A comment on a post in one of your groups.", WSGroupPostComment{}},
+	{"group_event_created", WSFromServer, "An event in one of your groups.", WSGroupEvent{}},
+	{"group_event_rsvp_updated", WSFromServer, "Someone answered a group event.", WSGroupEventRSVP{}},
+	{"user_online", WSFromServer, "Someone you follow or who follows you came online.", WSUserStatus{}},
+	{"user_offline", WSFromServer, "Someone you follow or who follows you went offline.", WSUserStatus{}},
+	{"new_post", WSFromServer, "A post you can see was published.", PostResponse{}},
+	{"new_comment", WSFromServer, "A comment on a post you can see.", CommentResponse{}},
+	{"post_like_updated", WSFromServer, "A post's like counts changed.", WSPostLikeUpdated{}},
+	{"poll_results_updated", WSFromServer, "A poll you created or voted in got a vote.", PollResponse{}},
+	{"poll_closed", WSFromServer, "A poll you created or voted in closed.", PollResponse{}},
+	{"follow_request", WSFromServer, "Notification: someone asked to follow you.", WSNotification{}},
+	{"follow_accepted", WSFromServer, "Notification: your follow request was accepted.", WSNotification{}},
+	{"new_follower", WSFromServer, "Notification: someone followed you.", WSNotification{}},
+	{"post_like", WSFromServer, "Notification: someone liked your post.", WSNotification{}},
+	{"post_comment", WSFromServer, "Notification: someone commented on your post.", WSNotification{}},
+	{"poll_closed_notification", WSFromServer, "Notification: your poll closed (data.type is \"poll_closed\").", WSNotification{}},
+	{"follow_requests_approved", WSFromServer, "Notification: pending follow requests were approved.", WSNotification{}},
+	{"review_followers", WSFromServer, "Notification: review your followers after going private.", WSNotification{}},
+	{"notification_count_update", WSFromServer, "Your unread notification count changed.", WSNotificationCount{}},
+	{"follow_request_cancelled", WSFromServer, "A follow request to you was withdrawn.", WSFollowRequestCancelled{}},
+	{"follower_removed", WSFromServer, "Someone removed you from their followers.", WSFollowerRemoved{}},
+	{"resumed", WSFromServer, "A resume finished.", WSResumed{}},
+	{"resync_required", WSFromServer, "A resume could not replay everything; reload over REST.", WSResyncRequired{}},
+	{"heartbeat_ack", WSFromServer, "Reply to heartbeat; data is \"ok\".", ""},
+	{"open_conversation_ack", WSFromServer, "Reply to open_conversation; data is \"ok\".", ""},
+	{"pong", WSFromServer, "Reply to ping; data is \"pong\".", ""},
+}
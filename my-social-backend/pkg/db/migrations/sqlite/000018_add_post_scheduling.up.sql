@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'published' CHECK(status IN ('draft', 'scheduled', 'published'));
+ALTER TABLE posts ADD COLUMN publish_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_posts_status_publish_at ON posts(status, publish_at);
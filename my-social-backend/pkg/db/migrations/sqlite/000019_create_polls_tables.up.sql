@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS polls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),
+    group_post_id INTEGER REFERENCES group_posts(id),
+    creator_id INTEGER NOT NULL REFERENCES users(id),
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at DATETIME,
+    closed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((post_id IS NOT NULL) + (group_post_id IS NOT NULL) = 1)
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL REFERENCES polls(id),
+    text TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    UNIQUE(poll_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL REFERENCES polls(id),
+    option_id INTEGER NOT NULL REFERENCES poll_options(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(option_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_post_id ON polls(post_id);
+CREATE INDEX IF NOT EXISTS idx_polls_group_post_id ON polls(group_post_id);
+CREATE INDEX IF NOT EXISTS idx_polls_open_closes_at ON polls(closes_at) WHERE closed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_poll_votes_poll_user ON poll_votes(poll_id, user_id);
@@ -0,0 +1,15 @@
+-- Put the first media item of each post back into posts.image_path
+UPDATE posts
+SET image_path = (
+    SELECT m.file_path
+    FROM post_media pm
+    JOIN media_uploads m ON m.id = pm.media_id
+    WHERE pm.post_id = posts.id
+    ORDER BY pm.position
+    LIMIT 1
+)
+WHERE (image_path IS NULL OR image_path = '')
+  AND EXISTS (SELECT 1 FROM post_media pm WHERE pm.post_id = posts.id);
+
+DROP TABLE IF EXISTS post_media;
+DROP TABLE IF EXISTS media_uploads;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS media_uploads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    file_path TEXT NOT NULL UNIQUE,
+    mime_type TEXT NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS post_media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),
+    group_post_id INTEGER REFERENCES group_posts(id),
+    media_id INTEGER NOT NULL REFERENCES media_uploads(id),
+    position INTEGER NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    CHECK ((post_id IS NOT NULL) + (group_post_id IS NOT NULL) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_uploads_user_id ON media_uploads(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_media_post_position ON post_media(post_id, position) WHERE post_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_media_group_post_position ON post_media(group_post_id, position) WHERE group_post_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_post_media_media_id ON post_media(media_id);
+
+-- Carry existing single images over as the first media item of their post
+INSERT OR IGNORE INTO media_uploads (user_id, file_path, mime_type, created_at)
+SELECT user_id, image_path,
+       CASE
+           WHEN lower(image_path) LIKE '%.png' THEN 'image/png'
+           WHEN lower(image_path) LIKE '%.gif' THEN 'image/gif'
+           ELSE 'image/jpeg'
+       END,
+       MIN(created_at)
+FROM posts
+WHERE image_path IS NOT NULL AND image_path != ''
+GROUP BY image_path;
+
+INSERT INTO post_media (post_id, media_id, position)
+SELECT p.id, m.id, 0
+FROM posts p
+JOIN media_uploads m ON m.file_path = p.image_path;
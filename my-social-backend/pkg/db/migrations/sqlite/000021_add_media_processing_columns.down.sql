@@ -0,0 +1,4 @@
+ALTER TABLE media_uploads DROP COLUMN medium_path;
+ALTER TABLE media_uploads DROP COLUMN thumbnail_path;
+ALTER TABLE media_uploads DROP COLUMN content_hash;
+ALTER TABLE media_uploads DROP COLUMN size_bytes;
@@ -0,0 +1,4 @@
+ALTER TABLE media_uploads ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media_uploads ADD COLUMN content_hash TEXT;
+ALTER TABLE media_uploads ADD COLUMN thumbnail_path TEXT;
+ALTER TABLE media_uploads ADD COLUMN medium_path TEXT;
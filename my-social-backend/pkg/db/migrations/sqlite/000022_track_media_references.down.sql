@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_media_uploads_unreferenced;
+ALTER TABLE media_uploads DROP COLUMN unreferenced_since;
+ALTER TABLE media_uploads DROP COLUMN ref_count;
+ALTER TABLE media_uploads DROP COLUMN storage_bytes;
+ALTER TABLE media_uploads DROP COLUMN kind;
@@ -0,0 +1,13 @@
+ALTER TABLE media_uploads ADD COLUMN kind TEXT NOT NULL DEFAULT 'post' CHECK(kind IN ('post', 'avatar'));
+ALTER TABLE media_uploads ADD COLUMN storage_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media_uploads ADD COLUMN ref_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media_uploads ADD COLUMN unreferenced_since DATETIME;
+
+UPDATE media_uploads
+SET storage_bytes = size_bytes,
+    ref_count = (SELECT COUNT(*) FROM post_media WHERE post_media.media_id = media_uploads.id);
+
+-- Existing unattached uploads get a full grace period before the sweeper removes them
+UPDATE media_uploads SET unreferenced_since = CURRENT_TIMESTAMP WHERE ref_count = 0;
+
+CREATE INDEX IF NOT EXISTS idx_media_uploads_unreferenced ON media_uploads(unreferenced_since) WHERE ref_count <= 0;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    target_type TEXT NOT NULL CHECK(target_type IN ('user', 'conversation', 'group_chat')),
+    target_id INTEGER NOT NULL,
+    muted_until DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, target_type, target_id)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS follow_suggestions (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    suggested_user_id INTEGER NOT NULL REFERENCES users(id),
+    score INTEGER NOT NULL,
+    mutual_follows INTEGER NOT NULL DEFAULT 0,
+    shared_groups INTEGER NOT NULL DEFAULT 0,
+    interactions INTEGER NOT NULL DEFAULT 0,
+    computed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, suggested_user_id)
+);
+
+CREATE TABLE IF NOT EXISTS suggestion_dismissals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    suggested_user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, suggested_user_id)
+);
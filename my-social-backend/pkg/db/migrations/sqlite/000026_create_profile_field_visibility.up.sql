@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS profile_field_visibility (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    field TEXT NOT NULL CHECK(field IN ('email', 'date_of_birth', 'about_me')),
+    visibility TEXT NOT NULL CHECK(visibility IN ('everyone', 'followers', 'only_me')),
+    PRIMARY KEY (user_id, field)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS close_friends (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    close_friend_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (close_friend_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(user_id, close_friend_id)
+);
+
+INSERT OR IGNORE INTO close_friends (user_id, close_friend_id, created_at)
+SELECT l.user_id, m.member_id, m.created_at
+FROM audience_list_members m
+JOIN audience_lists l ON l.id = m.list_id
+WHERE l.is_close_friends;
+
+DROP TABLE IF EXISTS post_audiences;
+DROP TABLE IF EXISTS audience_list_members;
+DROP INDEX IF EXISTS idx_audience_lists_close_friends;
+DROP TABLE IF EXISTS audience_lists;
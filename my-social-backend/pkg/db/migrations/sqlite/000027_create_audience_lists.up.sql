@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS audience_lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    is_close_friends BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audience_lists_close_friends ON audience_lists(user_id) WHERE is_close_friends;
+
+CREATE TABLE IF NOT EXISTS audience_list_members (
+    list_id INTEGER NOT NULL REFERENCES audience_lists(id) ON DELETE CASCADE,
+    member_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list_id, member_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audience_list_members_member_id ON audience_list_members(member_id);
+
+CREATE TABLE IF NOT EXISTS post_audiences (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    list_id INTEGER NOT NULL REFERENCES audience_lists(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, list_id)
+);
+
+-- Close friends become each user's built-in list, and existing close friends
+-- posts target it
+INSERT INTO audience_lists (user_id, name, is_close_friends)
+SELECT user_id, 'Close Friends', TRUE FROM (
+    SELECT user_id FROM close_friends
+    UNION
+    SELECT user_id FROM posts WHERE privacy = 2
+);
+
+INSERT INTO audience_list_members (list_id, member_id, created_at)
+SELECT l.id, cf.close_friend_id, cf.created_at
+FROM close_friends cf
+JOIN audience_lists l ON l.user_id = cf.user_id AND l.is_close_friends;
+
+INSERT INTO post_audiences (post_id, list_id)
+SELECT p.id, l.id
+FROM posts p
+JOIN audience_lists l ON l.user_id = p.user_id AND l.is_close_friends
+WHERE p.privacy = 2;
+
+DROP TABLE IF EXISTS close_friends;
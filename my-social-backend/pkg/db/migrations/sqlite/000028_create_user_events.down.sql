@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_events_created_at;
+DROP TABLE IF EXISTS user_events;
+DROP TABLE IF EXISTS user_event_counters;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_event_counters (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    last_seq INTEGER NOT NULL DEFAULT 0,
+    acked_seq INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_events (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    seq INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    data TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
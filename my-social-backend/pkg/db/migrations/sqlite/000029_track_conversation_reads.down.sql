@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_private_messages_pair;
+DROP INDEX IF EXISTS idx_conversations_user2;
+DROP INDEX IF EXISTS idx_conversations_user1;
+ALTER TABLE conversations DROP COLUMN user2_last_read_id;
+ALTER TABLE conversations DROP COLUMN user1_last_read_id;
+ALTER TABLE conversations DROP COLUMN user2_unread_count;
+ALTER TABLE conversations DROP COLUMN user1_unread_count;
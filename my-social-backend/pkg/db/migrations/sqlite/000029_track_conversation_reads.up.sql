@@ -0,0 +1,38 @@
+ALTER TABLE conversations ADD COLUMN user1_unread_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversations ADD COLUMN user2_unread_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversations ADD COLUMN user1_last_read_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversations ADD COLUMN user2_last_read_id INTEGER NOT NULL DEFAULT 0;
+
+-- Fill the counters in from the messages already sent, the same way
+-- MessagingService.BackfillConversations does
+INSERT INTO conversations (user1_id, user2_id, last_message_id, updated_at)
+SELECT MIN(sender_id, receiver_id), MAX(sender_id, receiver_id), MAX(id), MAX(created_at)
+FROM private_messages
+WHERE sender_id != receiver_id
+GROUP BY MIN(sender_id, receiver_id), MAX(sender_id, receiver_id)
+ON CONFLICT(user1_id, user2_id) DO UPDATE SET
+last_message_id = excluded.last_message_id,
+updated_at = excluded.updated_at;
+
+UPDATE conversations SET
+user1_unread_count = (
+    SELECT COUNT(*) FROM private_messages
+    WHERE sender_id = conversations.user2_id AND receiver_id = conversations.user1_id AND is_read = FALSE
+),
+user2_unread_count = (
+    SELECT COUNT(*) FROM private_messages
+    WHERE sender_id = conversations.user1_id AND receiver_id = conversations.user2_id AND is_read = FALSE
+),
+user1_last_read_id = (
+    SELECT COALESCE(MAX(id), 0) FROM private_messages
+    WHERE sender_id = conversations.user2_id AND receiver_id = conversations.user1_id AND is_read = TRUE
+),
+user2_last_read_id = (
+    SELECT COALESCE(MAX(id), 0) FROM private_messages
+    WHERE sender_id = conversations.user1_id AND receiver_id = conversations.user2_id AND is_read = TRUE
+);
+
+-- Conversation lists are paged by last message, newest first
+CREATE INDEX IF NOT EXISTS idx_conversations_user1 ON conversations(user1_id, last_message_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_user2 ON conversations(user2_id, last_message_id);
+CREATE INDEX IF NOT EXISTS idx_private_messages_pair ON private_messages(sender_id, receiver_id, is_read);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN read_receipts;
+ALTER TABLE private_messages DROP COLUMN read_at;
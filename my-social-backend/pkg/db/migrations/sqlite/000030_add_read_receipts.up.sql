@@ -0,0 +1,2 @@
+ALTER TABLE private_messages ADD COLUMN read_at DATETIME;
+ALTER TABLE users ADD COLUMN read_receipts BOOLEAN NOT NULL DEFAULT TRUE;
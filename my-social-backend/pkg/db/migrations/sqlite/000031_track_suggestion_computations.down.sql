@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN suggestions_computed_at;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN suggestions_computed_at DATETIME;
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+const migrationsPath = "../migrations/sqlite"
+
+// migrateTo brings db to version, up or down.
+func migrateTo(t *testing.T, db *sql.DB, version uint) {
+	t.Helper()
+	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://"+migrationsPath, "sqlite3", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Migrate(version); err != nil {
+		t.Fatalf("migrating to %d: %v", version, err)
+	}
+}
+
+// Upgrading a database with messages in it fills the conversation counters in.
+func TestConversationCountersBackfilled(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrateTo(t, db, 28)
+
+	for _, name := range []string{"ann", "ben", "cat"} {
+		_, err := db.Exec("INSERT INTO users (username, password, email) VALUES (?, 'x', ?)", name, name+"@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ann (1) and ben (2) talked and ben read ann's first message; cat (3) wrote to
+	// ann, who read nothing. Only the ann/ben conversation had a row.
+	messages := []struct {
+		from, to int64
+		read     bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{1, 2, false},
+		{1, 2, false},
+		{3, 1, false},
+		{3, 1, false},
+	}
+	for _, m := range messages {
+		if _, err := db.Exec("INSERT INTO private_messages (sender_id, receiver_id, content, is_read) VALUES (?, ?, 'hi', ?)", m.from, m.to, m.read); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO conversations (user1_id, user2_id, last_message_id) VALUES (1, 2, 2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	migrateTo(t, db, 29)
+
+	tests := []struct {
+		user1, user2             int64
+		lastMessageID            int64
+		unread1, unread2         int
+		lastRead1ID, lastRead2ID int64
+	}{
+		{1, 2, 4, 1, 2, 0, 1},
+		{1, 3, 6, 2, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		var lastMessageID, lastRead1ID, lastRead2ID int64
+		var unread1, unread2 int
+		err := db.QueryRow(`
+			SELECT last_message_id, user1_unread_count, user2_unread_count, user1_last_read_id, user2_last_read_id
+			FROM conversations WHERE user1_id = ? AND user2_id = ?
+		`, tt.user1, tt.user2).Scan(&lastMessageID, &unread1, &unread2, &lastRead1ID, &lastRead2ID)
+		if err != nil {
+			t.Errorf("conversation %d/%d: %v", tt.user1, tt.user2, err)
+			continue
+		}
+		if lastMessageID != tt.lastMessageID || unread1 != tt.unread1 || unread2 != tt.unread2 || lastRead1ID != tt.lastRead1ID || lastRead2ID != tt.lastRead2ID {
+			t.Errorf("conversation %d/%d: last message %d, unread %d/%d, last read %d/%d; want %d, %d/%d, %d/%d",
+				tt.user1, tt.user2, lastMessageID, unread1, unread2, lastRead1ID, lastRead2ID,
+				tt.lastMessageID, tt.unread1, tt.unread2, tt.lastRead1ID, tt.lastRead2ID)
+		}
+	}
+}
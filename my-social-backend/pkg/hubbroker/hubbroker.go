@@ -0,0 +1,208 @@
+// Package hubbroker is a stand-in for Redis that implements just the commands the
+// realtime hub uses, in memory. cmd/hubbroker serves it for running several
+// backend instances locally, and tests use it to exercise the redis hub.
+//
+// It is not meant for production: nothing is persisted and AUTH accepts anything.
+package hubbroker
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reda-social-network/pkg/resp"
+)
+
+// Broker is an in-memory server for the commands the hub uses: PING, AUTH, the
+// hash commands, DEL, EXPIRE, PUBLISH and SUBSCRIBE.
+type Broker struct {
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	expireAt map[string]time.Time
+	subs     map[string]map[*subscriber]struct{}
+}
+
+// subscriber is a connection in subscribe mode. Published messages are written
+// by the publisher, under mu.
+type subscriber struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (s *subscriber) send(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := resp.WriteValue(s.w, v); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// hash returns the hash stored under key, dropping it first if it expired.
+func (b *Broker) hash(key string) map[string]string {
+	if at, ok := b.expireAt[key]; ok && time.Now().After(at) {
+		delete(b.hashes, key)
+		delete(b.expireAt, key)
+	}
+	return b.hashes[key]
+}
+
+func (b *Broker) exec(args []string, sub *subscriber) interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+	arity := map[string]int{"PING": 0, "AUTH": 1, "HSET": 3, "HDEL": 2, "HGETALL": 1, "HKEYS": 1,
+		"HEXISTS": 2, "DEL": 1, "EXPIRE": 2, "PUBLISH": 2, "SUBSCRIBE": 1}
+	want, known := arity[cmd]
+	if !known {
+		return resp.Error("ERR unknown command '" + cmd + "'")
+	}
+	if len(args) < want {
+		return resp.Error("ERR wrong number of arguments for '" + cmd + "'")
+	}
+
+	switch cmd {
+	case "PING":
+		return resp.SimpleString("PONG")
+	case "AUTH":
+		return resp.SimpleString("OK")
+	case "HSET":
+		if len(args)%2 != 1 {
+			return resp.Error("ERR wrong number of arguments for 'HSET'")
+		}
+		h := b.hash(args[0])
+		if h == nil {
+			h = make(map[string]string)
+			b.hashes[args[0]] = h
+		}
+		added := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, exists := h[args[i]]; !exists {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return added
+	case "HDEL":
+		h := b.hash(args[0])
+		removed := 0
+		for _, field := range args[1:] {
+			if _, exists := h[field]; exists {
+				delete(h, field)
+				removed++
+			}
+		}
+		if h != nil && len(h) == 0 {
+			delete(b.hashes, args[0])
+			delete(b.expireAt, args[0])
+		}
+		return removed
+	case "HGETALL", "HKEYS":
+		values := []interface{}{}
+		for field, value := range b.hash(args[0]) {
+			values = append(values, field)
+			if cmd == "HGETALL" {
+				values = append(values, value)
+			}
+		}
+		return values
+	case "HEXISTS":
+		if _, exists := b.hash(args[0])[args[1]]; exists {
+			return 1
+		}
+		return 0
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			if b.hash(key) != nil {
+				deleted++
+			}
+			delete(b.hashes, key)
+			delete(b.expireAt, key)
+		}
+		return deleted
+	case "EXPIRE":
+		seconds, err := strconv.Atoi(args[1])
+		if err != nil {
+			return resp.Error("ERR value is not an integer or out of range")
+		}
+		if b.hash(args[0]) == nil {
+			return 0
+		}
+		b.expireAt[args[0]] = time.Now().Add(time.Duration(seconds) * time.Second)
+		return 1
+	case "PUBLISH":
+		message := []interface{}{"message", args[0], args[1]}
+		received := 0
+		for s := range b.subs[args[0]] {
+			if s.send(message) == nil {
+				received++
+			}
+		}
+		return received
+	case "SUBSCRIBE":
+		for _, channel := range args {
+			if b.subs[channel] == nil {
+				b.subs[channel] = make(map[*subscriber]struct{})
+			}
+			b.subs[channel][sub] = struct{}{}
+		}
+		return []interface{}{"subscribe", args[len(args)-1], len(args)}
+	}
+	return resp.Error("ERR unknown command '" + cmd + "'")
+}
+
+func (b *Broker) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	sub := &subscriber{w: bufio.NewWriter(conn)}
+	defer func() {
+		b.mu.Lock()
+		for _, subs := range b.subs {
+			delete(subs, sub)
+		}
+		b.mu.Unlock()
+	}()
+
+	for {
+		cmd, err := resp.Strings(resp.ReadValue(r))
+		if err != nil || len(cmd) == 0 {
+			return
+		}
+		if err := sub.send(b.exec(cmd, sub)); err != nil {
+			return
+		}
+	}
+}
+
+// New returns an empty broker.
+func New() *Broker {
+	return &Broker{
+		hashes:   make(map[string]map[string]string),
+		expireAt: make(map[string]time.Time),
+		subs:     make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// Serve accepts connections on l and serves each until it closes. It returns
+// once l is closed.
+func (b *Broker) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			log.Printf("accept: %v", err)
+			continue
+		}
+		go b.serveConn(conn)
+	}
+}
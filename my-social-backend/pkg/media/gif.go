@@ -0,0 +1,50 @@
+package media
+
+// gifFrameCount counts the frames of a GIF by walking its blocks, without
+// decoding any image data. It stops counting past max (when max > 0), and at the
+// end of data or the trailer. Malformed files are left to the decoder to reject.
+func gifFrameCount(data []byte, max int) int {
+	// Header (6 bytes) and logical screen descriptor (7 bytes)
+	if len(data) < 13 {
+		return 0
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1) // global color table
+	}
+
+	// skipSubBlocks moves i past a chain of data sub-blocks
+	skipSubBlocks := func() {
+		for i < len(data) {
+			n := int(data[i])
+			i += 1 + n
+			if n == 0 {
+				return
+			}
+		}
+	}
+
+	frames := 0
+	for i < len(data) && (max <= 0 || frames <= max) {
+		switch data[i] {
+		case 0x21: // extension: introducer, label, sub-blocks
+			i += 2
+			skipSubBlocks()
+		case 0x2C: // image descriptor (10 bytes), color table, LZW code size, sub-blocks
+			if i+10 > len(data) {
+				return frames
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+			skipSubBlocks()
+			frames++
+		default: // trailer, or not a block
+			return frames
+		}
+	}
+	return frames
+}
@@ -0,0 +1,192 @@
+// Package media validates uploaded images and produces clean, resized copies of them.
+//
+// Uploads are identified by their content rather than the client's Content-Type or
+// file name, fully decoded, and re-encoded from pixels only, which drops EXIF (GPS,
+// camera serials), comments and any other embedded metadata.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	_ "golang.org/x/image/webp" // registers the WebP decoder with image.Decode
+)
+
+// Errors returned by Process. Callers map them to client errors.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format: only JPEG, PNG, GIF and WebP are allowed")
+	ErrTooLarge          = errors.New("image file is too large")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+	ErrTooManyFrames     = errors.New("animated image has too many frames")
+	ErrInvalidImage      = errors.New("file is not a valid image")
+)
+
+// jpegQuality is used for re-encoded JPEG originals and variants.
+const jpegQuality = 85
+
+// Limits bound the work done for a single upload.
+type Limits struct {
+	MaxBytes  int64 // largest accepted upload, in bytes
+	MaxPixels int   // largest accepted width*height
+	// Animated GIFs decode every frame at the full image size
+	MaxFrames      int // most frames accepted in a GIF
+	MaxTotalPixels int // largest accepted frames*width*height of a GIF
+}
+
+// VariantSpec describes a resized copy to generate. Images are scaled down to fit
+// within MaxSize x MaxSize; smaller images keep their size.
+type VariantSpec struct {
+	Name    string
+	MaxSize int
+}
+
+// Image is an encoded image ready to be stored.
+type Image struct {
+	Data     []byte
+	MimeType string
+	Ext      string // file extension including the dot
+	Width    int
+	Height   int
+}
+
+// Variant is a generated resized copy of an upload.
+type Variant struct {
+	Name string
+	Image
+}
+
+// Processed is the result of processing an upload.
+type Processed struct {
+	Image
+	Hash     string // hex SHA-256 of the re-encoded original
+	Variants []Variant
+}
+
+// Sniff identifies an image by its magic bytes and returns its MIME type.
+func Sniff(data []byte) (string, error) {
+	switch mimeType := http.DetectContentType(data); mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return mimeType, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Process validates an uploaded image, strips its metadata by re-encoding it and
+// generates the requested variants.
+func Process(data []byte, limits Limits, specs []VariantSpec) (*Processed, error) {
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	mimeType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions from the header before allocating the full bitmap
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if limits.MaxPixels > 0 && config.Width*config.Height > limits.MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	var original Image
+	var base image.Image
+	switch mimeType {
+	case "image/gif":
+		// Count the frames before decoding them all; a small file can hold
+		// thousands of frames
+		frames := gifFrameCount(data, limits.MaxFrames)
+		if limits.MaxFrames > 0 && frames > limits.MaxFrames {
+			return nil, ErrTooManyFrames
+		}
+		if limits.MaxTotalPixels > 0 && int64(frames)*int64(config.Width)*int64(config.Height) > int64(limits.MaxTotalPixels) {
+			return nil, ErrTooManyPixels
+		}
+
+		// Keep animations: every frame is decoded and written back without extensions
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return nil, ErrInvalidImage
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		original = Image{Data: buf.Bytes(), MimeType: "image/gif", Ext: ".gif", Width: config.Width, Height: config.Height}
+		base = anim.Image[0]
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if mimeType == "image/jpeg" {
+			// The orientation lives in the EXIF data we are about to drop, so bake it in
+			img = applyOrientation(img, jpegOrientation(data))
+		}
+		original, err = encode(img, storedType(mimeType))
+		if err != nil {
+			return nil, err
+		}
+		base = img
+	}
+
+	sum := sha256.Sum256(original.Data)
+	processed := &Processed{Image: original, Hash: hex.EncodeToString(sum[:])}
+
+	// Variants of GIFs are still images, so they are stored as PNG
+	variantType := storedType(mimeType)
+	if variantType == "image/gif" {
+		variantType = "image/png"
+	}
+	for _, spec := range specs {
+		encoded, err := encode(Resize(base, spec.MaxSize), variantType)
+		if err != nil {
+			return nil, err
+		}
+		processed.Variants = append(processed.Variants, Variant{Name: spec.Name, Image: encoded})
+	}
+	return processed, nil
+}
+
+// storedType is the format an upload of mimeType is re-encoded to. There is no
+// WebP encoder in the standard library, so WebP (which may have an alpha
+// channel) is stored as PNG.
+func storedType(mimeType string) string {
+	if mimeType == "image/webp" {
+		return "image/png"
+	}
+	return mimeType
+}
+
+// encode writes img as JPEG or PNG.
+func encode(img image.Image, mimeType string) (Image, error) {
+	var buf bytes.Buffer
+	result := Image{MimeType: mimeType, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	switch mimeType {
+	case "image/jpeg":
+		result.Ext = ".jpg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return result, err
+		}
+	case "image/png":
+		result.Ext = ".png"
+		if err := png.Encode(&buf, img); err != nil {
+			return result, err
+		}
+	default:
+		return result, ErrUnsupportedFormat
+	}
+	result.Data = buf.Bytes()
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage is a w x h white image with a red 8x8 block in its top left corner,
+// so rotations can be told apart (even after JPEG compression).
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	for y := 0; y < 8 && y < h; y++ {
+		for x := 0; x < 8 && x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeGIF returns an animation of frames w x h frames.
+func encodeGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment with the given orientation after the
+// JPEG's start of image marker.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")  // big endian, first IFD at 8
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one entry
+	tiff = binary.BigEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1) // count
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)       // value padding
+	tiff = append(tiff, 0, 0, 0, 0) // no next IFD
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+	return append(out, jpg[2:]...)
+}
+
+// A 1x1 lossless WebP; the standard library can't write WebP.
+const webp1x1 = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+func TestSniff(t *testing.T) {
+	webp, _ := base64.StdEncoding.DecodeString(webp1x1)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{"jpeg", encodeJPEG(t, testImage(2, 2)), "image/jpeg", nil},
+		{"png", encodePNG(t, testImage(2, 2)), "image/png", nil},
+		{"gif", encodeGIF(t, 2, 2, 1), "image/gif", nil},
+		{"webp", webp, "image/webp", nil},
+		{"text", []byte("hello, world"), "", ErrUnsupportedFormat},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "", ErrUnsupportedFormat},
+		{"empty", nil, "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.data)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("Sniff = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestProcessLimits(t *testing.T) {
+	png100 := encodePNG(t, testImage(100, 100))
+	gif5 := encodeGIF(t, 10, 10, 5)
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		err    error
+	}{
+		{"within limits", png100, Limits{MaxBytes: int64(len(png100)), MaxPixels: 100 * 100}, nil},
+		{"too many bytes", png100, Limits{MaxBytes: int64(len(png100)) - 1}, ErrTooLarge},
+		{"too many pixels", png100, Limits{MaxPixels: 100*100 - 1}, ErrTooManyPixels},
+		{"not an image", []byte("GIF89a but not really"), Limits{}, ErrInvalidImage},
+		{"gif within limits", gif5, Limits{MaxPixels: 100, MaxFrames: 5, MaxTotalPixels: 500}, nil},
+		{"gif with too many frames", gif5, Limits{MaxFrames: 4}, ErrTooManyFrames},
+		// Each frame is small enough, all of them together are not
+		{"gif with too many pixels in all", gif5, Limits{MaxPixels: 100, MaxTotalPixels: 499}, ErrTooManyPixels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(tt.data, tt.limits, nil)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Process: got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	for _, frames := range []int{1, 3, 40} {
+		data := encodeGIF(t, 4, 3, frames)
+		if got := gifFrameCount(data, 0); got != frames {
+			t.Errorf("%d frames: counted %d", frames, got)
+		}
+		if got := gifFrameCount(data, 2); frames > 2 && got != 3 {
+			t.Errorf("%d frames with a max of 2: counted %d, want to stop at 3", frames, got)
+		}
+	}
+	if got := gifFrameCount([]byte("GIF89a"), 0); got != 0 {
+		t.Errorf("truncated GIF: counted %d frames", got)
+	}
+}
+
+func TestProcessKeepsAnimation(t *testing.T) {
+	processed, err := Process(encodeGIF(t, 10, 10, 3), Limits{}, []VariantSpec{{Name: "thumbnail", MaxSize: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(processed.Data))
+	if err != nil || len(anim.Image) != 3 {
+		t.Fatalf("stored GIF has %d frame(s) (%v), want 3", len(anim.Image), err)
+	}
+	if v := processed.Variants[0]; v.MimeType != "image/png" || v.Width != 5 {
+		t.Errorf("GIF variant is %s %dx%d, want a 5x5 PNG", v.MimeType, v.Width, v.Height)
+	}
+}
+
+func TestProcessAppliesEXIFOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, testImage(40, 20))
+	tests := []struct {
+		orientation uint16
+		w, h        int
+		redX, redY  int // a pixel inside where the red block ends up
+	}{
+		{1, 40, 20, 2, 2},
+		{3, 40, 20, 37, 17}, // rotated 180°
+		{6, 20, 40, 17, 2},  // rotated 90° clockwise
+		{8, 20, 40, 2, 37},  // rotated 90° counterclockwise
+	}
+	for _, tt := range tests {
+		processed, err := Process(withOrientation(jpg, tt.orientation), Limits{}, nil)
+		if err != nil {
+			t.Fatalf("orientation %d: %v", tt.orientation, err)
+		}
+		if processed.Width != tt.w || processed.Height != tt.h {
+			t.Errorf("orientation %d: got %dx%d, want %dx%d", tt.orientation, processed.Width, processed.Height, tt.w, tt.h)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(processed.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, g, _, _ := img.At(tt.redX, tt.redY).RGBA(); r < 0xc000 || g > 0x4000 {
+			t.Errorf("orientation %d: pixel (%d, %d) is not red", tt.orientation, tt.redX, tt.redY)
+		}
+		if bytes.Contains(processed.Data, []byte("Exif")) {
+			t.Errorf("orientation %d: the EXIF data was kept", tt.orientation)
+		}
+	}
+}
+
+func TestProcessVariantSizes(t *testing.T) {
+	webp, _ := base64.StdEncoding.DecodeString(webp1x1)
+	specs := []VariantSpec{{Name: "thumbnail", MaxSize: 100}, {Name: "medium", MaxSize: 1000}}
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		sizes    [][2]int // per spec
+	}{
+		{"landscape png", encodePNG(t, testImage(400, 200)), "image/png", [][2]int{{100, 50}, {400, 200}}},
+		{"portrait jpeg", encodeJPEG(t, testImage(150, 300)), "image/jpeg", [][2]int{{50, 100}, {150, 300}}},
+		{"webp stored as png", webp, "image/png", [][2]int{{1, 1}, {1, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := Process(tt.data, Limits{}, specs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if processed.MimeType != tt.mimeType {
+				t.Errorf("original stored as %s, want %s", processed.MimeType, tt.mimeType)
+			}
+			if len(processed.Variants) != len(specs) {
+				t.Fatalf("got %d variants, want %d", len(processed.Variants), len(specs))
+			}
+			for i, v := range processed.Variants {
+				if v.Name != specs[i].Name || v.Width != tt.sizes[i][0] || v.Height != tt.sizes[i][1] || v.MimeType != tt.mimeType {
+					t.Errorf("variant %d: %s %s %dx%d, want %s %s %dx%d", i, v.Name, v.MimeType, v.Width, v.Height,
+						specs[i].Name, tt.mimeType, tt.sizes[i][0], tt.sizes[i][1])
+				}
+				cfg, _, err := image.DecodeConfig(bytes.NewReader(v.Data))
+				if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+					t.Errorf("variant %d decodes to %dx%d (%v)", i, cfg.Width, cfg.Height, err)
+				}
+			}
+		})
+	}
+}
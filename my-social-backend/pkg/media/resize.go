@@ -0,0 +1,78 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+// FitWithin returns the size of a width x height image scaled down to fit within
+// maxSize x maxSize, keeping its aspect ratio. Smaller images keep their size.
+func FitWithin(width, height, maxSize int) (int, int) {
+	if maxSize <= 0 || (width <= maxSize && height <= maxSize) {
+		return width, height
+	}
+	if width >= height {
+		h := height * maxSize / width
+		if h < 1 {
+			h = 1
+		}
+		return maxSize, h
+	}
+	w := width * maxSize / height
+	if w < 1 {
+		w = 1
+	}
+	return w, maxSize
+}
+
+// Resize scales img down to fit within maxSize x maxSize using a box filter, which
+// averages every source pixel into the destination pixel covering it.
+func Resize(img image.Image, maxSize int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := FitWithin(sw, sh, maxSize)
+	if dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			q := dst.Pix[dy*dst.Stride+dx*4:]
+			q[0], q[1], q[2], q[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// toRGBA returns img as a zero-origin *image.RGBA, converting it if needed.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
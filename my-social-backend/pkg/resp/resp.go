@@ -0,0 +1,293 @@
+// Package resp is a small client for servers that speak the Redis serialization
+// protocol (RESP2): Redis, Valkey, KeyDB and the like. It covers what the realtime
+// hub needs, plain commands and a subscription, and nothing more.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the server, such as "ERR unknown command".
+type Error string
+
+func (e Error) Error() string { return "resp: " + string(e) }
+
+// SimpleString is a status reply such as "OK" or "PONG". Bulk strings are
+// returned as string.
+type SimpleString string
+
+// dialTimeout and ioTimeout bound connecting and each command's round trip.
+const (
+	dialTimeout = 5 * time.Second
+	ioTimeout   = 5 * time.Second
+)
+
+// Client runs commands over a single connection, one at a time. The connection
+// is opened on first use and reopened after a network error.
+type Client struct {
+	addr     string
+	password string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewClient returns a client for the server at addr (host:port). password may be
+// empty.
+func NewClient(addr, password string) *Client {
+	return &Client{addr: addr, password: password}
+}
+
+func (c *Client) dial() (net.Conn, *bufio.Reader, *bufio.Writer, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, dialTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	if c.password != "" {
+		conn.SetDeadline(time.Now().Add(ioTimeout))
+		if _, err := roundTrip(r, w, []string{"AUTH", c.password}); err != nil {
+			conn.Close()
+			return nil, nil, nil, err
+		}
+	}
+	return conn, r, w, nil
+}
+
+// Do runs one command and returns its reply: a SimpleString, string, int64,
+// []interface{} or nil. An error reply is returned as an Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, r, w, err := c.dial()
+		if err != nil {
+			return nil, err
+		}
+		c.conn, c.r, c.w = conn, r, w
+	}
+	c.conn.SetDeadline(time.Now().Add(ioTimeout))
+	reply, err := roundTrip(c.r, c.w, args)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state; start over next time
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// Close closes the client's connection. The client can still be used; the next
+// command reconnects.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Subscribe opens a dedicated connection, subscribes to channel and calls handle
+// with every message published to it. It blocks until the connection fails or
+// stop is closed, and returns the error (nil after stop).
+func (c *Client) Subscribe(channel string, stop <-chan struct{}, handle func(payload []byte)) error {
+	conn, r, w, err := c.dial()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	if _, err := roundTrip(r, w, []string{"SUBSCRIBE", channel}); err != nil {
+		return err
+	}
+	// Messages arrive whenever they are published; only the stop signal or a
+	// broken connection ends the wait
+	conn.SetDeadline(time.Time{})
+	for {
+		reply, err := ReadValue(r)
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		if kind, _ := parts[0].(string); kind != "message" {
+			continue
+		}
+		if payload, ok := parts[2].(string); ok {
+			handle([]byte(payload))
+		}
+	}
+}
+
+func roundTrip(r *bufio.Reader, w *bufio.Writer, args []string) (interface{}, error) {
+	if err := WriteCommand(w, args); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := ReadValue(r)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(Error); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// WriteCommand writes args as a RESP command (an array of bulk strings).
+func WriteCommand(w *bufio.Writer, args []string) error {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return WriteValue(w, values)
+}
+
+// WriteValue writes v in RESP: a SimpleString as a status, an Error as an error
+// reply, a string as a bulk string, an int or int64 as an integer, nil as a null
+// bulk string and a []interface{} as an array of any of these.
+func WriteValue(w *bufio.Writer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case SimpleString:
+		_, err = w.WriteString("+" + string(v) + "\r\n")
+	case Error:
+		_, err = w.WriteString("-" + string(v) + "\r\n")
+	case string:
+		_, err = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case int:
+		_, err = w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		_, err = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case nil:
+		_, err = w.WriteString("$-1\r\n")
+	case []interface{}:
+		if _, err = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n"); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err = WriteValue(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		err = fmt.Errorf("resp: cannot write %T", v)
+	}
+	return err
+}
+
+// ReadValue reads one RESP value; see Client.Do for the Go types returned.
+func ReadValue(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("resp: malformed line %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return SimpleString(body), nil
+	case '-':
+		return Error(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("resp: bad bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("resp: bad array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = ReadValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("resp: unknown reply type %q", kind)
+}
+
+// Strings converts an array reply of bulk strings, as returned by HGETALL, to
+// a []string.
+func Strings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		if reply == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("resp: expected an array, got %T", reply)
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("resp: expected a string, got %T", v)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// Int converts an integer reply, as returned by HEXISTS, to an int64.
+func Int(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("resp: expected an integer, got %T", reply)
+	}
+	return n, nil
+}
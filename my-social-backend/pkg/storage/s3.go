@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"reda-social-network/config"
+)
+
+// S3Store keeps media in a bucket of an S3-compatible service (AWS S3, MinIO, ...).
+// Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	cfg       config.S3Config
+	endpoint  *url.URL
+	urlPrefix string
+	publicURL string // prefix of the URLs of objects in PublicDirs, or ""
+	client    *http.Client
+}
+
+// NewS3Store returns a store for cfg.Bucket. URLs start with urlPrefix, so objects are
+// served through the backend, except those in PublicDirs when cfg.PublicURL is set:
+// clients fetch those from cfg.PublicURL directly.
+func NewS3Store(cfg config.S3Config, urlPrefix string) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("storage: the s3 backend needs an endpoint, bucket, access key and secret key")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	store := &S3Store{cfg: cfg, endpoint: endpoint, urlPrefix: urlPrefix, client: &http.Client{Timeout: 60 * time.Second}}
+	if cfg.PublicURL != "" {
+		store.publicURL = strings.TrimSuffix(cfg.PublicURL, "/") + "/"
+	}
+	return store, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(body)) != size {
+		return fmt.Errorf("storage: read %d bytes for %s, expected %d", len(body), key, size)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError("PUT", key, resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, s.responseError("GET", key, resp)
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{
+		Body: resp.Body,
+		ObjectInfo: ObjectInfo{
+			Size:        size,
+			ContentType: resp.Header.Get("Content-Type"),
+			ModTime:     modTime,
+			ETag:        resp.Header.Get("ETag"),
+		},
+	}, nil
+}
+
+// Delete succeeds for missing keys too. S3 itself does not report them, but some
+// compatible stores answer 404.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		return s.responseError("DELETE", key, resp)
+	}
+}
+
+func (s *S3Store) URL(key string) string {
+	if s.publicURL != "" {
+		for _, dir := range PublicDirs {
+			if strings.HasPrefix(key, dir+"/") {
+				return s.publicURL + key
+			}
+		}
+	}
+	return s.urlPrefix + key
+}
+
+// objectURL addresses key path-style (endpoint/bucket/key, as MinIO expects) or
+// virtual-hosted style (bucket.endpoint/key).
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escaped := escapePath(key)
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+		u.RawPath = "/" + escapePath(s.cfg.Bucket) + "/" + escaped
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escaped
+	}
+	return &u
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	target := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, target, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3Store) sign(req *http.Request, target *url.URL, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + target.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		target.EscapedPath(),
+		"", // no query string
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	signingKey = hmacSHA256(signingKey, s.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func (s *S3Store) responseError(op, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("storage: s3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// escapePath URI-encodes a key as SigV4 requires: everything except unreserved
+// characters (RFC 3986) and the slashes between segments.
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
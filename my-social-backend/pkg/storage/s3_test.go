@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"reda-social-network/config"
+)
+
+const (
+	testBucket    = "media"
+	testAccessKey = "test-access"
+	testSecretKey = "test-secret"
+	testRegion    = "eu-test-1"
+)
+
+// fakeS3 is a minimal path-style S3 service, like a local MinIO: it checks the
+// Signature Version 4 of every request and keeps objects in memory.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	fake := &fakeS3{t: t, objects: make(map[string]fakeObject)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if msg := f.checkSignature(r, body); msg != "" {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>"+msg+"</Message></Error>", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok || key == "" {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+		w.Header().Set("ETag", etag(body))
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", etag(obj.data))
+		w.Write(obj.data)
+	case http.MethodDelete:
+		// Like S3, deleting a missing key succeeds
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// checkSignature verifies the request the way S3 does, from what arrived on the
+// wire, and returns why it doesn't match (or "").
+func (f *fakeS3) checkSignature(r *http.Request, body []byte) string {
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			fields[name] = value
+		}
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != testAccessKey || credential[2] != testRegion {
+		return "bad credential " + fields["Credential"]
+	}
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != sha256Hex(body) {
+		return "payload hash mismatch"
+	}
+
+	amzDate, day := r.Header.Get("X-Amz-Date"), credential[1]
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host + "\nx-amz-content-sha256:" + sha256Hex(body) + "\nx-amz-date:" + amzDate + "\n",
+		fields["SignedHeaders"],
+		sha256Hex(body),
+	}, "\n")
+	scope := day + "/" + testRegion + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), day)
+	for _, part := range []string{testRegion, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != want {
+		return "signature mismatch"
+	}
+	return ""
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func newTestS3Store(t *testing.T, endpoint string, cfg config.S3Config) *S3Store {
+	t.Helper()
+	cfg.Endpoint = endpoint
+	cfg.Bucket = testBucket
+	cfg.Region = testRegion
+	cfg.AccessKey = testAccessKey
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = testSecretKey
+	}
+	cfg.PathStyle = true
+	store, err := NewS3Store(cfg, "/media/")
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL, config.S3Config{})
+	ctx := context.Background()
+
+	// The space and plus need escaping, which the signature covers
+	key := "posts/summer photo+1.jpg"
+	data := []byte("not really a jpeg")
+	if err := store.Put(ctx, key, strings.NewReader(string(data)), int64(len(data)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		t.Fatalf("reading object: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Get returned %q, want %q", got, data)
+	}
+	if obj.Size != int64(len(data)) || obj.ContentType != "image/jpeg" || obj.ETag != etag(data) || obj.ModTime.IsZero() {
+		t.Errorf("Get returned info %+v", obj.ObjectInfo)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+// Some S3-compatible stores answer 404 for a missing key, which is still deleted.
+func TestS3StoreDeleteNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	store := newTestS3Store(t, srv.URL, config.S3Config{})
+	if err := store.Delete(context.Background(), "posts/missing.jpg"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+}
+
+func TestS3StorePutChecksSize(t *testing.T) {
+	srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL, config.S3Config{})
+	if err := store.Put(context.Background(), "posts/a.png", strings.NewReader("abc"), 10, "image/png"); err == nil {
+		t.Error("Put with a short body succeeded")
+	}
+}
+
+func TestS3StoreRejectedCredentials(t *testing.T) {
+	srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL, config.S3Config{SecretKey: "wrong-secret"})
+	err := store.Put(context.Background(), "posts/a.png", strings.NewReader("abc"), 3, "image/png")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with a wrong secret: got %v, want a 403 error", err)
+	}
+}
+
+func TestS3StoreInvalidKey(t *testing.T) {
+	srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL, config.S3Config{})
+	for _, key := range []string{"", "../etc/passwd", "posts/../../x"} {
+		if _, err := store.Get(context.Background(), key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): got %v, want an invalid key error", key, err)
+		}
+	}
+}
+
+func TestS3StoreURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicURL string
+		key       string
+		want      string
+	}{
+		{"served by the backend", "", "avatars/a.png", "/media/avatars/a.png"},
+		{"public bucket URL", "https://cdn.example.com/media", "avatars/a.png", "https://cdn.example.com/media/avatars/a.png"},
+		{"public bucket URL with slash", "https://cdn.example.com/", "avatars/b.jpg", "https://cdn.example.com/avatars/b.jpg"},
+		// Post media is only served after checking who may see it
+		{"post media with a public bucket URL", "https://cdn.example.com/media", "posts/b.jpg", "/media/posts/b.jpg"},
+		{"post media served by the backend", "", "posts/b.jpg", "/media/posts/b.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestS3Store(t, "http://localhost:9000", config.S3Config{PublicURL: tt.publicURL})
+			url := store.URL(tt.key)
+			if url != tt.want {
+				t.Errorf("URL(%q) = %q, want %q", tt.key, url, tt.want)
+			}
+			if key := KeyForURL(store, url); key != tt.key {
+				t.Errorf("KeyForURL(%q) = %q, want %q", url, key, tt.key)
+			}
+		})
+	}
+}
+
+func TestS3StoreObjectURL(t *testing.T) {
+	cfg := config.S3Config{Endpoint: "https://s3.example.com", Bucket: "media", AccessKey: "a", SecretKey: "s"}
+	virtual, err := NewS3Store(cfg, "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := virtual.objectURL("posts/a b.jpg").String(); got != "https://media.s3.example.com/posts/a%20b.jpg" {
+		t.Errorf("virtual-hosted objectURL = %q", got)
+	}
+
+	cfg.PathStyle = true
+	pathStyle, err := NewS3Store(cfg, "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pathStyle.objectURL("posts/a b.jpg").String(); got != "https://s3.example.com/media/posts/a%20b.jpg" {
+		t.Errorf("path-style objectURL = %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+// Package storage abstracts where uploaded media is kept. Objects are addressed by
+// slash-separated keys such as "posts/<name>.jpg" or "avatars/<name>.png".
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"reda-social-network/config"
+)
+
+// ErrNotFound is returned by Get when no object exists for a key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+// Object is an opened stored object. Body is an io.ReadSeeker when the backend
+// supports seeking (the local store does).
+type Object struct {
+	Body io.ReadCloser
+	ObjectInfo
+}
+
+// MediaStore stores and retrieves uploaded media.
+type MediaStore interface {
+	// Put stores size bytes from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key. The caller must close its Body.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the object stored under key. Deleting a missing key succeeds.
+	Delete(ctx context.Context, key string) error
+	// URL returns the URL clients use to fetch key. URL("") is the common prefix of
+	// all URLs, except those of objects in PublicDirs, which may be served elsewhere.
+	URL(key string) string
+}
+
+// PublicDirs are the directories anyone may fetch objects from (avatars). A store
+// may point clients straight at them; everything else is served through the
+// backend, which checks who may see it.
+var PublicDirs = []string{"avatars"}
+
+// Media is the store used by the server, set up by InitMediaStore.
+var Media MediaStore
+
+// InitMediaStore creates the media store selected by the configuration.
+func InitMediaStore(cfg config.StorageConfig) error {
+	store, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Media = store
+	return nil
+}
+
+// New creates the media store selected by cfg.Backend.
+func New(cfg config.StorageConfig) (MediaStore, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStore(cfg.LocalDir, cfg.URLPrefix), nil
+	case "s3":
+		return NewS3Store(cfg.S3, cfg.URLPrefix)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q (want \"local\" or \"s3\")", cfg.Backend)
+	}
+}
+
+// KeyForURL returns the key of an object from a URL produced by store.URL, or ""
+// if the URL does not belong to the store.
+func KeyForURL(store MediaStore, url string) string {
+	if url == "" {
+		return ""
+	}
+	for _, dir := range PublicDirs {
+		if prefix := store.URL(dir + "/"); strings.HasPrefix(url, prefix) {
+			return keyAfter(url, prefix, dir+"/")
+		}
+	}
+	return keyAfter(url, store.URL(""), "")
+}
+
+// keyAfter returns keyPrefix followed by what follows prefix in url, if it starts
+// with prefix and that makes a valid key.
+func keyAfter(url, prefix, keyPrefix string) string {
+	if !strings.HasPrefix(url, prefix) {
+		return ""
+	}
+	key, err := cleanKey(keyPrefix + strings.TrimPrefix(url, prefix))
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// cleanKey normalizes a key and rejects keys that could escape the store.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") || strings.Contains(cleaned, "..") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return cleaned, nil
+}
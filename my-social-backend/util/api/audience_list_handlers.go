@@ -0,0 +1,471 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+const (
+	// closeFriendsListName is the name of every user's built-in list.
+	closeFriendsListName      = "Close Friends"
+	maxAudienceListNameLength = 50
+)
+
+// closeFriendsListID returns the ID of userID's built-in close friends list,
+// creating it the first time it is needed.
+func closeFriendsListID(userID int64) (int64, error) {
+	_, err := database.DB.Exec(`
+        INSERT OR IGNORE INTO audience_lists (user_id, name, is_close_friends, created_at)
+        VALUES (?, ?, TRUE, ?)
+    `, userID, closeFriendsListName, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	var listID int64
+	err = database.DB.QueryRow("SELECT id FROM audience_lists WHERE user_id = ? AND is_close_friends", userID).Scan(&listID)
+	return listID, err
+}
+
+// isCloseFriendOf reports whether memberID is on ownerID's close friends list.
+func isCloseFriendOf(ownerID, memberID int64) (bool, error) {
+	var isCloseFriend bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM audience_list_members m
+            JOIN audience_lists l ON l.id = m.list_id
+            WHERE l.user_id = ? AND l.is_close_friends AND m.member_id = ?
+        )
+    `, ownerID, memberID).Scan(&isCloseFriend)
+	return isCloseFriend, err
+}
+
+// resolvePostAudience validates the lists userID wants a privacy 2 post shared
+// with. No lists means the close friends list. On failure it returns the HTTP
+// status and message to send.
+func resolvePostAudience(userID int64, listIDs []int64) ([]int64, int, string) {
+	if len(listIDs) == 0 {
+		listID, err := closeFriendsListID(userID)
+		if err != nil {
+			log.Printf("Error resolving close friends list for user %d: %v", userID, err)
+			return nil, http.StatusInternalServerError, "Failed to resolve post audience"
+		}
+		return []int64{listID}, 0, ""
+	}
+
+	seen := make(map[int64]bool)
+	var resolved []int64
+	for _, listID := range listIDs {
+		if seen[listID] {
+			continue
+		}
+		seen[listID] = true
+		var owned bool
+		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM audience_lists WHERE id = ? AND user_id = ?)", listID, userID).Scan(&owned)
+		if err != nil {
+			log.Printf("Error checking audience list %d for user %d: %v", listID, userID, err)
+			return nil, http.StatusInternalServerError, "Failed to resolve post audience"
+		}
+		if !owned {
+			return nil, http.StatusBadRequest, "audience_list_ids contains a list that isn't yours"
+		}
+		resolved = append(resolved, listID)
+	}
+	return resolved, 0, ""
+}
+
+// setPostAudience records the lists a privacy 2 post is shared with.
+func setPostAudience(tx *sql.Tx, postID int64, listIDs []int64) error {
+	for _, listID := range listIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_audiences (post_id, list_id) VALUES (?, ?)", postID, listID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAudienceMember adds targetID to userID's list. Members must be people the
+// owner follows. label names the list in error messages. On failure it returns the
+// HTTP status and message to send.
+func addAudienceMember(userID, listID, targetID int64, label string) (int, string) {
+	if targetID == userID {
+		return http.StatusBadRequest, "Cannot add yourself to " + label
+	}
+
+	var exists, isFollowing bool
+	err := database.DB.QueryRow(`
+        SELECT
+            EXISTS(SELECT 1 FROM users WHERE id = ?),
+            EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'accept')
+    `, targetID, userID, targetID).Scan(&exists, &isFollowing)
+	if err != nil {
+		return http.StatusInternalServerError, "Database error: " + err.Error()
+	}
+	if !exists {
+		return http.StatusNotFound, "Target user not found"
+	}
+	if !isFollowing {
+		return http.StatusBadRequest, "You must be following this user to add them to " + label
+	}
+
+	result, err := database.DB.Exec(`
+        INSERT OR IGNORE INTO audience_list_members (list_id, member_id, created_at)
+        VALUES (?, ?, ?)
+    `, listID, targetID, time.Now())
+	if err != nil {
+		log.Printf("Error adding user %d to audience list %d: %v", targetID, listID, err)
+		return http.StatusInternalServerError, "Failed to add to " + label
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusConflict, "User is already in " + label
+	}
+	return http.StatusOK, ""
+}
+
+// removeAudienceMember removes memberID from a list. It reports whether they were on it.
+func removeAudienceMember(listID, memberID int64) (bool, error) {
+	result, err := database.DB.Exec("DELETE FROM audience_list_members WHERE list_id = ? AND member_id = ?", listID, memberID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// ownedAudienceList resolves the authenticated user and the list in the path,
+// which they must own. It writes the error response itself and returns ok=false
+// on failure.
+func ownedAudienceList(w http.ResponseWriter, r *http.Request) (userID int64, list models.AudienceListResponse, ok bool) {
+	userID, ok = r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, list, false
+	}
+
+	listID, err := strconv.ParseInt(r.PathValue("listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid list ID in URL path", http.StatusBadRequest)
+		return 0, list, false
+	}
+
+	err = database.DB.QueryRow(`
+        SELECT l.id, l.name, l.is_close_friends, l.created_at,
+               (SELECT COUNT(*) FROM audience_list_members WHERE list_id = l.id)
+        FROM audience_lists l
+        WHERE l.id = ? AND l.user_id = ?
+    `, listID, userID).Scan(&list.ID, &list.Name, &list.IsCloseFriends, &list.CreatedAt, &list.MemberCount)
+	if err == sql.ErrNoRows {
+		http.Error(w, "List not found", http.StatusNotFound)
+		return 0, list, false
+	}
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return 0, list, false
+	}
+	return userID, list, true
+}
+
+// validAudienceListName trims name and checks it. It returns an error message if
+// the name can't be used.
+func validAudienceListName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "List name cannot be empty"
+	}
+	if len(name) > maxAudienceListNameLength {
+		return "", "List name must be at most " + strconv.Itoa(maxAudienceListNameLength) + " characters"
+	}
+	if strings.EqualFold(name, closeFriendsListName) {
+		return "", "That name is reserved for the close friends list"
+	}
+	return name, ""
+}
+
+// GetAudienceListsHandler lists the authenticated user's audience lists, starting
+// with the built-in close friends list.
+// GET /close-friends/lists
+func GetAudienceListsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := closeFriendsListID(userID); err != nil {
+		log.Printf("Error creating close friends list for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch lists", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT l.id, l.name, l.is_close_friends, l.created_at,
+               (SELECT COUNT(*) FROM audience_list_members WHERE list_id = l.id)
+        FROM audience_lists l
+        WHERE l.user_id = ?
+        ORDER BY l.is_close_friends DESC, l.name COLLATE NOCASE ASC
+    `, userID)
+	if err != nil {
+		log.Printf("Error querying audience lists for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch lists", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var lists []models.AudienceListResponse
+	for rows.Next() {
+		var l models.AudienceListResponse
+		if err := rows.Scan(&l.ID, &l.Name, &l.IsCloseFriends, &l.CreatedAt, &l.MemberCount); err != nil {
+			log.Printf("Error scanning audience list for user %d: %v", userID, err)
+			continue
+		}
+		lists = append(lists, l)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating lists: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if lists == nil {
+		lists = []models.AudienceListResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// CreateAudienceListHandler creates a named audience list.
+// POST /close-friends/lists
+func CreateAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.AudienceListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	name, msg := validAudienceListName(req.Name)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	result, err := database.DB.Exec(`
+        INSERT OR IGNORE INTO audience_lists (user_id, name, is_close_friends, created_at)
+        VALUES (?, ?, FALSE, ?)
+    `, userID, name, now)
+	if err != nil {
+		log.Printf("Error creating audience list for user %d: %v", userID, err)
+		http.Error(w, "Failed to create list", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "You already have a list with that name", http.StatusConflict)
+		return
+	}
+	listID, _ := result.LastInsertId()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.AudienceListResponse{ID: listID, Name: name, CreatedAt: now})
+}
+
+// RenameAudienceListHandler renames one of the authenticated user's lists. The close
+// friends list can't be renamed.
+// PATCH /close-friends/lists/{listID}
+func RenameAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, list, ok := ownedAudienceList(w, r)
+	if !ok {
+		return
+	}
+	if list.IsCloseFriends {
+		http.Error(w, "The close friends list can't be renamed", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AudienceListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	name, msg := validAudienceListName(req.Name)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var taken bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM audience_lists WHERE user_id = ? AND name = ? AND id != ?)",
+		userID, name, list.ID).Scan(&taken)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, "You already have a list with that name", http.StatusConflict)
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE audience_lists SET name = ? WHERE id = ?", name, list.ID); err != nil {
+		log.Printf("Error renaming audience list %d: %v", list.ID, err)
+		http.Error(w, "Failed to rename list", http.StatusInternalServerError)
+		return
+	}
+	list.Name = name
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteAudienceListHandler deletes one of the authenticated user's lists. Posts that
+// were only shared with it stay visible to their author alone. The close friends
+// list can't be deleted.
+// DELETE /close-friends/lists/{listID}
+func DeleteAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	_, list, ok := ownedAudienceList(w, r)
+	if !ok {
+		return
+	}
+	if list.IsCloseFriends {
+		http.Error(w, "The close friends list can't be deleted", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	cleanup := []string{
+		"DELETE FROM post_audiences WHERE list_id = ?",
+		"DELETE FROM audience_list_members WHERE list_id = ?",
+		"DELETE FROM audience_lists WHERE id = ?",
+	}
+	for _, query := range cleanup {
+		if _, err := tx.Exec(query, list.ID); err != nil {
+			log.Printf("Error deleting audience list %d: %v", list.ID, err)
+			http.Error(w, "Failed to delete list", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "List deleted"})
+}
+
+// GetAudienceListMembersHandler lists the members of one of the authenticated user's lists.
+// GET /close-friends/lists/{listID}/members
+func GetAudienceListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, list, ok := ownedAudienceList(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT u.id, u.username,
+               COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.avatar, ''),
+               EXISTS(
+                   SELECT 1 FROM audience_list_members cm
+                   JOIN audience_lists cl ON cl.id = cm.list_id
+                   WHERE cl.user_id = ? AND cl.is_close_friends AND cm.member_id = u.id
+               )
+        FROM audience_list_members m
+        JOIN users u ON u.id = m.member_id
+        WHERE m.list_id = ?
+        ORDER BY u.username
+    `, userID, list.ID)
+	if err != nil {
+		log.Printf("Error fetching members of audience list %d: %v", list.ID, err)
+		http.Error(w, "Failed to fetch list members", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var members []models.CloseFriendResponse
+	for rows.Next() {
+		var m models.CloseFriendResponse
+		if err := rows.Scan(&m.ID, &m.Username, &m.FirstName, &m.LastName, &m.Avatar, &m.IsCloseFriend); err != nil {
+			log.Printf("Error scanning member of audience list %d: %v", list.ID, err)
+			continue
+		}
+		members = append(members, m)
+	}
+	if members == nil {
+		members = []models.CloseFriendResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddAudienceListMemberHandler adds a user the authenticated user follows to one of their lists.
+// POST /close-friends/lists/{listID}/members
+func AddAudienceListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, list, ok := ownedAudienceList(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CloseFriendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := addAudienceMember(userID, list.ID, req.TargetUserID, "this list"); msg != "" {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Added to " + list.Name})
+}
+
+// RemoveAudienceListMemberHandler removes a user from one of the authenticated user's lists.
+// DELETE /close-friends/lists/{listID}/members/{targetUserID}
+func RemoveAudienceListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	_, list, ok := ownedAudienceList(w, r)
+	if !ok {
+		return
+	}
+
+	targetUserID, err := strconv.ParseInt(r.PathValue("targetUserID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid target user ID", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := removeAudienceMember(list.ID, targetUserID)
+	if err != nil {
+		log.Printf("Error removing user %d from audience list %d: %v", targetUserID, list.ID, err)
+		http.Error(w, "Failed to remove from list", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "User is not in this list", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Removed from " + list.Name})
+}
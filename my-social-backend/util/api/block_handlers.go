@@ -0,0 +1,211 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// notBlockedClause returns a SQL condition that is true when neither viewerID nor
+// the user in userColumn has blocked the other. Blocks are symmetric: both sides
+// stop seeing and reaching each other.
+func notBlockedClause(userColumn string, viewerID int64) (string, []interface{}) {
+	clause := `NOT EXISTS(
+            SELECT 1 FROM user_blocks
+            WHERE (blocker_id = ? AND blocked_id = ` + userColumn + `) OR (blocker_id = ` + userColumn + ` AND blocked_id = ?)
+        )`
+	return clause, []interface{}{viewerID, viewerID}
+}
+
+// isBlockedBetween reports whether either user has blocked the other.
+func isBlockedBetween(userID, otherUserID int64) (bool, error) {
+	var blocked bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM user_blocks
+            WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+        )
+    `, userID, otherUserID, otherUserID, userID).Scan(&blocked)
+	return blocked, err
+}
+
+// BlockUserHandler blocks another user. Any follow relationship between the two
+// users (in either direction, including pending requests), the notifications about
+// them and any close-friend entries are removed.
+// POST /users/{targetUserID}/block
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized: User ID not found in session context.", http.StatusUnauthorized)
+		return
+	}
+
+	targetUserID, err := strconv.ParseInt(r.PathValue("targetUserID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid target user ID in URL path", http.StatusBadRequest)
+		return
+	}
+	if currentUserID == targetUserID {
+		http.Error(w, "Cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	var targetUserExists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", targetUserID).Scan(&targetUserExists)
+	if err != nil {
+		http.Error(w, "Database error checking target user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !targetUserExists {
+		http.Error(w, "Target user not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id, created_at)
+        VALUES (?, ?, ?)
+    `, currentUserID, targetUserID, time.Now())
+	if err != nil {
+		log.Printf("Error blocking user %d for user %d: %v", targetUserID, currentUserID, err)
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "User is already blocked", http.StatusConflict)
+		return
+	}
+
+	cleanup := []string{
+		"DELETE FROM followers WHERE (follower_id = ? AND followed_id = ?) OR (follower_id = ? AND followed_id = ?)",
+		`DELETE FROM audience_list_members
+         WHERE (member_id = ? AND list_id IN (SELECT id FROM audience_lists WHERE user_id = ?))
+            OR (member_id = ? AND list_id IN (SELECT id FROM audience_lists WHERE user_id = ?))`,
+		// Notifications about the follows removed above are stale now
+		`DELETE FROM notifications
+         WHERE type IN ('follow_request', 'follow_accepted', 'new_follower')
+           AND ((user_id = ? AND actor_id = ?) OR (user_id = ? AND actor_id = ?))`,
+	}
+	for _, query := range cleanup {
+		if _, err := tx.Exec(query, currentUserID, targetUserID, targetUserID, currentUserID); err != nil {
+			log.Printf("Error removing relationships between users %d and %d: %v", currentUserID, targetUserID, err)
+			http.Error(w, "Failed to block user", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	BroadcastUnreadCountToUser(int(currentUserID))
+	BroadcastUnreadCountToUser(int(targetUserID))
+
+	log.Printf("User %d blocked user %d", currentUserID, targetUserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.BlockStatusResponse{
+		TargetUserID: targetUserID,
+		Blocked:      true,
+		Message:      "User blocked.",
+	})
+}
+
+// UnblockUserHandler removes a block. Follow relationships removed by the block are
+// not restored.
+// DELETE /users/{targetUserID}/block
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized: User ID not found in session context.", http.StatusUnauthorized)
+		return
+	}
+
+	targetUserID, err := strconv.ParseInt(r.PathValue("targetUserID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid target user ID in URL path", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", currentUserID, targetUserID)
+	if err != nil {
+		log.Printf("Error unblocking user %d for user %d: %v", targetUserID, currentUserID, err)
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "User is not blocked", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.BlockStatusResponse{
+		TargetUserID: targetUserID,
+		Blocked:      false,
+		Message:      "User unblocked.",
+	})
+}
+
+// GetBlockedUsersHandler lists the users the authenticated user has blocked.
+// GET /blocks
+func GetBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT u.id, u.username, u.first_name, u.last_name, u.avatar, b.created_at
+        FROM user_blocks b
+        JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = ?
+        ORDER BY b.created_at DESC
+    `, currentUserID)
+	if err != nil {
+		log.Printf("Error querying blocked users for user %d: %v", currentUserID, err)
+		http.Error(w, "Failed to fetch blocked users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var blocked []models.BlockedUserResponse
+	for rows.Next() {
+		var u models.BlockedUserResponse
+		var firstName, lastName, avatar sql.NullString
+		if err := rows.Scan(&u.ID, &u.Username, &firstName, &lastName, &avatar, &u.BlockedAt); err != nil {
+			log.Printf("Error scanning blocked user for user %d: %v", currentUserID, err)
+			continue
+		}
+		u.FirstName = firstName.String
+		u.LastName = lastName.String
+		u.Avatar = avatar.String
+		blocked = append(blocked, u)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating blocked users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blocked == nil {
+		blocked = []models.BlockedUserResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocked)
+}
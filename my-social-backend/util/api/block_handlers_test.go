@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// Blocking someone who asked to follow you removes their request's notification
+// and updates your unread count; other notifications stay.
+func TestBlockUserRemovesFollowNotifications(t *testing.T) {
+	newTestDB(t)
+	blocker, requester, other := createTestUser(t, "blocker"), createTestUser(t, "requester"), createTestUser(t, "other")
+	database.DB.Exec("INSERT INTO followers (follower_id, followed_id, status) VALUES (?, ?, 'pending')", requester, blocker)
+	NotificationHelper.CreateFollowRequestNotification(int(requester), int(blocker))
+	NotificationHelper.CreateDirectFollowNotification(int(blocker), int(requester))
+	NotificationHelper.CreateDirectFollowNotification(int(other), int(blocker))
+	conn := connectTestClient(t, blocker)
+
+	id := strconv.FormatInt(requester, 10)
+	r := httptest.NewRequest(http.MethodPost, "/users/"+id+"/block", nil)
+	r.SetPathValue("targetUserID", id)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, blocker))
+	w := httptest.NewRecorder()
+	BlockUserHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+
+	var left []int64
+	rows, err := database.DB.Query("SELECT actor_id FROM notifications ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var actor int64
+		rows.Scan(&actor)
+		left = append(left, actor)
+	}
+	if len(left) != 1 || left[0] != other {
+		t.Errorf("notifications left from %v, want only the one from %d", left, other)
+	}
+
+	msg := receiveType(t, conn, "notification_count_update")
+	var count models.WSNotificationCount
+	json.Unmarshal(msg.Data, &count)
+	if count.UnreadCount != 1 {
+		t.Errorf("pushed unread count %d, want 1", count.UnreadCount)
+	}
+}
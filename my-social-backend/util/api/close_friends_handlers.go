@@ -5,14 +5,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"reda-social-network/database"
 	"reda-social-network/models"
 	"reda-social-network/util"
 )
 
-// AddCloseFriendHandler adds a user to close friends list
+// AddCloseFriendHandler adds a user to the built-in close friends list
 // POST /close-friends
 func AddCloseFriendHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
@@ -35,58 +34,15 @@ func AddCloseFriendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.TargetUserID == userID {
-		http.Error(w, "Cannot add yourself to close friends", http.StatusBadRequest)
-		return
-	}
-
-	// Check if target user exists and if current user follows them
-	var exists bool
-	var isFollowing bool
-	err = database.DB.QueryRow(`
-		SELECT 
-			EXISTS(SELECT 1 FROM users WHERE id = ?),
-			EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'accept')
-	`, req.TargetUserID, userID, req.TargetUserID).Scan(&exists, &isFollowing)
-
-	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if !exists {
-		http.Error(w, "Target user not found", http.StatusNotFound)
-		return
-	}
-
-	if !isFollowing {
-		http.Error(w, "You must be following this user to add them to close friends", http.StatusBadRequest)
-		return
-	}
-
-	// Check if already in close friends
-	var alreadyCloseFriend bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM close_friends WHERE user_id = ? AND close_friend_id = ?)",
-		userID, req.TargetUserID).Scan(&alreadyCloseFriend)
+	listID, err := closeFriendsListID(userID)
 	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error resolving close friends list for user %d: %v", userID, err)
+		http.Error(w, "Failed to add close friend", http.StatusInternalServerError)
 		return
 	}
 
-	if alreadyCloseFriend {
-		http.Error(w, "User is already in your close friends list", http.StatusConflict)
-		return
-	}
-
-	// Add to close friends
-	_, err = database.DB.Exec(`
-		INSERT INTO close_friends (user_id, close_friend_id, created_at) 
-		VALUES (?, ?, ?)
-	`, userID, req.TargetUserID, time.Now())
-
-	if err != nil {
-		log.Printf("Error adding close friend: %v", err)
-		http.Error(w, "Failed to add close friend", http.StatusInternalServerError)
+	if status, msg := addAudienceMember(userID, listID, req.TargetUserID, "your close friends list"); msg != "" {
+		http.Error(w, msg, status)
 		return
 	}
 
@@ -119,16 +75,21 @@ func RemoveCloseFriendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := database.DB.Exec("DELETE FROM close_friends WHERE user_id = ? AND close_friend_id = ?",
-		userID, targetUserID)
+	listID, err := closeFriendsListID(userID)
+	if err != nil {
+		log.Printf("Error resolving close friends list for user %d: %v", userID, err)
+		http.Error(w, "Failed to remove close friend", http.StatusInternalServerError)
+		return
+	}
+
+	removed, err := removeAudienceMember(listID, targetUserID)
 	if err != nil {
 		log.Printf("Error removing close friend: %v", err)
 		http.Error(w, "Failed to remove close friend", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if !removed {
 		http.Error(w, "User was not in your close friends list", http.StatusNotFound)
 		return
 	}
@@ -160,9 +121,10 @@ func GetCloseFriendsHandler(w http.ResponseWriter, r *http.Request) {
 			   COALESCE(u.first_name, '') as first_name,
 			   COALESCE(u.last_name, '') as last_name,
 			   COALESCE(u.avatar, '') as avatar
-		FROM close_friends cf
-		JOIN users u ON cf.close_friend_id = u.id
-		WHERE cf.user_id = ?
+		FROM audience_list_members m
+		JOIN audience_lists l ON l.id = m.list_id
+		JOIN users u ON m.member_id = u.id
+		WHERE l.user_id = ? AND l.is_close_friends
 		ORDER BY u.username
 	`
 
@@ -218,9 +180,7 @@ func CheckCloseFriendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var isCloseFriend bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM close_friends WHERE user_id = ? AND close_friend_id = ?)",
-		userID, targetUserID).Scan(&isCloseFriend)
+	isCloseFriend, err := isCloseFriendOf(userID, targetUserID)
 	if err != nil {
 		log.Printf("Error checking close friend status: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
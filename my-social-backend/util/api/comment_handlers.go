@@ -55,6 +55,17 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Posts the user can't see (including unpublished ones) can't be commented on
+	visible, err := canViewPost(postID, userID)
+	if err != nil {
+		http.Error(w, "Error checking post visibility: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
 	now := time.Now()
 	stmt, err := database.DB.Prepare(`
         INSERT INTO comments (post_id, user_id, content, created_at)
@@ -111,11 +122,19 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:       now,
 	}
 
-	// Broadcast the new comment to all online users except the commenter
-	for onlineUserID := range activeConnections {
+	// Broadcast the new comment to all online users except the commenter, users
+	// blocked in either direction and users who muted the commenter
+	onlineIDs := onlineUserIDs()
+	for _, onlineUserID := range onlineIDs {
 		if onlineUserID == userID {
 			continue
 		}
+		if blocked, err := isBlockedBetween(userID, onlineUserID); err != nil || blocked {
+			continue
+		}
+		if !shouldPush(onlineUserID, muteUser, userID) {
+			continue
+		}
 		BroadcastToUser(onlineUserID, "new_comment", commentResp)
 	}
 
@@ -134,8 +153,8 @@ func GetCommentsForPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists)
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	exists, err := canViewPost(postID, viewerID)
 	if err != nil {
 		http.Error(w, "Error checking post existence: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -145,14 +164,16 @@ func GetCommentsForPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Comments by users blocked in either direction are left out
+	notBlocked, blockArgs := notBlockedClause("c.user_id", viewerID)
 	query := `
         SELECT c.id, c.post_id, c.user_id, u.username, u.first_name, u.last_name, u.avatar, c.content, c.created_at
         FROM comments c
         JOIN users u ON c.user_id = u.id
-        WHERE c.post_id = ?
+        WHERE c.post_id = ? AND ` + notBlocked + `
         ORDER BY c.created_at ASC
     `
-	rows, err := database.DB.Query(query, postID)
+	rows, err := database.DB.Query(query, append([]interface{}{postID}, blockArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		log.Printf("Error querying comments for post %d: %v", postID, err)
@@ -51,6 +51,16 @@ func RequestFollowUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := isBlockedBetween(currentUserID, targetUserID)
+	if err != nil {
+		http.Error(w, "Database error checking blocks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	// Check existing follow status
 	var existingStatus sql.NullString
 	err = database.DB.QueryRow("SELECT status FROM followers WHERE follower_id = ? AND followed_id = ?", currentUserID, targetUserID).Scan(&existingStatus)
@@ -125,7 +135,8 @@ func RequestFollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// UnfollowUserHandler handles a user's request to unfollow another user.
+// UnfollowUserHandler handles a user's request to unfollow another user. A pending
+// request is withdrawn as CancelFollowRequestHandler does.
 // DELETE /users/{targetUserID}/follow
 func UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
@@ -149,25 +160,48 @@ func UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := database.DB.Exec("DELETE FROM followers WHERE follower_id = ? AND followed_id = ?", currentUserID, targetUserID)
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	cancelled, err := cancelFollowRequest(tx, currentUserID, targetUserID)
 	if err != nil {
 		http.Error(w, "Failed to unfollow user: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Error deleting follow for follower %d to followed %d: %v", currentUserID, targetUserID, err)
+		log.Printf("Error cancelling follow request from %d to %d: %v", currentUserID, targetUserID, err)
 		return
 	}
+	if !cancelled {
+		result, err := tx.Exec("DELETE FROM followers WHERE follower_id = ? AND followed_id = ?", currentUserID, targetUserID)
+		if err != nil {
+			http.Error(w, "Failed to unfollow user: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error deleting follow for follower %d to followed %d: %v", currentUserID, targetUserID, err)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Not following this user or request not found", http.StatusNotFound)
+			return
+		}
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Not following this user or request not found", http.StatusNotFound)
+	if err = tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	message := "Successfully unfollowed user."
+	if cancelled {
+		notifyFollowRequestCancelled(currentUserID, targetUserID)
+		message = "Follow request cancelled."
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(models.FollowStatusResponse{
 		TargetUserID: targetUserID,
 		Status:       "not_following",
-		Message:      "Successfully unfollowed user.",
+		Message:      message,
 	})
 }
 
@@ -181,14 +215,22 @@ func GetFollowersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Lists of private accounts are only visible to their followers
+	if !requireProfileContent(w, r, targetUserID) {
+		return
+	}
+
+	// Users blocked in either direction are left out of the list
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	notBlocked, blockArgs := notBlockedClause("u.id", viewerID)
 	query := `
         SELECT u.id, u.username, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.avatar, '')
         FROM users u
         JOIN followers f ON u.id = f.follower_id
-        WHERE f.followed_id = ? AND f.status = 'accept'
+        WHERE f.followed_id = ? AND f.status = 'accept' AND ` + notBlocked + `
         ORDER BY f.created_at DESC
     `
-	rows, err := database.DB.Query(query, targetUserID)
+	rows, err := database.DB.Query(query, append([]interface{}{targetUserID}, blockArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error fetching followers: "+err.Error(), http.StatusInternalServerError)
 		log.Printf("Error querying followers for user %d: %v", targetUserID, err)
@@ -227,14 +269,22 @@ func GetFollowingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Lists of private accounts are only visible to their followers
+	if !requireProfileContent(w, r, targetUserID) {
+		return
+	}
+
+	// Users blocked in either direction are left out of the list
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	notBlocked, blockArgs := notBlockedClause("u.id", viewerID)
 	query := `
         SELECT u.id, u.username, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.avatar, '')
         FROM users u
         JOIN followers f ON u.id = f.followed_id
-        WHERE f.follower_id = ? AND f.status = 'accept'
+        WHERE f.follower_id = ? AND f.status = 'accept' AND ` + notBlocked + `
         ORDER BY f.created_at DESC
     `
-	rows, err := database.DB.Query(query, targetUserID)
+	rows, err := database.DB.Query(query, append([]interface{}{targetUserID}, blockArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error fetching following list: "+err.Error(), http.StatusInternalServerError)
 		log.Printf("Error querying following for user %d: %v", targetUserID, err)
@@ -443,3 +493,185 @@ func HandleFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": resultMessage})
 }
+
+// GetSentFollowRequestsHandler retrieves the follow requests the authenticated user has sent that are still pending.
+// GET /follow-requests/sent
+func GetSentFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `
+        SELECT u.id, u.username, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.avatar, '')
+        FROM users u
+        JOIN followers f ON u.id = f.followed_id
+        WHERE f.follower_id = ? AND f.status = 'pending'
+        ORDER BY f.created_at DESC
+    `
+	rows, err := database.DB.Query(query, currentUserID)
+	if err != nil {
+		http.Error(w, "Database error fetching sent requests: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error querying sent requests for user %d: %v", currentUserID, err)
+		return
+	}
+	defer rows.Close()
+
+	var requests []models.UserFollowInfo
+	for rows.Next() {
+		var u models.UserFollowInfo
+		if err := rows.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Avatar); err != nil {
+			log.Printf("Error scanning sent request for user %d: %v", currentUserID, err)
+			continue
+		}
+		requests = append(requests, u)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating sent request rows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if requests == nil {
+		requests = []models.UserFollowInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// CancelFollowRequestHandler withdraws a pending follow request sent by the authenticated user.
+// The request notification is removed and the target is told over WebSocket.
+// DELETE /follow-requests/sent/{targetUserID}
+func CancelFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetUserIDStr := r.PathValue("targetUserID")
+	targetUserID, err := strconv.ParseInt(targetUserIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid target user ID in URL path", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	cancelled, err := cancelFollowRequest(tx, currentUserID, targetUserID)
+	if err != nil {
+		http.Error(w, "Failed to cancel follow request: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error cancelling follow request from %d to %d: %v", currentUserID, targetUserID, err)
+		return
+	}
+	if !cancelled {
+		http.Error(w, "No pending follow request to this user.", http.StatusNotFound)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	notifyFollowRequestCancelled(currentUserID, targetUserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.FollowStatusResponse{
+		TargetUserID: targetUserID,
+		Status:       "not_following",
+		Message:      "Follow request cancelled.",
+	})
+}
+
+// cancelFollowRequest deletes followerID's pending request to follow followedID
+// and the notification about it. It reports false if there was no such request.
+func cancelFollowRequest(tx *sql.Tx, followerID, followedID int64) (bool, error) {
+	result, err := tx.Exec("DELETE FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'pending'", followerID, followedID)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+
+	// The target's notification about the request is stale now
+	_, err = tx.Exec("DELETE FROM notifications WHERE user_id = ? AND type = 'follow_request' AND actor_id = ?", followedID, followerID)
+	return err == nil, err
+}
+
+// notifyFollowRequestCancelled tells followedID, once cancelFollowRequest's
+// transaction is committed, that followerID's request is gone.
+func notifyFollowRequestCancelled(followerID, followedID int64) {
+	BroadcastToUser(followedID, "follow_request_cancelled", models.WSFollowRequestCancelled{
+		FollowerID: followerID,
+	})
+	BroadcastUnreadCountToUser(int(followedID))
+}
+
+// RemoveFollowerHandler lets the authenticated user remove one of their followers.
+// The removed follower is told over WebSocket and has to request again to follow.
+// DELETE /users/me/followers/{followerID}
+func RemoveFollowerHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, ok := r.Context().Value(middleware.UserIDKey).(int64) // This is the followed_id
+	if !ok || currentUserID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	followerIDStr := r.PathValue("followerID")
+	followerID, err := strconv.ParseInt(followerIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid follower ID in URL path", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'accept'", followerID, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to remove follower: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error removing follower %d from user %d: %v", followerID, currentUserID, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "This user is not following you.", http.StatusNotFound)
+		return
+	}
+
+	// Audience lists (close friends included) can only hold people you follow, so
+	// the current user leaves the follower's lists too
+	_, err = tx.Exec(`
+        DELETE FROM audience_list_members
+        WHERE member_id = ? AND list_id IN (SELECT id FROM audience_lists WHERE user_id = ?)
+    `, currentUserID, followerID)
+	if err != nil {
+		http.Error(w, "Failed to remove follower: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error removing close friend entry of %d for user %d: %v", followerID, currentUserID, err)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	BroadcastToUser(followerID, "follower_removed", models.WSFollowerRemoved{
+		FollowedID: currentUserID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Follower removed."})
+}
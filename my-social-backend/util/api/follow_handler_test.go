@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// Unfollowing a user who hasn't answered the request yet withdraws it, as
+// cancelling it would.
+func TestUnfollowPendingRequest(t *testing.T) {
+	newTestDB(t)
+	requester, target := createTestUser(t, "requester"), createTestUser(t, "target")
+	database.DB.Exec("INSERT INTO followers (follower_id, followed_id, status) VALUES (?, ?, 'pending')", requester, target)
+	NotificationHelper.CreateFollowRequestNotification(int(requester), int(target))
+	conn := connectTestClient(t, target)
+
+	id := strconv.FormatInt(target, 10)
+	r := httptest.NewRequest(http.MethodDelete, "/users/"+id+"/follow", nil)
+	r.SetPathValue("targetUserID", id)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, requester))
+	w := httptest.NewRecorder()
+	UnfollowUserHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+
+	var requests, notifications int
+	database.DB.QueryRow("SELECT COUNT(*) FROM followers").Scan(&requests)
+	database.DB.QueryRow("SELECT COUNT(*) FROM notifications").Scan(&notifications)
+	if requests != 0 || notifications != 0 {
+		t.Errorf("%d follow row(s) and %d notification(s) left, want none", requests, notifications)
+	}
+
+	msg := receiveType(t, conn, "follow_request_cancelled")
+	var cancelled models.WSFollowRequestCancelled
+	json.Unmarshal(msg.Data, &cancelled)
+	if cancelled.FollowerID != requester {
+		t.Errorf("follow_request_cancelled names follower %d, want %d", cancelled.FollowerID, requester)
+	}
+	msg = receiveType(t, conn, "notification_count_update")
+	var count models.WSNotificationCount
+	json.Unmarshal(msg.Data, &count)
+	if count.UnreadCount != 0 {
+		t.Errorf("pushed unread count %d, want 0", count.UnreadCount)
+	}
+}
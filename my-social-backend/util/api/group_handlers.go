@@ -317,6 +317,10 @@ func InviteToGroupHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Only group members can invite", http.StatusForbidden)
 		return
 	}
+	if blocked, err := isBlockedBetween(inviterID, req.UserID); err != nil || blocked {
+		http.Error(w, "You cannot invite this user", http.StatusForbidden)
+		return
+	}
 	now := time.Now()
 	// Insert invitation
 	_, err = database.DB.Exec(
@@ -406,8 +410,8 @@ func AcceptGroupInviteHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	// Broadcast new member joined
-	go BroadcastToGroup(groupID, "group_member_joined", map[string]interface{}{
-		"user_id": userID,
+	go BroadcastToGroup(groupID, "group_member_joined", models.WSGroupMemberJoined{
+		UserID: userID,
 	}, nil)
 }
 
@@ -638,22 +642,25 @@ func ListGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Define a named struct type for the response
 	type GroupPostResponse struct {
-		ID             int64     `json:"id"`
-		UserID         int64     `json:"user_id"`
-		AuthorUsername string    `json:"author_username"`
-		Content        string    `json:"content"`
-		CreatedAt      time.Time `json:"created_at"`
-		UpdatedAt      time.Time `json:"updated_at"`
-	}
-
-	// Fetch posts
+		ID             int64                      `json:"id"`
+		UserID         int64                      `json:"user_id"`
+		AuthorUsername string                     `json:"author_username"`
+		Content        string                     `json:"content"`
+		Media          []models.PostMediaResponse `json:"media"`
+		Poll           *models.PollResponse       `json:"poll,omitempty"`
+		CreatedAt      time.Time                  `json:"created_at"`
+		UpdatedAt      time.Time                  `json:"updated_at"`
+	}
+
+	// Fetch posts, leaving out authors blocked in either direction
+	notBlocked, blockArgs := notBlockedClause("p.user_id", userID)
 	rows, err := database.DB.Query(`
         SELECT p.id, p.user_id, u.username, p.content, p.created_at, p.updated_at
         FROM group_posts p
         JOIN users u ON p.user_id = u.id
-        WHERE p.group_id = ?
+        WHERE p.group_id = ? AND `+notBlocked+`
         ORDER BY p.created_at DESC
-    `, groupID)
+    `, append([]interface{}{groupID}, blockArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -666,6 +673,12 @@ func ListGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 		if err := rows.Scan(&p.ID, &p.UserID, &p.AuthorUsername, &p.Content, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			continue
 		}
+		if p.Media, err = loadMediaFor(attachToGroupPost, p.ID); err != nil {
+			log.Printf("Error loading media for group post %d: %v", p.ID, err)
+		}
+		if p.Poll, err = loadPollFor(attachToGroupPost, p.ID, userID); err != nil {
+			log.Printf("Error loading poll for group post %d: %v", p.ID, err)
+		}
 		posts = append(posts, p)
 	}
 	if posts == nil {
@@ -691,14 +704,35 @@ func CreateGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req struct {
-		Content string `json:"content"`
+		Content string                      `json:"content"`
+		Media   []models.AttachMediaRequest `json:"media,omitempty"`
+		Poll    *models.CreatePollRequest   `json:"poll,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Content == "" {
 		http.Error(w, "Invalid content", http.StatusBadRequest)
 		return
 	}
+	var pollOptions []string
+	if req.Poll != nil {
+		var msg string
+		if pollOptions, msg = validatePollRequest(req.Poll, nil); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	media, errStatus, msg := resolveMediaAttachments(userID, req.Media, "")
+	if msg != "" {
+		http.Error(w, msg, errStatus)
+		return
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
 	now := time.Now()
-	res, err := database.DB.Exec(
+	res, err := tx.Exec(
 		"INSERT INTO group_posts (group_id, user_id, content, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
 		groupID, userID, req.Content, now, now,
 	)
@@ -707,17 +741,34 @@ func CreateGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	postID, _ := res.LastInsertId()
+	if err := attachMedia(tx, attachToGroupPost, postID, media); err != nil {
+		log.Printf("Error attaching media to group post %d: %v", postID, err)
+		writeAttachMediaError(w, err)
+		return
+	}
+	if req.Poll != nil {
+		if _, err := createPoll(tx, attachToGroupPost, postID, userID, req.Poll, pollOptions); err != nil {
+			log.Printf("Error creating poll for group post %d: %v", postID, err)
+			http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create group post", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 	// Fetch the full post info for broadcast (simplified, add more fields as needed)
-	var post struct {
-		ID        int64     `json:"id"`
-		GroupID   int64     `json:"group_id"`
-		UserID    int64     `json:"user_id"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
-	}
+	var post models.WSGroupPost
 	dbErr := database.DB.QueryRow("SELECT id, group_id, user_id, content, created_at FROM group_posts WHERE id = ?", postID).Scan(&post.ID, &post.GroupID, &post.UserID, &post.Content, &post.CreatedAt)
 	if dbErr == nil {
+		if post.Media, dbErr = loadMediaFor(attachToGroupPost, postID); dbErr != nil {
+			log.Printf("Error loading media for group post %d: %v", postID, dbErr)
+		}
+		// Members see the poll without results until they vote
+		if post.Poll, dbErr = loadPollFor(attachToGroupPost, postID, 0); dbErr != nil {
+			log.Printf("Error loading poll for group post %d: %v", postID, dbErr)
+		}
 		go BroadcastToGroup(groupID, "group_post_created", post, nil)
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"post_id": postID})
@@ -739,13 +790,14 @@ func ListGroupPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	postID, _ := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	notBlocked, blockArgs := notBlockedClause("c.user_id", userID)
 	rows, err := database.DB.Query(`
         SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.created_at
         FROM group_post_comments c
         JOIN users u ON c.user_id = u.id
-        WHERE c.post_id = ?
+        WHERE c.post_id = ? AND `+notBlocked+`
         ORDER BY c.created_at ASC
-    `, postID)
+    `, append([]interface{}{postID}, blockArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -801,13 +853,7 @@ func CreateGroupPostCommentHandler(w http.ResponseWriter, r *http.Request) {
 	commentID, _ := res.LastInsertId()
 	w.WriteHeader(http.StatusCreated)
 	// Fetch the full comment info for broadcast (simplified)
-	var comment struct {
-		ID        int64     `json:"id"`
-		PostID    int64     `json:"post_id"`
-		UserID    int64     `json:"user_id"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
-	}
+	var comment models.WSGroupPostComment
 	dbErr := database.DB.QueryRow("SELECT id, post_id, user_id, content, created_at FROM group_post_comments WHERE id = ?", commentID).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt)
 	if dbErr == nil {
 		go BroadcastToGroup(groupID, "group_post_comment_created", comment, nil)
@@ -856,15 +902,7 @@ func CreateGroupEventHandler(w http.ResponseWriter, r *http.Request) {
 	eventID, _ := res.LastInsertId()
 	w.WriteHeader(http.StatusCreated)
 	// Fetch the full event info for broadcast (simplified)
-	var event struct {
-		ID          int64     `json:"id"`
-		GroupID     int64     `json:"group_id"`
-		CreatorID   int64     `json:"creator_id"`
-		Title       string    `json:"title"`
-		Description string    `json:"description"`
-		EventTime   time.Time `json:"event_time"`
-		CreatedAt   time.Time `json:"created_at"`
-	}
+	var event models.WSGroupEvent
 	dbErr := database.DB.QueryRow("SELECT id, group_id, creator_id, title, description, event_time, created_at FROM group_events WHERE id = ?", eventID).Scan(&event.ID, &event.GroupID, &event.CreatorID, &event.Title, &event.Description, &event.EventTime, &event.CreatedAt)
 	if dbErr == nil {
 		go BroadcastToGroup(groupID, "group_event_created", event, nil)
@@ -978,10 +1016,10 @@ func RSVPGroupEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusOK)
 	// Broadcast RSVP update (send eventID, userID, response)
-	go BroadcastToGroup(groupID, "group_event_rsvp_updated", map[string]interface{}{
-		"event_id": eventID,
-		"user_id":  userID,
-		"response": req.Response,
+	go BroadcastToGroup(groupID, "group_event_rsvp_updated", models.WSGroupEventRSVP{
+		EventID:  eventID,
+		UserID:   userID,
+		Response: req.Response,
 	}, nil)
 }
 
@@ -1091,6 +1129,23 @@ func DeleteGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	mediaIDs, err := attachedMediaIDs(attachToGroupPost, postID)
+	if err != nil {
+		log.Printf("Error loading media for group post %d: %v", postID, err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+	if err := deleteMediaFor(database.DB, attachToGroupPost, postID); err != nil {
+		log.Printf("Error deleting media for group post %d: %v", postID, err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+	if err := deletePollsFor(database.DB, attachToGroupPost, postID); err != nil {
+		log.Printf("Error deleting poll for group post %d: %v", postID, err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+
 	// Delete post (and optionally its comments, likes, etc.)
 	_, err = database.DB.Exec("DELETE FROM group_posts WHERE id = ? AND group_id = ?", postID, groupID)
 	if err != nil {
@@ -1099,5 +1154,6 @@ func DeleteGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	// Optionally, delete related comments
 	_, _ = database.DB.Exec("DELETE FROM group_post_comments WHERE post_id = ?", postID)
+	removeUnreferencedMedia(r.Context(), mediaIDs)
 	w.WriteHeader(http.StatusNoContent)
 }
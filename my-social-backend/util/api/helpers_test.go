@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/database"
+	"reda-social-network/pkg/db/sqlite"
+	"reda-social-network/pkg/storage"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers log every request; keep test output readable
+	if os.Getenv("TEST_LOG") == "" {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestDB points database.DB at a new database set up like the server's:
+// migrations first, then InitDB.
+func newTestDB(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlite.ConnectAndMigrate(path, "../../pkg/db/migrations/sqlite")
+	if err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	db.Close()
+
+	// Rate limit buckets are per user ID, and IDs restart in every database
+	sendLimiter = newRateLimiter(config.App.RateLimit)
+
+	prev := database.DB
+	if err := database.InitDB(path); err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = prev
+	})
+}
+
+// useTestMediaStore points storage.Media at an empty local store for the test.
+func useTestMediaStore(t *testing.T) {
+	t.Helper()
+	prev := storage.Media
+	storage.Media = storage.NewLocalStore(t.TempDir(), "/uploads/")
+	t.Cleanup(func() { storage.Media = prev })
+}
+
+// createTestUser adds a user and returns their ID.
+func createTestUser(t *testing.T, username string) int64 {
+	t.Helper()
+	res, err := database.DB.Exec(`
+        INSERT INTO users (username, password, email, first_name, last_name)
+        VALUES (?, 'x', ?, ?, 'Test')
+    `, username, username+"@example.com", username)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// follow makes followerID an accepted follower of followedID.
+func follow(t *testing.T, followerID, followedID int64) {
+	t.Helper()
+	_, err := database.DB.Exec("INSERT INTO followers (follower_id, followed_id, status) VALUES (?, ?, 'accept')", followerID, followedID)
+	if err != nil {
+		t.Fatalf("following %d -> %d: %v", followerID, followedID, err)
+	}
+}
+
+// connectTestClient registers a realtime connection for userID, as if they had
+// opened a WebSocket. Nothing drains it; tests read it with receive.
+func connectTestClient(t *testing.T, userID int64) *realtimeConn {
+	t.Helper()
+	conn := newRealtimeConn("test", nil)
+	hub.Register(userID, conn)
+	t.Cleanup(func() {
+		hub.Unregister(userID, conn)
+		conn.Close()
+	})
+	return conn
+}
+
+// received is a message taken off a test connection's queue.
+type received struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id"`
+	Seq  int64           `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+// receive takes the next message off conn's queue, failing the test if none
+// arrives in time.
+func receive(t *testing.T, conn *realtimeConn) received {
+	t.Helper()
+	select {
+	case q := <-conn.send:
+		var msg received
+		if err := json.Unmarshal(q.data, &msg); err != nil {
+			t.Fatalf("decoding queued message %s: %v", q.data, err)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return received{}
+	}
+}
+
+// drain takes every message already queued on conn.
+func drain(t *testing.T, conn *realtimeConn) []received {
+	t.Helper()
+	var msgs []received
+	for len(conn.send) > 0 {
+		msgs = append(msgs, receive(t, conn))
+	}
+	return msgs
+}
+
+// receiveType takes messages off conn's queue until one of type msgType arrives
+// and returns it, failing the test if none does in time.
+func receiveType(t *testing.T, conn *realtimeConn, msgType string) received {
+	t.Helper()
+	for {
+		if msg := receive(t, conn); msg.Type == msgType {
+			return msg
+		}
+	}
+}
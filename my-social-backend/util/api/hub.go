@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"reda-social-network/config"
+)
+
+// Hub delivers realtime messages to users' connections (WebSockets and event
+// streams) and tracks who is online. Connections belong to the backend instance
+// they were opened on; the hub is what makes publishing and presence work across
+// instances.
+type Hub interface {
+	// Register adds a connection opened on this instance. It reports whether the
+	// user just came online, i.e. had no connection on any instance.
+	Register(userID int64, client *realtimeConn) bool
+	// Unregister removes a connection. It reports whether the user just went
+	// offline, i.e. has no connection left on any instance.
+	Unregister(userID int64, client *realtimeConn) bool
+	// PublishToUser sends msg to every connection of userID except except, which
+	// may be nil.
+	PublishToUser(userID int64, msg WSMessage, except *realtimeConn)
+	// PublishToGroup sends msg to every connection of a group's members. seqs maps
+	// each member to the seq of the message in their event log (0 for none).
+	PublishToGroup(groupID int64, seqs map[int64]int64, msg WSMessage)
+	// IsOnline reports whether userID has a connection on any instance.
+	IsOnline(userID int64) bool
+	// OnlineUsers returns the users with a connection on any instance.
+	OnlineUsers() []int64
+}
+
+// wsConnections are the realtime connections open on this instance.
+var wsConnections = newLocalConnections()
+
+// hub is the hub used by the server, set up by InitHub. Until then it is a memory
+// hub, which is also what a single instance needs.
+var hub Hub = newMemoryHub(wsConnections)
+
+// InitHub creates the hub selected by the configuration.
+func InitHub(cfg config.HubConfig) error {
+	switch cfg.Backend {
+	case "", "memory":
+		hub = newMemoryHub(wsConnections)
+	case "redis":
+		h, err := newRedisHub(cfg, wsConnections)
+		if err != nil {
+			return err
+		}
+		hub = h
+	default:
+		return fmt.Errorf("hub: unknown backend %q (want \"memory\" or \"redis\")", cfg.Backend)
+	}
+	return nil
+}
+
+// localConnections holds the connections open on this instance, per user. A user
+// has one connection per open tab or device.
+type localConnections struct {
+	mu      sync.RWMutex
+	clients map[int64]map[*realtimeConn]struct{}
+}
+
+func newLocalConnections() *localConnections {
+	return &localConnections{clients: make(map[int64]map[*realtimeConn]struct{})}
+}
+
+// add registers client as one of userID's connections. It reports whether it is
+// their first one on this instance.
+func (l *localConnections) add(userID int64, client *realtimeConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clients, exists := l.clients[userID]
+	if !exists {
+		clients = make(map[*realtimeConn]struct{})
+		l.clients[userID] = clients
+	}
+	clients[client] = struct{}{}
+	return !exists
+}
+
+// remove unregisters client. It reports whether it was userID's last connection
+// on this instance.
+func (l *localConnections) remove(userID int64, client *realtimeConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clients, exists := l.clients[userID]
+	if !exists {
+		return false
+	}
+	if _, ok := clients[client]; !ok {
+		return false
+	}
+	delete(clients, client)
+	if len(clients) > 0 {
+		return false
+	}
+	delete(l.clients, userID)
+	return true
+}
+
+func (l *localConnections) has(userID int64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, exists := l.clients[userID]
+	return exists
+}
+
+// userIDs returns the users with a connection on this instance.
+func (l *localConnections) userIDs() []int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	userIDs := make([]int64, 0, len(l.clients))
+	for userID := range l.clients {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// forEach calls fn for every connection, with the registry locked.
+func (l *localConnections) forEach(fn func(userID int64, conn *realtimeConn)) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for userID, clients := range l.clients {
+		for client := range clients {
+			fn(userID, client)
+		}
+	}
+}
+
+// deliver queues msg on every connection of userID on this instance except
+// except. A client too far behind is disconnected and its read loop unregisters it.
+func (l *localConnections) deliver(userID int64, msg WSMessage, except *realtimeConn) {
+	l.mu.RLock()
+	clients := make([]*realtimeConn, 0, len(l.clients[userID]))
+	for client := range l.clients[userID] {
+		if client != except {
+			clients = append(clients, client)
+		}
+	}
+	l.mu.RUnlock()
+
+	for _, client := range clients {
+		if err := client.WriteJSON(msg); err != nil {
+			log.Printf("Error broadcasting to user %d: %v", userID, err)
+		}
+	}
+}
+
+// memoryHub is the hub of a single instance: everyone online is connected to it.
+type memoryHub struct {
+	conns *localConnections
+}
+
+func newMemoryHub(conns *localConnections) *memoryHub {
+	return &memoryHub{conns: conns}
+}
+
+func (h *memoryHub) Register(userID int64, client *realtimeConn) bool {
+	return h.conns.add(userID, client)
+}
+
+func (h *memoryHub) Unregister(userID int64, client *realtimeConn) bool {
+	return h.conns.remove(userID, client)
+}
+
+func (h *memoryHub) PublishToUser(userID int64, msg WSMessage, except *realtimeConn) {
+	h.conns.deliver(userID, msg, except)
+}
+
+func (h *memoryHub) PublishToGroup(groupID int64, seqs map[int64]int64, msg WSMessage) {
+	for memberID, seq := range seqs {
+		msg.Seq = seq
+		h.conns.deliver(memberID, msg, nil)
+	}
+}
+
+func (h *memoryHub) IsOnline(userID int64) bool {
+	return h.conns.has(userID)
+}
+
+func (h *memoryHub) OnlineUsers() []int64 {
+	return h.conns.userIDs()
+}
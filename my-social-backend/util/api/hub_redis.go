@@ -0,0 +1,295 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/pkg/resp"
+)
+
+// The redis hub shares messages and presence between instances through a
+// Redis-compatible broker:
+//
+//   - every message is published once on hubChannel; each instance delivers it to
+//     the targeted users' connections it holds (the publisher delivers its own
+//     directly and skips the echo);
+//   - hubInstancesKey is a hash of instance ID -> unix time of its last heartbeat;
+//   - hubPresenceKey(instance) is a hash whose fields are the IDs of the users
+//     connected to that instance. Every heartbeat brings it in line with the
+//     local connections and it expires if the instance stops, so a crashed
+//     instance's users go offline on their own.
+//
+// Messages published while an instance's subscription is down are lost to it;
+// its clients catch up with resume, like after any reconnect.
+const (
+	hubChannel      = "ws:deliver"
+	hubInstancesKey = "ws:instances"
+	// hubHeartbeat is how often an instance refreshes its presence.
+	hubHeartbeat = 10 * time.Second
+	// hubInstanceTTL is how long an instance counts as alive after a heartbeat.
+	hubInstanceTTL = 3 * hubHeartbeat
+	// hubInstanceCacheTTL is how long the list of live instances is reused.
+	hubInstanceCacheTTL = 5 * time.Second
+)
+
+func hubPresenceKey(instance string) string {
+	return "ws:presence:" + instance
+}
+
+// hubDelivery is a message as published on hubChannel.
+type hubDelivery struct {
+	Origin  string          `json:"origin"`
+	GroupID int64           `json:"group_id,omitempty"`
+	Seqs    map[int64]int64 `json:"seqs"` // target user ID -> seq of the message for them
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type redisHub struct {
+	conns    *localConnections
+	client   *resp.Client
+	instance string
+
+	// presenceMu orders this instance's presence writes, so a heartbeat's
+	// snapshot can't undo a concurrent Register or Unregister
+	presenceMu sync.Mutex
+
+	instancesMu     sync.Mutex
+	instances       []string // other live instances
+	instancesLoaded time.Time
+}
+
+func newRedisHub(cfg config.HubConfig, conns *localConnections) (*redisHub, error) {
+	if cfg.RedisAddr == "" || cfg.InstanceID == "" {
+		return nil, fmt.Errorf("hub: the redis backend needs an address and an instance ID")
+	}
+	h := &redisHub{
+		conns:    conns,
+		client:   resp.NewClient(cfg.RedisAddr, cfg.RedisPassword),
+		instance: cfg.InstanceID,
+	}
+	if _, err := h.client.Do("PING"); err != nil {
+		return nil, fmt.Errorf("hub: cannot reach broker at %s: %w", cfg.RedisAddr, err)
+	}
+	h.heartbeat()
+	go h.heartbeatLoop()
+	go h.subscribeLoop()
+	log.Printf("Hub: instance %s using broker at %s", h.instance, cfg.RedisAddr)
+	return h, nil
+}
+
+func (h *redisHub) Register(userID int64, client *realtimeConn) bool {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	if !h.conns.add(userID, client) {
+		return false
+	}
+	key := hubPresenceKey(h.instance)
+	if _, err := h.client.Do("HSET", key, strconv.FormatInt(userID, 10), "1"); err != nil {
+		log.Printf("Hub: error recording user %d as online: %v", userID, err)
+	}
+	h.client.Do("EXPIRE", key, strconv.Itoa(int(hubInstanceTTL.Seconds())))
+	return !h.onlineElsewhere(userID)
+}
+
+func (h *redisHub) Unregister(userID int64, client *realtimeConn) bool {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	if !h.conns.remove(userID, client) {
+		return false
+	}
+	if _, err := h.client.Do("HDEL", hubPresenceKey(h.instance), strconv.FormatInt(userID, 10)); err != nil {
+		log.Printf("Hub: error recording user %d as offline: %v", userID, err)
+	}
+	return !h.onlineElsewhere(userID)
+}
+
+func (h *redisHub) PublishToUser(userID int64, msg WSMessage, except *realtimeConn) {
+	h.conns.deliver(userID, msg, except)
+	h.publish(0, map[int64]int64{userID: msg.Seq}, msg)
+}
+
+func (h *redisHub) PublishToGroup(groupID int64, seqs map[int64]int64, msg WSMessage) {
+	for memberID, seq := range seqs {
+		msg.Seq = seq
+		h.conns.deliver(memberID, msg, nil)
+	}
+	h.publish(groupID, seqs, msg)
+}
+
+func (h *redisHub) IsOnline(userID int64) bool {
+	return h.conns.has(userID) || h.onlineElsewhere(userID)
+}
+
+func (h *redisHub) OnlineUsers() []int64 {
+	seen := make(map[int64]bool)
+	userIDs := h.conns.userIDs()
+	for _, userID := range userIDs {
+		seen[userID] = true
+	}
+	for _, instance := range h.liveInstances() {
+		fields, err := resp.Strings(h.client.Do("HKEYS", hubPresenceKey(instance)))
+		if err != nil {
+			log.Printf("Hub: error loading users of instance %s: %v", instance, err)
+			continue
+		}
+		for _, field := range fields {
+			userID, err := strconv.ParseInt(field, 10, 64)
+			if err == nil && !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+	return userIDs
+}
+
+// onlineElsewhere reports whether userID is connected to another live instance.
+func (h *redisHub) onlineElsewhere(userID int64) bool {
+	field := strconv.FormatInt(userID, 10)
+	for _, instance := range h.liveInstances() {
+		exists, err := resp.Int(h.client.Do("HEXISTS", hubPresenceKey(instance), field))
+		if err != nil {
+			log.Printf("Hub: error checking user %d on instance %s: %v", userID, instance, err)
+			continue
+		}
+		if exists == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// liveInstances returns the other instances that sent a heartbeat recently.
+// Instances that stopped are removed from the registry on the way.
+func (h *redisHub) liveInstances() []string {
+	h.instancesMu.Lock()
+	defer h.instancesMu.Unlock()
+	if time.Since(h.instancesLoaded) < hubInstanceCacheTTL {
+		return h.instances
+	}
+
+	pairs, err := resp.Strings(h.client.Do("HGETALL", hubInstancesKey))
+	if err != nil {
+		log.Printf("Hub: error loading instances: %v", err)
+		return h.instances
+	}
+	cutoff := time.Now().Add(-hubInstanceTTL).Unix()
+	var live []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		instance := pairs[i]
+		if instance == h.instance {
+			continue
+		}
+		lastSeen, err := strconv.ParseInt(pairs[i+1], 10, 64)
+		if err != nil || lastSeen < cutoff {
+			h.client.Do("HDEL", hubInstancesKey, instance)
+			continue
+		}
+		live = append(live, instance)
+	}
+	h.instances = live
+	h.instancesLoaded = time.Now()
+	return live
+}
+
+// heartbeat marks this instance alive and rewrites its presence from the local
+// registry, which repairs it if the broker lost data or a write failed. Users
+// still connected are written before stale ones are removed, so other instances
+// never see them offline in between.
+func (h *redisHub) heartbeat() {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if _, err := h.client.Do("HSET", hubInstancesKey, h.instance, now); err != nil {
+		log.Printf("Hub: heartbeat failed: %v", err)
+		return
+	}
+	key := hubPresenceKey(h.instance)
+	connected := make(map[string]bool)
+	args := []string{"HSET", key}
+	for _, userID := range h.conns.userIDs() {
+		field := strconv.FormatInt(userID, 10)
+		connected[field] = true
+		args = append(args, field, "1")
+	}
+	if len(args) > 2 {
+		if _, err := h.client.Do(args...); err != nil {
+			log.Printf("Hub: error writing presence: %v", err)
+		}
+		h.client.Do("EXPIRE", key, strconv.Itoa(int(hubInstanceTTL.Seconds())))
+	}
+
+	fields, err := resp.Strings(h.client.Do("HKEYS", key))
+	if err != nil {
+		log.Printf("Hub: error reading presence: %v", err)
+		return
+	}
+	stale := []string{"HDEL", key}
+	for _, field := range fields {
+		if !connected[field] {
+			stale = append(stale, field)
+		}
+	}
+	if len(stale) > 2 {
+		if _, err := h.client.Do(stale...); err != nil {
+			log.Printf("Hub: error removing stale presence: %v", err)
+		}
+	}
+}
+
+func (h *redisHub) heartbeatLoop() {
+	ticker := time.NewTicker(hubHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.heartbeat()
+	}
+}
+
+func (h *redisHub) publish(groupID int64, seqs map[int64]int64, msg WSMessage) {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		log.Printf("Hub: error encoding %s message: %v", msg.Type, err)
+		return
+	}
+	payload, err := json.Marshal(hubDelivery{Origin: h.instance, GroupID: groupID, Seqs: seqs, Type: msg.Type, Data: data})
+	if err != nil {
+		log.Printf("Hub: error encoding %s message: %v", msg.Type, err)
+		return
+	}
+	if _, err := h.client.Do("PUBLISH", hubChannel, string(payload)); err != nil {
+		log.Printf("Hub: error publishing %s message: %v", msg.Type, err)
+	}
+}
+
+// subscribeLoop receives the messages other instances publish, resubscribing
+// whenever the connection to the broker drops.
+func (h *redisHub) subscribeLoop() {
+	for {
+		err := h.client.Subscribe(hubChannel, nil, h.receive)
+		log.Printf("Hub: subscription to %s ended: %v; retrying", hubChannel, err)
+		time.Sleep(time.Second)
+	}
+}
+
+func (h *redisHub) receive(payload []byte) {
+	var d hubDelivery
+	if err := json.Unmarshal(payload, &d); err != nil {
+		log.Printf("Hub: ignoring malformed message: %v", err)
+		return
+	}
+	if d.Origin == h.instance {
+		return
+	}
+	msg := WSMessage{Type: d.Type, Data: d.Data}
+	for userID, seq := range d.Seqs {
+		msg.Seq = seq
+		h.conns.deliver(userID, msg, nil)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/models"
+	"reda-social-network/pkg/hubbroker"
+	"reda-social-network/pkg/resp"
+)
+
+// startTestBroker serves an in-memory broker on a local port and returns its
+// address.
+func startTestBroker(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go hubbroker.New().Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+// newTestRedisHubs returns two instances sharing the broker at addr, once both
+// are subscribed to it.
+func newTestRedisHubs(t *testing.T, addr string) (*redisHub, *redisHub) {
+	t.Helper()
+	var hubs []*redisHub
+	for _, instance := range []string{"a", "b"} {
+		h, err := newRedisHub(config.HubConfig{RedisAddr: addr, InstanceID: instance}, newLocalConnections())
+		if err != nil {
+			t.Fatalf("starting instance %s: %v", instance, err)
+		}
+		hubs = append(hubs, h)
+	}
+
+	// An empty delivery targets nobody; PUBLISH counts who got it
+	client := resp.NewClient(addr, "")
+	defer client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n, err := resp.Int(client.Do("PUBLISH", hubChannel, "{}"))
+		if err == nil && n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instances not subscribed: %d subscriber(s), %v", n, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return hubs[0], hubs[1]
+}
+
+func newTestConn(t *testing.T) *realtimeConn {
+	conn := newRealtimeConn("test", nil)
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func TestRedisHubAcrossInstances(t *testing.T) {
+	a, b := newTestRedisHubs(t, startTestBroker(t))
+	const userID = 7
+	onA, onB := newTestConn(t), newTestConn(t)
+
+	if !a.Register(userID, onA) {
+		t.Error("first connection on a: Register reported the user was already online")
+	}
+	if !b.IsOnline(userID) {
+		t.Error("b doesn't see the user connected to a")
+	}
+	if b.Register(userID, onB) {
+		t.Error("connection on b: Register reported the user just came online")
+	}
+	if users := b.OnlineUsers(); len(users) != 1 || users[0] != userID {
+		t.Errorf("b.OnlineUsers() = %v, want [%d]", users, userID)
+	}
+
+	// Each connection gets the message once: directly from a, through the broker on b
+	a.PublishToUser(userID, WSMessage{Type: "new_message", Seq: 3, Data: models.WSNewMessage{ID: 1}}, nil)
+	for name, conn := range map[string]*realtimeConn{"a": onA, "b": onB} {
+		if msg := receive(t, conn); msg.Type != "new_message" || msg.Seq != 3 {
+			t.Errorf("on %s: got %s seq %d, want new_message seq 3", name, msg.Type, msg.Seq)
+		}
+	}
+	b.PublishToGroup(1, map[int64]int64{userID: 4, userID + 1: 9}, WSMessage{Type: "group_message"})
+	for name, conn := range map[string]*realtimeConn{"a": onA, "b": onB} {
+		if msg := receive(t, conn); msg.Type != "group_message" || msg.Seq != 4 {
+			t.Errorf("on %s: got %s seq %d, want group_message seq 4", name, msg.Type, msg.Seq)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if msgs := drain(t, onA); len(msgs) != 0 {
+		t.Errorf("a got %d echoed message(s)", len(msgs))
+	}
+
+	if b.Unregister(userID, onB) {
+		t.Error("closing b's connection: Unregister reported the user went offline")
+	}
+	if !a.Unregister(userID, onA) {
+		t.Error("closing the last connection: Unregister didn't report the user went offline")
+	}
+	if b.IsOnline(userID) || a.IsOnline(userID) {
+		t.Error("the user is still online after closing every connection")
+	}
+}
+
+// A heartbeat drops users no longer connected from the instance's presence but
+// never hides, even briefly, the ones still connected.
+func TestRedisHubHeartbeat(t *testing.T) {
+	addr := startTestBroker(t)
+	a, b := newTestRedisHubs(t, addr)
+	const userID, goneID = 7, 8
+	a.Register(userID, newTestConn(t))
+
+	client := resp.NewClient(addr, "")
+	defer client.Close()
+	if _, err := client.Do("HSET", hubPresenceKey("a"), strconv.Itoa(goneID), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if !b.IsOnline(goneID) {
+		t.Fatal("b doesn't see the stale presence")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			a.heartbeat()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if b.IsOnline(goneID) {
+				t.Error("a user who left is still online after a heartbeat")
+			}
+			if !b.IsOnline(userID) {
+				t.Error("a connected user is offline after a heartbeat")
+			}
+			return
+		default:
+			if !b.onlineElsewhere(userID) {
+				t.Fatal("a connected user went offline during a heartbeat")
+			}
+		}
+	}
+}
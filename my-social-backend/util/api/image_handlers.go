@@ -1,16 +1,31 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
+	"reda-social-network/config"
+	"reda-social-network/database"
 	"reda-social-network/middleware"
+	"reda-social-network/models"
+	"reda-social-network/pkg/media"
+	"reda-social-network/pkg/storage"
+)
+
+// Variants generated for every uploaded image.
+const (
+	variantThumbnail = "thumbnail"
+	variantMedium    = "medium"
 )
 
 // ImageUploadHandler handles image uploads for posts
@@ -27,84 +42,198 @@ func ImageUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form (32MB max memory)
-	err := r.ParseMultipartForm(32 << 20) // 32 MB
-	if err != nil {
-		http.Error(w, "Error parsing multipart form: "+err.Error(), http.StatusBadRequest)
+	processed := readImageUpload(w, r, "image")
+	if processed == nil {
 		return
 	}
 
-	// Get the file from form data
-	file, header, err := r.FormFile("image")
+	upload := storeUpload(w, r, userID, mediaKindPost, processed)
+	if upload == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// readImageUpload reads the image in the given multipart field and processes it.
+// It writes the error response itself and returns nil on failure.
+func readImageUpload(w http.ResponseWriter, r *http.Request, field string) *media.Processed {
+	limits := config.App.Media
+
+	// Leave some room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxUploadBytes+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Upload exceeds the %d byte limit", limits.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+			return nil
+		}
+		http.Error(w, "Error parsing multipart form: "+err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	file, header, err := r.FormFile(field)
 	if err != nil {
 		http.Error(w, "Error retrieving file: "+err.Error(), http.StatusBadRequest)
-		return
+		return nil
 	}
 	defer file.Close()
 
-	// Validate file type
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
+	if header.Size > limits.MaxUploadBytes {
+		http.Error(w, fmt.Sprintf("Upload exceeds the %d byte limit", limits.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return nil
 	}
-
-	contentType := header.Header.Get("Content-Type")
-	if !allowedTypes[contentType] {
-		http.Error(w, "Invalid file type. Only JPEG, PNG, and GIF are allowed.", http.StatusBadRequest)
-		return
+	data, err := io.ReadAll(io.LimitReader(file, limits.MaxUploadBytes+1))
+	if err != nil {
+		http.Error(w, "Error reading file: "+err.Error(), http.StatusBadRequest)
+		return nil
 	}
 
-	// Validate file extension
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	allowedExts := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
+	// The type is taken from the file's content; the client's Content-Type and
+	// file name are ignored
+	processed, err := media.Process(data,
+		media.Limits{
+			MaxBytes:       limits.MaxUploadBytes,
+			MaxPixels:      limits.MaxPixels,
+			MaxFrames:      limits.MaxGIFFrames,
+			MaxTotalPixels: limits.MaxGIFPixels,
+		},
+		[]media.VariantSpec{
+			{Name: variantThumbnail, MaxSize: limits.ThumbnailSize},
+			{Name: variantMedium, MaxSize: limits.MediumSize},
+		},
+	)
+	switch {
+	case err == nil:
+		return processed
+	case errors.Is(err, media.ErrTooLarge):
+		http.Error(w, fmt.Sprintf("Upload exceeds the %d byte limit", limits.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, media.ErrTooManyPixels):
+		http.Error(w, fmt.Sprintf("Image exceeds the %d pixel limit (%d across all frames of an animated GIF)", limits.MaxPixels, limits.MaxGIFPixels), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, media.ErrTooManyFrames):
+		http.Error(w, fmt.Sprintf("Animated GIF exceeds the %d frame limit", limits.MaxGIFFrames), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, media.ErrUnsupportedFormat), errors.Is(err, media.ErrInvalidImage):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Error processing %s upload: %v", field, err)
+		http.Error(w, "Error processing image", http.StatusInternalServerError)
 	}
+	return nil
+}
 
-	if !allowedExts[ext] {
-		http.Error(w, "Invalid file extension. Only .jpg, .jpeg, .png, and .gif are allowed.", http.StatusBadRequest)
-		return
+// storeUpload writes a processed upload and its variants to the media store and
+// records it, unreferenced, for userID. Names are derived from the uploader and the
+// content hash, so they never collide and uploading the same image again returns the
+// existing record, whose grace period restarts if it is unused. Uploads that would exceed the user's storage quota are refused
+// with a 413. It writes the error response itself and returns nil on failure.
+func storeUpload(w http.ResponseWriter, r *http.Request, userID int64, kind string, processed *media.Processed) *models.MediaUploadResponse {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", userID, processed.Hash)))
+	base := mediaDirs[kind] + "/" + hex.EncodeToString(sum[:16])
+
+	upload := &models.MediaUploadResponse{
+		ImagePath:   storage.Media.URL(base + processed.Ext),
+		MimeType:    processed.MimeType,
+		Width:       processed.Width,
+		Height:      processed.Height,
+		SizeBytes:   int64(len(processed.Data)),
+		ContentHash: processed.Hash,
+	}
+	storageBytes := upload.SizeBytes
+	variants := make(map[string]*models.MediaVariant)
+	for _, variant := range processed.Variants {
+		storageBytes += int64(len(variant.Data))
+		variants[variant.Name] = &models.MediaVariant{
+			ImagePath: storage.Media.URL(base + "_" + variant.Name + variant.Ext),
+			Width:     variant.Width,
+			Height:    variant.Height,
+		}
+	}
+	upload.Thumbnail = variants[variantThumbnail]
+	upload.Medium = variants[variantMedium]
+
+	err := database.DB.QueryRow("SELECT id, created_at FROM media_uploads WHERE file_path = ?", upload.ImagePath).Scan(&upload.ID, &upload.CreatedAt)
+	if err == nil {
+		// An unused copy restarts its grace period, or the sweeper could delete it
+		// before the client attaches it. If the sweeper got to it first, it is
+		// stored again below.
+		result, err := database.DB.Exec(
+			"UPDATE media_uploads SET unreferenced_since = CASE WHEN ref_count <= 0 THEN ? ELSE unreferenced_since END WHERE id = ?",
+			time.Now().UTC(), upload.ID,
+		)
+		if err != nil {
+			log.Printf("Error refreshing upload %s: %v", upload.ImagePath, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			return upload
+		}
+		upload.ID, upload.CreatedAt = 0, time.Time{}
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error looking up upload %s: %v", upload.ImagePath, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
 	}
 
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "./uploads/posts"
-	err = os.MkdirAll(uploadsDir, os.ModePerm)
+	used, err := storageUsedBy(userID)
 	if err != nil {
-		http.Error(w, "Error creating uploads directory: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Error creating uploads directory: %v", err)
-		return
+		log.Printf("Error computing storage used by user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+	if quota := config.App.Media.UserQuotaBytes; used+storageBytes > quota {
+		http.Error(w, fmt.Sprintf("Storage quota exceeded: this upload needs %d bytes but only %d of your %d bytes are free. Delete some posts or photos to make room.",
+			storageBytes, max(quota-used, 0), quota), http.StatusRequestEntityTooLarge)
+		return nil
 	}
 
-	// Generate unique filename
-	timestamp := time.Now().Unix()
-	filename := fmt.Sprintf("%d_%d%s", userID, timestamp, ext)
-	filePath := filepath.Join(uploadsDir, filename)
-
-	// Create the file on server
-	dst, err := os.Create(filePath)
-	if err != nil {
-		http.Error(w, "Error creating file: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Error creating file: %v", err)
-		return
+	put := func(url string, img media.Image) error {
+		return storage.Media.Put(r.Context(), storage.KeyForURL(storage.Media, url), bytes.NewReader(img.Data), int64(len(img.Data)), img.MimeType)
+	}
+	if err := put(upload.ImagePath, processed.Image); err != nil {
+		log.Printf("Error storing upload %s: %v", upload.ImagePath, err)
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return nil
+	}
+	for _, variant := range processed.Variants {
+		if err := put(variants[variant.Name].ImagePath, variant.Image); err != nil {
+			log.Printf("Error storing %s variant of %s: %v", variant.Name, upload.ImagePath, err)
+			http.Error(w, "Error saving file", http.StatusInternalServerError)
+			return nil
+		}
 	}
-	defer dst.Close()
 
-	// Copy uploaded file to destination
-	_, err = io.Copy(dst, file)
+	// New uploads start unreferenced; the sweeper removes them if they are never used
+	upload.CreatedAt = time.Now()
+	result, err := database.DB.Exec(`
+        INSERT INTO media_uploads (user_id, kind, file_path, mime_type, width, height, size_bytes, storage_bytes, content_hash,
+                                   thumbnail_path, medium_path, ref_count, unreferenced_since, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
+    `, userID, kind, upload.ImagePath, upload.MimeType, upload.Width, upload.Height, upload.SizeBytes, storageBytes, upload.ContentHash,
+		upload.Thumbnail.ImagePath, upload.Medium.ImagePath, upload.CreatedAt.UTC(), upload.CreatedAt)
+	if err == nil {
+		upload.ID, err = result.LastInsertId()
+	}
 	if err != nil {
-		http.Error(w, "Error saving file: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Error saving file: %v", err)
-		return
+		log.Printf("Error recording upload %s: %v", upload.ImagePath, err)
+		http.Error(w, "Error recording upload", http.StatusInternalServerError)
+		return nil
 	}
+	return upload
+}
 
-	// Return the file path (relative to server root)
-	relativePath := fmt.Sprintf("/uploads/posts/%s", filename)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"image_path": "%s"}`, relativePath)
+// deleteStoredMedia removes objects from the media store by URL. Missing objects are
+// not an error; other failures are logged, since the database no longer refers to them.
+func deleteStoredMedia(ctx context.Context, urls ...string) {
+	for _, url := range urls {
+		key := storage.KeyForURL(storage.Media, url)
+		if key == "" {
+			continue
+		}
+		if err := storage.Media.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting stored media %s: %v", key, err)
+		}
+	}
 }
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/database"
+	"reda-social-network/pkg/media"
+	"reda-social-network/pkg/storage"
+)
+
+func testProcessedImage() *media.Processed {
+	image := func(data string) media.Image {
+		return media.Image{Data: []byte(data), MimeType: "image/png", Ext: ".png", Width: 1, Height: 1}
+	}
+	return &media.Processed{
+		Image: image("original"),
+		Hash:  "abc123",
+		Variants: []media.Variant{
+			{Name: variantThumbnail, Image: image("thumbnail")},
+			{Name: variantMedium, Image: image("medium")},
+		},
+	}
+}
+
+// Uploading an image again while its unused copy waits for the sweeper hands the
+// copy out with a new grace period, so the sweeper doesn't delete it under the
+// client.
+func TestStoreUploadDuplicateRestartsGracePeriod(t *testing.T) {
+	newTestDB(t)
+	useTestMediaStore(t)
+	userID := createTestUser(t, "uploader")
+
+	store := func() int64 {
+		t.Helper()
+		w := httptest.NewRecorder()
+		upload := storeUpload(w, httptest.NewRequest("POST", "/upload", nil), userID, mediaKindPost, testProcessedImage())
+		if upload == nil {
+			t.Fatalf("storeUpload failed: %d %s", w.Code, w.Body)
+		}
+		return upload.ID
+	}
+	first := store()
+
+	// The first copy was never attached and its grace period is over
+	expired := time.Now().UTC().Add(-config.App.Media.OrphanTTL - time.Hour)
+	database.DB.Exec("UPDATE media_uploads SET unreferenced_since = ? WHERE id = ?", expired, first)
+
+	if again := store(); again != first {
+		t.Errorf("uploading again returned upload %d, want the existing %d", again, first)
+	}
+	sweepOrphanedUploads()
+
+	var exists bool
+	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM media_uploads WHERE id = ?)", first).Scan(&exists)
+	if !exists {
+		t.Fatal("the sweeper deleted the upload just handed out again")
+	}
+	var path string
+	database.DB.QueryRow("SELECT file_path FROM media_uploads WHERE id = ?", first).Scan(&path)
+	obj, err := storage.Media.Get(context.Background(), storage.KeyForURL(storage.Media, path))
+	if err != nil {
+		t.Fatalf("the stored file is gone: %v", err)
+	}
+	obj.Body.Close()
+}
@@ -49,6 +49,17 @@ func ToggleLikePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Posts the user can't see (including unpublished ones) can't be reacted to
+	visible, err := canViewPost(postID, userID)
+	if err != nil {
+		http.Error(w, "Error checking post visibility: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
 	// Check if the user has already liked/disliked this post
 	var existingLikeID int64
 	var existingIsLike bool
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"reda-social-network/pkg/storage"
+	"reda-social-network/util"
+)
+
+// Cache policies for served media. Avatar names are unique per upload, so avatars
+// never change and can be cached anywhere. Post media is only cached by the viewer's
+// own browser, briefly, since access depends on who is asking and can be revoked.
+const (
+	publicMediaCacheControl  = "public, max-age=31536000, immutable"
+	privateMediaCacheControl = "private, max-age=300"
+)
+
+// ServeMediaHandler serves uploaded media from the media store. Avatars are public;
+// post media is only served to users who can see a post or group post it is attached
+// to (or who uploaded it), and everyone else gets a 404.
+// Supports Range requests and conditional requests via ETag / Last-Modified.
+// GET /uploads/{key...}
+func ServeMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	switch {
+	case strings.HasPrefix(key, "avatars/"):
+		w.Header().Set("Cache-Control", publicMediaCacheControl)
+	case strings.HasPrefix(key, "posts/"):
+		viewerID, _ := util.GetUserIDFromRequest(r)
+		if viewerID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		allowed, err := canViewMedia(storage.Media.URL(key), viewerID)
+		if err != nil {
+			log.Printf("Error checking access to media %s for user %d: %v", key, viewerID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", privateMediaCacheControl)
+		w.Header().Add("Vary", "Cookie")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	object, err := storage.Media.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		w.Header().Del("Cache-Control")
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading media %s: %v", key, err)
+		w.Header().Del("Cache-Control")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer object.Body.Close()
+
+	// http.ServeContent needs to seek to serve ranges; remote objects are small
+	// images, so they are buffered
+	content, ok := object.Body.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(object.Body)
+		if err != nil {
+			log.Printf("Error reading media %s: %v", key, err)
+			w.Header().Del("Cache-Control")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+	if object.ETag != "" {
+		w.Header().Set("ETag", object.ETag)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, path.Base(key), object.ModTime, content)
+}
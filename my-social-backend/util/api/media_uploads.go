@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/database"
+)
+
+// Kinds of upload, stored in media_uploads.kind.
+const (
+	mediaKindPost   = "post"
+	mediaKindAvatar = "avatar"
+)
+
+// mediaDirs maps each kind of upload to the media store directory it is kept in.
+var mediaDirs = map[string]string{
+	mediaKindPost:   "posts",
+	mediaKindAvatar: "avatars",
+}
+
+// orphanSweepInterval is how often unreferenced uploads are looked for.
+const orphanSweepInterval = time.Hour
+
+// storageUsedBy returns the bytes taken by userID's uploads, variants included.
+func storageUsedBy(userID int64) (int64, error) {
+	var used int64
+	err := database.DB.QueryRow("SELECT COALESCE(SUM(storage_bytes), 0) FROM media_uploads WHERE user_id = ?", userID).Scan(&used)
+	return used, err
+}
+
+// errMediaGone is returned by retainMedia when the upload was deleted, such as by
+// the orphan sweeper, after it was looked up.
+var errMediaGone = errors.New("upload no longer exists")
+
+// retainMedia records one more reference to an upload. It fails with errMediaGone
+// if the upload no longer exists.
+func retainMedia(ex sqlExecer, mediaID int64) error {
+	res, err := ex.Exec("UPDATE media_uploads SET ref_count = ref_count + 1, unreferenced_since = NULL WHERE id = ?", mediaID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return errMediaGone
+	}
+	return nil
+}
+
+// releaseMedia drops one reference to an upload, starting its grace period when it
+// becomes unused.
+func releaseMedia(ex sqlExecer, mediaID int64) error {
+	_, err := ex.Exec(`
+        UPDATE media_uploads
+        SET ref_count = ref_count - 1,
+            unreferenced_since = CASE WHEN ref_count <= 1 THEN ? ELSE unreferenced_since END
+        WHERE id = ? AND ref_count > 0
+    `, time.Now().UTC(), mediaID)
+	return err
+}
+
+// avatarUploadID returns the id of userID's avatar upload stored at url, or 0 if the
+// URL is not one of their recorded avatar uploads (such as an external URL).
+func avatarUploadID(userID int64, url string) (int64, error) {
+	if url == "" {
+		return 0, nil
+	}
+	var mediaID int64
+	err := database.DB.QueryRow(
+		"SELECT id FROM media_uploads WHERE file_path = ? AND user_id = ? AND kind = ?",
+		url, userID, mediaKindAvatar,
+	).Scan(&mediaID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return mediaID, err
+}
+
+// replaceAvatarReference moves userID's avatar reference from oldURL to newURL and
+// deletes the old avatar upload right away if nothing else uses it.
+func replaceAvatarReference(ctx context.Context, userID int64, oldURL, newURL string) {
+	if oldURL == newURL {
+		return
+	}
+	newID, err := avatarUploadID(userID, newURL)
+	if err == nil && newID != 0 {
+		err = retainMedia(database.DB, newID)
+	}
+	if err != nil {
+		log.Printf("Error retaining avatar %s for user %d: %v", newURL, userID, err)
+	}
+
+	oldID, err := avatarUploadID(userID, oldURL)
+	if err == nil && oldID != 0 {
+		if err = releaseMedia(database.DB, oldID); err == nil {
+			removeUnreferencedMedia(ctx, []int64{oldID})
+		}
+	}
+	if err != nil {
+		log.Printf("Error releasing avatar %s for user %d: %v", oldURL, userID, err)
+	}
+}
+
+// removeUnreferencedMedia deletes the given uploads, record and stored files, if
+// nothing references them any more.
+func removeUnreferencedMedia(ctx context.Context, mediaIDs []int64) {
+	removeMediaUnreferencedSince(ctx, mediaIDs, time.Now().UTC())
+}
+
+// removeMediaUnreferencedSince is removeUnreferencedMedia for uploads unreferenced
+// since cutoff or earlier; the others are kept.
+func removeMediaUnreferencedSince(ctx context.Context, mediaIDs []int64, cutoff time.Time) {
+	for _, mediaID := range mediaIDs {
+		var filePath string
+		var thumbnailPath, mediumPath sql.NullString
+		err := database.DB.QueryRow(
+			"SELECT file_path, thumbnail_path, medium_path FROM media_uploads WHERE id = ? AND ref_count <= 0",
+			mediaID,
+		).Scan(&filePath, &thumbnailPath, &mediumPath)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error loading upload %d for cleanup: %v", mediaID, err)
+			continue
+		}
+
+		// The guard keeps uploads that were attached or uploaded again in the meantime
+		result, err := database.DB.Exec(
+			"DELETE FROM media_uploads WHERE id = ? AND ref_count <= 0 AND (unreferenced_since IS NULL OR unreferenced_since <= ?)",
+			mediaID, cutoff,
+		)
+		if err != nil {
+			log.Printf("Error deleting upload %d: %v", mediaID, err)
+			continue
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			continue
+		}
+		deleteStoredMedia(ctx, filePath, thumbnailPath.String, mediumPath.String)
+	}
+}
+
+// sweepOrphanedUploads deletes uploads that have been unreferenced for longer than
+// the configured grace period, such as images uploaded for a post that was never made.
+func sweepOrphanedUploads() {
+	cutoff := time.Now().UTC().Add(-config.App.Media.OrphanTTL)
+	rows, err := database.DB.Query(
+		"SELECT id FROM media_uploads WHERE ref_count <= 0 AND unreferenced_since IS NOT NULL AND unreferenced_since <= ?",
+		cutoff,
+	)
+	if err != nil {
+		log.Printf("Upload sweeper: error querying orphaned uploads: %v", err)
+		return
+	}
+
+	var orphanIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			orphanIDs = append(orphanIDs, id)
+		}
+	}
+	rows.Close()
+
+	if len(orphanIDs) > 0 {
+		removeMediaUnreferencedSince(context.Background(), orphanIDs, cutoff)
+		log.Printf("Upload sweeper: removed %d orphaned upload(s)", len(orphanIDs))
+	}
+}
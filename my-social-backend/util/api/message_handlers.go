@@ -2,8 +2,9 @@ package api
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -15,6 +16,12 @@ import (
 	"reda-social-network/models"
 )
 
+// Page sizes of GET /conversations.
+const (
+	defaultConversationLimit = 20
+	maxConversationLimit     = 100
+)
+
 // CheckFollowRelationship checks if users can message each other
 func checkCanMessage(userID, otherUserID int64) (bool, error) {
 	var count int
@@ -62,14 +69,16 @@ func checkShouldReceiveInstantMessage(senderID, receiverID int64) (bool, error)
 }
 
 // POST /messages/{receiverID} - Send a message
-// POST /messages/{receiverID} - Send a message
-// Now uses private_messages table only
+// The rules and delivery are MessagingService's, shared with the WebSocket
 func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	senderID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok || senderID == 0 {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !allowRESTSend(w, senderID, rateDirectMessage) {
+		return
+	}
 
 	receiverIDStr := r.PathValue("receiverID")
 	receiverID, err := strconv.ParseInt(receiverIDStr, 10, 64)
@@ -78,210 +87,61 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if senderID == receiverID {
-		http.Error(w, "Cannot send message to yourself", http.StatusBadRequest)
-		return
-	}
-
-	// Check if receiver exists
-	var receiverExists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", receiverID).Scan(&receiverExists)
-	if err != nil || !receiverExists {
-		http.Error(w, "Receiver not found", http.StatusNotFound)
-		return
-	}
-
-	// Check if users can message each other
-	canMessage, err := checkCanMessage(senderID, receiverID)
-	if err != nil {
-		http.Error(w, "Database error checking follow relationship", http.StatusInternalServerError)
-		return
-	}
-	if !canMessage {
-		http.Error(w, "You can only message users you follow or who follow you", http.StatusForbidden)
-		return
-	}
-
 	var req models.SendMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if req.Content == "" {
-		http.Error(w, "Message content cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	now := time.Now()
-
-	// Start transaction
-	tx, err := database.DB.Begin()
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
-	// Insert message
-	res, err := tx.Exec(`
-		INSERT INTO private_messages (sender_id, receiver_id, content, created_at)
-		VALUES (?, ?, ?, ?)
-	`, senderID, receiverID, req.Content, now)
-	if err != nil {
-		http.Error(w, "Failed to send message", http.StatusInternalServerError)
-		return
-	}
-	messageID, _ := res.LastInsertId()
 
-	// Update or create conversation
-	user1ID, user2ID := senderID, receiverID
-	if user1ID > user2ID {
-		user1ID, user2ID = user2ID, user1ID
-	}
-
-	_, err = tx.Exec(`
-		INSERT INTO conversations (user1_id, user2_id, last_message_id, updated_at)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(user1_id, user2_id) DO UPDATE SET
-		last_message_id = excluded.last_message_id,
-		updated_at = excluded.updated_at
-	`, user1ID, user2ID, messageID, now)
+	sent, err := NewMessagingService(database.DB).SendDirectMessage(senderID, receiverID, req.Content, nil)
 	if err != nil {
-		http.Error(w, "Failed to update conversation", http.StatusInternalServerError)
-		return
-	}
-
-	if err = tx.Commit(); err != nil {
-		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
-		return
-	}
-
-	// Get sender username and avatar for the broadcast, using COALESCE for avatar
-	var senderUsername, senderAvatar string
-	err = database.DB.QueryRow("SELECT username, COALESCE(avatar, '') FROM users WHERE id = ?", senderID).Scan(&senderUsername, &senderAvatar)
-	if err != nil {
-		log.Printf("Error getting sender username/avatar: %v", err)
-		senderUsername = "Unknown"
-		senderAvatar = ""
-	}
-	// Ensure avatar URL is absolute if needed
-	if senderAvatar != "" && !strings.HasPrefix(senderAvatar, "http") {
-		senderAvatar = fmt.Sprintf("http://localhost:8080/%s", strings.TrimLeft(senderAvatar, "/"))
-	}
-
-	// Create message response for broadcasts, now including sender_avatar
-	messageResponse := map[string]interface{}{
-		"id":                messageID,
-		"sender_id":         senderID,
-		"receiver_id":       receiverID,
-		"sender_username":   senderUsername,
-		"sender_avatar":     senderAvatar,
-		"content":           req.Content,
-		"is_read":           false,
-		"created_at":        now,
-		"is_sent_by_viewer": false,
-	}
-
-	// 1. MESSAGE DELIVERY CONFIRMATION
-	// Check if receiver is online for delivery status
-	isReceiverOnline := IsUserOnline(receiverID)
-	log.Printf("Message delivery status - Receiver %d online: %v", receiverID, isReceiverOnline)
-
-	// 2. REAL-TIME MESSAGE DELIVERY
-	// Check if receiver should get instant message based on rules:
-	// - Receiver is following sender, OR
-	// - Receiver has public profile
-	shouldReceiveInstant, err := checkShouldReceiveInstantMessage(senderID, receiverID)
-	if err != nil {
-		log.Printf("Error checking instant message delivery rules: %v", err)
-		shouldReceiveInstant = false // Default to not delivering instantly on error
-	}
-	log.Printf("Message delivery rules - Should receive instant: %v", shouldReceiveInstant)
-
-	// Broadcast to receiver if online AND should receive instant messages
-	if isReceiverOnline && shouldReceiveInstant {
-		log.Printf("Sending instant message to user %d", receiverID)
-		BroadcastToUser(receiverID, "new_message", messageResponse)
-
-		// Send delivery confirmation to sender
-		BroadcastToUser(senderID, "message_delivered", map[string]interface{}{
-			"message_id":   messageID,
-			"delivered_to": receiverID,
-			"delivered_at": now,
-			"status":       "delivered",
-		})
-
-		// NOTE: Do NOT send popup notification for instant messages to avoid duplication
-		// The frontend will handle popups appropriately when receiving new_message
-	} else {
-		// 3. OFFLINE MESSAGE NOTIFICATION OR DELIVERY DELAYED
-		// Send popup notification via WebSocket for offline users or delayed delivery
-		var notificationMessage string
-		if !shouldReceiveInstant {
-			notificationMessage = fmt.Sprintf("You have a new message from %s (delayed delivery)", senderUsername)
+		var merr *MessagingError
+		if errors.As(err, &merr) {
+			http.Error(w, merr.Message, merr.Status)
 		} else {
-			notificationMessage = fmt.Sprintf("You have a new message from %s", senderUsername)
-		}
-
-		// Get sender username and avatar for popup notification, using COALESCE for avatar
-		var senderUsernamePopup, senderAvatarPopup string
-		err = database.DB.QueryRow("SELECT username, COALESCE(avatar, '') FROM users WHERE id = ?", senderID).Scan(&senderUsernamePopup, &senderAvatarPopup)
-		if err != nil {
-			log.Printf("Error getting sender username/avatar for popup: %v", err)
-			senderUsernamePopup = senderUsername // fallback
-			senderAvatarPopup = ""
-		}
-		// If avatar is a base64 data URL, use as is; otherwise, ensure absolute URL if needed
-		if senderAvatarPopup != "" && !strings.HasPrefix(senderAvatarPopup, "http") && !strings.HasPrefix(senderAvatarPopup, "data:image/") {
-			senderAvatarPopup = fmt.Sprintf("http://localhost:8080/%s", strings.TrimLeft(senderAvatarPopup, "/"))
+			http.Error(w, "Failed to send message", http.StatusInternalServerError)
 		}
-		// Debug log for avatar value used in popup
-		log.Printf("Popup sender avatar for user %d: %s", senderID, senderAvatarPopup)
-		// Send popup message notification via WebSocket (separate from general notifications)
-		log.Printf("Sending popup notification to user %d for offline/delayed message", receiverID)
-		BroadcastToUser(receiverID, "new_message_popup", map[string]interface{}{
-			"sender_id":       senderID,
-			"sender_username": senderUsernamePopup,
-			"sender_avatar":   senderAvatarPopup,
-			"message":         notificationMessage,
-			"message_id":      messageID,
-			"content":         req.Content,
-			"created_at":      now,
-		})
-	}
-
-	// 3. CONVERSATION LIST UPDATE
-	// Broadcast conversation update to receiver
-	BroadcastToUser(receiverID, "conversation_updated", map[string]interface{}{
-		"sender_id":       senderID,
-		"sender_username": senderUsername,
-		"last_message":    req.Content,
-		"message_time":    now,
-		"unread_count":    1, // Increment unread count
-	})
-
-	// Response to sender
-	deliveryInfo := "sent"
-	if isReceiverOnline && shouldReceiveInstant {
-		deliveryInfo = "delivered_instantly"
-	} else if isReceiverOnline && !shouldReceiveInstant {
-		deliveryInfo = "delivered_delayed"
-	} else {
-		deliveryInfo = "offline_notification_created"
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message_id":       messageID,
+		"message_id":       sent.ID,
 		"message":          "Message sent successfully",
-		"delivery_status":  deliveryInfo,
-		"delivered":        isReceiverOnline && shouldReceiveInstant,
-		"instant_delivery": shouldReceiveInstant,
+		"delivery_status":  sent.DeliveryStatus(),
+		"delivered":        sent.Online && sent.Instant,
+		"instant_delivery": sent.Instant,
 	})
 }
 
-// GET /conversations - Get all conversations for the authenticated user
+// encodeConversationCursor and decodeConversationCursor convert the position
+// after the last conversation of a page to and from the opaque cursor handed to
+// clients. Conversations are ordered by their last message, then by ID.
+func encodeConversationCursor(lastMessageID, conversationID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(lastMessageID, 10) + ":" + strconv.FormatInt(conversationID, 10)))
+}
+
+func decodeConversationCursor(cursor string) (int64, int64, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, false
+	}
+	lastStr, idStr, found := strings.Cut(string(raw), ":")
+	if !found {
+		return 0, 0, false
+	}
+	lastMessageID, err1 := strconv.ParseInt(lastStr, 10, 64)
+	conversationID, err2 := strconv.ParseInt(idStr, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return lastMessageID, conversationID, true
+}
+
+// GET /conversations?cursor=&limit=20 - The user's conversations, most recent first
+// Served from the conversations table, whose counters are kept up to date by
+// MessagingService on every send and read
 func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok || userID == 0 {
@@ -289,26 +149,47 @@ func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `
-        SELECT c.id, c.user1_id, c.user2_id, c.last_message_id, c.updated_at,
-               u.username, COALESCE(u.avatar, '') as avatar,
-               COALESCE(pm.content, '') as last_message_content,
-               COALESCE(pm.created_at, c.updated_at) as last_message_time,
-               COALESCE(unread.count, 0) as unread_count
-        FROM conversations c
-        JOIN users u ON (CASE WHEN c.user1_id = ? THEN c.user2_id ELSE c.user1_id END) = u.id
-        LEFT JOIN private_messages pm ON c.last_message_id = pm.id
-        LEFT JOIN (
-            SELECT receiver_id, sender_id, COUNT(*) as count
-            FROM private_messages
-            WHERE receiver_id = ? AND is_read = FALSE
-            GROUP BY sender_id
-        ) unread ON unread.sender_id = (CASE WHEN c.user1_id = ? THEN c.user2_id ELSE c.user1_id END)
-        WHERE c.user1_id = ? OR c.user2_id = ?
-        ORDER BY c.updated_at DESC
-    `
+	query := r.URL.Query()
+	limit := defaultConversationLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxConversationLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxConversationLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	cursorCond := ""
+	var cursorArgs []interface{}
+	if cursor := query.Get("cursor"); cursor != "" {
+		lastMessageID, conversationID, ok := decodeConversationCursor(cursor)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursorCond = "AND (COALESCE(c.last_message_id, 0) < ? OR (COALESCE(c.last_message_id, 0) = ? AND c.id < ?))"
+		cursorArgs = []interface{}{lastMessageID, lastMessageID, conversationID}
+	}
 
-	rows, err := database.DB.Query(query, userID, userID, userID, userID, userID)
+	sqlQuery := `
+        SELECT c.id, COALESCE(c.last_message_id, 0), c.updated_at,
+               CASE WHEN c.user1_id = ? THEN c.user1_unread_count ELSE c.user2_unread_count END,
+               CASE WHEN c.user1_id = ? THEN c.user1_last_read_id ELSE c.user2_last_read_id END,
+               CASE WHEN u.read_receipts THEN (CASE WHEN c.user1_id = ? THEN c.user2_last_read_id ELSE c.user1_last_read_id END) ELSE 0 END,
+               u.id, u.username, COALESCE(u.avatar, ''),
+               pm.content, pm.created_at
+        FROM conversations c
+        JOIN users u ON u.id = (CASE WHEN c.user1_id = ? THEN c.user2_id ELSE c.user1_id END)
+        LEFT JOIN private_messages pm ON pm.id = c.last_message_id
+        WHERE (c.user1_id = ? OR c.user2_id = ?) ` + cursorCond + `
+        ORDER BY COALESCE(c.last_message_id, 0) DESC, c.id DESC
+        LIMIT ?`
+	queryArgs := []interface{}{userID, userID, userID, userID, userID, userID}
+	queryArgs = append(queryArgs, cursorArgs...)
+	queryArgs = append(queryArgs, limit+1)
+
+	rows, err := database.DB.Query(sqlQuery, queryArgs...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Printf("Error fetching conversations for user %d: %v", userID, err)
@@ -316,56 +197,45 @@ func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var conversations []models.ConversationResponse
+	resp := models.ConversationListResponse{Conversations: []models.ConversationResponse{}}
 	for rows.Next() {
 		var c models.ConversationResponse
-		var lastMessageTime sql.NullTime
-		var lastMessageContent sql.NullString
-		var conversationID int64
-		var user1ID, user2ID int64
 		var updatedAt time.Time
-
-		err := rows.Scan(
-			&conversationID, &user1ID, &user2ID, &c.OtherUserID, &updatedAt,
-			&c.OtherUsername, &c.OtherUserAvatar,
-			&lastMessageContent, &lastMessageTime, &c.UnreadCount,
-		)
+		var lastMessageContent sql.NullString
+		var lastMessageTime sql.NullTime
+		err := rows.Scan(&c.ID, &c.LastMessageID, &updatedAt, &c.UnreadCount, &c.LastReadID, &c.OtherLastReadID,
+			&c.OtherUserID, &c.OtherUsername, &c.OtherUserAvatar,
+			&lastMessageContent, &lastMessageTime)
 		if err != nil {
 			log.Printf("Error scanning conversation: %v", err)
-			continue
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
 		}
-
-		c.ID = conversationID
-		if user1ID == userID {
-			c.OtherUserID = user2ID
-		} else {
-			c.OtherUserID = user1ID
+		if len(resp.Conversations) == limit {
+			// One more row than asked for: there is a next page
+			last := resp.Conversations[limit-1]
+			resp.NextCursor = encodeConversationCursor(last.LastMessageID, last.ID)
+			break
 		}
 
-		if lastMessageContent.Valid {
-			c.LastMessageText = lastMessageContent.String
-		}
+		c.LastMessageText = lastMessageContent.String
 		if lastMessageTime.Valid {
 			c.LastMessageTime = &lastMessageTime.Time
+		} else {
+			c.LastMessageTime = &updatedAt
 		}
-
-		// Add online status
 		c.IsOnline = IsUserOnline(c.OtherUserID)
-
-		conversations = append(conversations, c)
+		resp.Conversations = append(resp.Conversations, c)
 	}
-
-	if conversations == nil {
-		conversations = []models.ConversationResponse{}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating conversations: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(conversations)
+	json.NewEncoder(w).Encode(resp)
 }
 
-// GetUnreadMessagesCountHandler returns the total count of unread messages for a user
-// Removed: GetUnreadMessagesCountHandler (moved to new message notification handler file)
-
 // BroadcastUnreadMessageCountToUser sends updated unread message count via WebSocket
 // Removed: BroadcastUnreadMessageCountToUser (moved to new message notification handler file)
 
@@ -518,44 +388,14 @@ func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Mark messages from other user as read and get their IDs for read receipts
-	var readMessageIDs []int64
-	readRows, err := database.DB.Query(`
-		SELECT id FROM private_messages 
-		WHERE sender_id = ? AND receiver_id = ? AND is_read = FALSE
-	`, otherUserID, userID)
-	if err == nil {
-		defer readRows.Close()
-		for readRows.Next() {
-			var msgID int64
-			if readRows.Scan(&msgID) == nil {
-				readMessageIDs = append(readMessageIDs, msgID)
-			}
-		}
-	}
-
-	// Mark messages as read
-	_, err = database.DB.Exec(`
-		UPDATE private_messages 
-		SET is_read = TRUE 
-		WHERE sender_id = ? AND receiver_id = ? AND is_read = FALSE
-	`, otherUserID, userID)
-	if err != nil {
-		log.Printf("Error marking messages as read: %v", err)
-	}
-
-	// Send read receipts for each message that was just marked as read
-	for _, msgID := range readMessageIDs {
-		BroadcastToUser(otherUserID, "message_read", map[string]interface{}{
-			"message_id": msgID,
-			"read_by":    userID,
-			// Removed 'read_at' field since it does not exist in the database
-		})
-	}
+	// Reading is explicit (POST /conversations/{otherUserID}/read); fetching
+	// messages leaves them unread. The viewer only sees that their own messages
+	// were read if the other user sends read receipts.
+	showReceipts := NewMessagingService(database.DB).readReceiptsEnabled(otherUserID)
 
 	// Fetch messages with pagination
 	query := `
-        SELECT pm.id, pm.sender_id, pm.receiver_id, pm.content, pm.is_read, pm.created_at,
+        SELECT pm.id, pm.sender_id, pm.receiver_id, pm.content, pm.is_read, pm.read_at, pm.created_at,
                u.username
         FROM private_messages pm
         JOIN users u ON pm.sender_id = u.id
@@ -576,15 +416,21 @@ func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	var messages []models.MessageResponse
 	for rows.Next() {
 		var m models.MessageResponse
+		var readAt sql.NullTime
 		err := rows.Scan(
 			&m.ID, &m.SenderID, &m.ReceiverID, &m.Content,
-			&m.IsRead, &m.CreatedAt, &m.SenderUsername,
+			&m.IsRead, &readAt, &m.CreatedAt, &m.SenderUsername,
 		)
 		if err != nil {
 			log.Printf("Error scanning message: %v", err)
 			continue
 		}
 		m.IsSentByViewer = m.SenderID == userID
+		if m.IsSentByViewer && !showReceipts {
+			m.IsRead = false
+		} else if readAt.Valid {
+			m.ReadAt = &readAt.Time
+		}
 		messages = append(messages, m)
 	}
 
@@ -596,7 +442,7 @@ func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(messages)
 }
 
-// PATCH /messages/{messageID}/read - Mark a message as read
+// PATCH /messages/{messageID}/read - Mark a message, and the ones before it, as read
 func MarkMessageAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok || userID == 0 {
@@ -623,33 +469,111 @@ func MarkMessageAsReadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := database.DB.Exec(`
-        UPDATE private_messages 
-        SET is_read = TRUE 
-        WHERE id = ? AND receiver_id = ?
-    `, messageID, userID)
+	// Everything the sender sent before this message is read too
+	_, err = NewMessagingService(database.DB).MarkConversationRead(userID, senderID, messageID, nil)
+	if err != nil {
+		var merr *MessagingError
+		if errors.As(err, &merr) {
+			http.Error(w, merr.Message, merr.Status)
+		} else {
+			http.Error(w, "Failed to mark message as read", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Message marked as read"})
+}
+
+// POST /conversations/{otherUserID}/read - Mark the messages from another user,
+// up to a message, as read
+func MarkConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	otherUserID, err := strconv.ParseInt(r.PathValue("otherUserID"), 10, 64)
 	if err != nil {
-		http.Error(w, "Failed to mark message as read", http.StatusInternalServerError)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MarkConversationReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Message not found or not authorized", http.StatusNotFound)
+	result, err := NewMessagingService(database.DB).MarkConversationRead(userID, otherUserID, req.UpToMessageID, nil)
+	if err != nil {
+		var merr *MessagingError
+		if errors.As(err, &merr) {
+			http.Error(w, merr.Message, merr.Status)
+		} else {
+			http.Error(w, "Failed to mark conversation as read", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// Send read receipt to sender
-	BroadcastToUser(senderID, "message_read", map[string]interface{}{
-		"message_id": messageID,
-		"read_by":    userID,
-		// Removed 'read_at' field since it does not exist in the database
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"marked":               result.Marked,
+		"last_read_message_id": result.LastReadID,
+		"unread_count":         result.UnreadCount,
 	})
+}
 
-	// Removed: Broadcast updated unread message count to receiver (moved to new message notification handler file)
+// GET /users/me/message-settings - Get the authenticated user's messaging settings
+func GetMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Message marked as read"})
+	var settings models.MessageSettings
+	err := database.DB.QueryRow("SELECT read_receipts FROM users WHERE id = ?", userID).Scan(&settings.ReadReceipts)
+	if err != nil {
+		log.Printf("Error fetching message settings for user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// PUT /users/me/message-settings - Update the authenticated user's messaging settings
+func UpdateMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ReadReceipts *bool `json:"read_receipts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	if req.ReadReceipts == nil {
+		http.Error(w, "read_receipts is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err := database.DB.Exec("UPDATE users SET read_receipts = ? WHERE id = ?", *req.ReadReceipts, userID)
+	if err != nil {
+		log.Printf("Error saving message settings for user %d: %v", userID, err)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.MessageSettings{ReadReceipts: *req.ReadReceipts})
 }
 
 // POST /messages/typing - Send typing indicator
@@ -659,6 +583,9 @@ func SendTypingIndicatorHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !allowRESTSend(w, userID, rateTyping) {
+		return
+	}
 
 	var req struct {
 		ReceiverID int64 `json:"receiver_id"`
@@ -689,11 +616,12 @@ func SendTypingIndicatorHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Broadcast typing indicator to receiver
-	BroadcastToUser(req.ReceiverID, "typing_indicator", map[string]interface{}{
-		"sender_id":       userID,
-		"sender_username": senderUsername,
-		"is_typing":       req.IsTyping,
-		"timestamp":       time.Now(),
+	now := time.Now()
+	BroadcastToUser(req.ReceiverID, "typing_indicator", models.WSTypingIndicator{
+		SenderID:       userID,
+		SenderUsername: senderUsername,
+		IsTyping:       req.IsTyping,
+		Timestamp:      &now,
 	})
 
 	w.WriteHeader(http.StatusOK)
@@ -729,10 +657,12 @@ func GetUsersOnlineStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check online status for each user
+	// Check online status for each user; users blocked in either direction always
+	// appear offline
 	onlineStatus := make(map[int64]bool)
 	for _, targetUserID := range userIDs {
-		onlineStatus[targetUserID] = IsUserOnline(targetUserID)
+		blocked, err := isBlockedBetween(userID, targetUserID)
+		onlineStatus[targetUserID] = err == nil && !blocked && IsUserOnline(targetUserID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -765,7 +695,9 @@ func GetUserOnlineStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isOnline := IsUserOnline(targetUserID)
+	// Users blocked in either direction always appear offline
+	blocked, err := isBlockedBetween(userID, targetUserID)
+	isOnline := err == nil && !blocked && IsUserOnline(targetUserID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -17,10 +17,7 @@ func GetUnreadMessagesCountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var totalUnreadCount int
-	err := database.DB.QueryRow(`
-		SELECT COUNT(*) FROM private_messages WHERE receiver_id = ? AND is_read = FALSE
-	`, userID).Scan(&totalUnreadCount)
+	totalUnreadCount, err := NewMessagingService(database.DB).UnreadCount(userID)
 	if err != nil {
 		log.Printf("Error getting total unread messages count for user %d: %v", userID, err)
 		http.Error(w, "Failed to fetch unread messages count", http.StatusInternalServerError)
@@ -0,0 +1,454 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"reda-social-network/models"
+)
+
+// MessagingService sends direct messages. POST /messages/{receiverID} and the
+// WebSocket direct_message request are thin adapters over it, so a message is
+// checked, stored and delivered the same way whichever transport sent it.
+type MessagingService struct {
+	DB *sql.DB
+}
+
+// NewMessagingService creates a messaging service on db.
+func NewMessagingService(db *sql.DB) *MessagingService {
+	return &MessagingService{DB: db}
+}
+
+// MessagingError is a message the service refused to send. Code is one of the
+// models.WSErr* codes and Status the matching HTTP status, so each transport can
+// report it its own way.
+type MessagingError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *MessagingError) Error() string {
+	return e.Message
+}
+
+func messagingError(status int, code, message string) *MessagingError {
+	return &MessagingError{Status: status, Code: code, Message: message}
+}
+
+// SentMessage is a direct message that was stored and delivered.
+type SentMessage struct {
+	ID        int64
+	CreatedAt time.Time
+	Online    bool // the receiver had a connection
+	Instant   bool // the receiver takes instant messages from the sender
+}
+
+// DeliveryStatus describes how the receiver got the message.
+func (m *SentMessage) DeliveryStatus() string {
+	switch {
+	case m.Online && m.Instant:
+		return "delivered_instantly"
+	case m.Online:
+		return "delivered_delayed"
+	default:
+		return "offline_notification_created"
+	}
+}
+
+// SendDirectMessage sends content from senderID to receiverID: it checks the
+// message and that the sender may message the receiver, stores it, updates the
+// conversation and pushes it to both users. origin is the WebSocket request that
+// sent it, or nil; it gets the direct_message_sent echo with its request ID.
+// Errors are *MessagingError.
+func (s *MessagingService) SendDirectMessage(senderID, receiverID int64, content string, origin *wsRequest) (*SentMessage, error) {
+	if err := s.checkCanSend(senderID, receiverID, content); err != nil {
+		return nil, err
+	}
+
+	sent := &SentMessage{CreatedAt: time.Now()}
+	messageID, err := s.store(senderID, receiverID, content, sent.CreatedAt)
+	if err != nil {
+		log.Printf("Error saving direct message from %d to %d: %v", senderID, receiverID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Failed to send message")
+	}
+	sent.ID = messageID
+
+	sent.Online = IsUserOnline(receiverID)
+	sent.Instant, err = checkShouldReceiveInstantMessage(senderID, receiverID)
+	if err != nil {
+		log.Printf("Error checking instant message delivery rules: %v", err)
+		sent.Instant = false // Default to not delivering instantly on error
+	}
+	s.deliver(senderID, receiverID, content, sent, origin)
+	return sent, nil
+}
+
+// checkCanSend applies the messaging rules: the receiver exists and is someone
+// else, neither user blocked the other, and one follows the other.
+func (s *MessagingService) checkCanSend(senderID, receiverID int64, content string) error {
+	if receiverID <= 0 {
+		return messagingError(http.StatusBadRequest, models.WSErrBadRequest, "Invalid receiver ID")
+	}
+	if senderID == receiverID {
+		return messagingError(http.StatusBadRequest, models.WSErrBadRequest, "Cannot send message to yourself")
+	}
+	if strings.TrimSpace(content) == "" {
+		return messagingError(http.StatusBadRequest, models.WSErrBadRequest, "Message content cannot be empty")
+	}
+
+	var receiverExists bool
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", receiverID).Scan(&receiverExists)
+	if err != nil {
+		log.Printf("Error checking receiver %d: %v", receiverID, err)
+		return messagingError(http.StatusInternalServerError, models.WSErrInternal, "Database error")
+	}
+	if !receiverExists {
+		return messagingError(http.StatusNotFound, models.WSErrNotFound, "Receiver not found")
+	}
+
+	blocked, err := isBlockedBetween(senderID, receiverID)
+	if err != nil {
+		return messagingError(http.StatusInternalServerError, models.WSErrInternal, "Database error checking blocks")
+	}
+	if blocked {
+		return messagingError(http.StatusForbidden, models.WSErrForbidden, "You cannot message this user")
+	}
+
+	canMessage, err := checkCanMessage(senderID, receiverID)
+	if err != nil {
+		return messagingError(http.StatusInternalServerError, models.WSErrInternal, "Database error checking follow relationship")
+	}
+	if !canMessage {
+		return messagingError(http.StatusForbidden, models.WSErrForbidden, "You can only message users you follow or who follow you")
+	}
+	return nil
+}
+
+// conversationSide orders two users the way the conversations table stores them
+// and names the prefix ("user1" or "user2") of userID's columns.
+func conversationSide(userID, otherUserID int64) (user1ID, user2ID int64, side string) {
+	if userID < otherUserID {
+		return userID, otherUserID, "user1"
+	}
+	return otherUserID, userID, "user2"
+}
+
+// store saves the message and makes it the last one of the users' conversation.
+func (s *MessagingService) store(senderID, receiverID int64, content string, now time.Time) (int64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO private_messages (sender_id, receiver_id, content, created_at)
+		VALUES (?, ?, ?, ?)
+	`, senderID, receiverID, content, now)
+	if err != nil {
+		return 0, err
+	}
+	messageID, _ := res.LastInsertId()
+
+	// The counter is incremented in SQL, so concurrent sends can't lose updates
+	user1ID, user2ID, receiverSide := conversationSide(receiverID, senderID)
+	_, err = tx.Exec(`
+		INSERT INTO conversations (user1_id, user2_id, last_message_id, updated_at, `+receiverSide+`_unread_count)
+		VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT(user1_id, user2_id) DO UPDATE SET
+		last_message_id = MAX(COALESCE(last_message_id, 0), excluded.last_message_id),
+		updated_at = excluded.updated_at,
+		`+receiverSide+`_unread_count = `+receiverSide+`_unread_count + 1
+	`, user1ID, user2ID, messageID, now)
+	if err != nil {
+		return 0, err
+	}
+	return messageID, tx.Commit()
+}
+
+// deliver pushes a stored message to both users:
+//   - the receiver gets new_message if they are online and take instant messages
+//     from the sender, and a new_message_popup otherwise, unless they muted the
+//     conversation (the sender can't tell the difference);
+//   - the receiver's devices get conversation_updated with their unread count;
+//   - the sender gets message_delivered for an instant delivery, and all of their
+//     devices get direct_message_sent.
+func (s *MessagingService) deliver(senderID, receiverID int64, content string, sent *SentMessage, origin *wsRequest) {
+	var senderUsername, senderAvatar string
+	err := s.DB.QueryRow("SELECT username, COALESCE(avatar, '') FROM users WHERE id = ?", senderID).Scan(&senderUsername, &senderAvatar)
+	if err != nil {
+		log.Printf("Error getting sender username/avatar: %v", err)
+		senderUsername = "Unknown"
+	}
+	// Ensure avatar URL is absolute if needed; base64 data URLs are used as is
+	if senderAvatar != "" && !strings.HasPrefix(senderAvatar, "http") && !strings.HasPrefix(senderAvatar, "data:image/") {
+		senderAvatar = fmt.Sprintf("http://localhost:8080/%s", strings.TrimLeft(senderAvatar, "/"))
+	}
+
+	if shouldPush(receiverID, muteConversation, senderID) {
+		if sent.Online && sent.Instant {
+			BroadcastToUser(receiverID, "new_message", models.WSNewMessage{
+				ID:             sent.ID,
+				SenderID:       senderID,
+				ReceiverID:     receiverID,
+				SenderUsername: senderUsername,
+				SenderAvatar:   senderAvatar,
+				Content:        content,
+				CreatedAt:      sent.CreatedAt,
+			})
+		} else {
+			notificationMessage := fmt.Sprintf("You have a new message from %s", senderUsername)
+			if !sent.Instant {
+				notificationMessage += " (delayed delivery)"
+			}
+			BroadcastToUser(receiverID, "new_message_popup", models.WSNewMessagePopup{
+				SenderID:       senderID,
+				SenderUsername: senderUsername,
+				SenderAvatar:   senderAvatar,
+				Message:        notificationMessage,
+				MessageID:      sent.ID,
+				Content:        content,
+				CreatedAt:      sent.CreatedAt,
+			})
+		}
+	}
+
+	unreadCount, err := s.UnreadCount(receiverID)
+	if err != nil {
+		log.Printf("Error counting unread messages for user %d: %v", receiverID, err)
+	} else {
+		BroadcastToUser(receiverID, "conversation_updated", models.WSConversationUpdated{
+			UnreadCount:    unreadCount,
+			LastMessage:    content,
+			MessageTime:    sent.CreatedAt,
+			SenderID:       senderID,
+			SenderUsername: senderUsername,
+		})
+	}
+
+	if sent.Online && sent.Instant {
+		BroadcastToUser(senderID, "message_delivered", models.WSMessageDelivered{
+			MessageID:   sent.ID,
+			DeliveredTo: receiverID,
+			DeliveredAt: sent.CreatedAt,
+			Status:      "delivered",
+		})
+	}
+	broadcastToUser(senderID, WSMessage{Type: "direct_message_sent", Data: models.WSDirectMessage{
+		ID:         sent.ID,
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Username:   senderUsername,
+		Content:    content,
+		CreatedAt:  sent.CreatedAt,
+	}}, origin)
+}
+
+// ReadResult is where a conversation's read marker ended up after a read.
+type ReadResult struct {
+	Marked      int64     // messages newly marked read
+	LastReadID  int64     // newest message from the other user that the reader read
+	UnreadCount int       // the reader's unread direct messages, across conversations
+	ReadAt      time.Time // when the newly marked messages were read
+}
+
+// MarkConversationRead marks every message otherUserID sent readerID, up to and
+// including upToMessageID, as read now. Reading is a watermark: the reader's
+// devices get one conversation_read with the new marker and their unread count,
+// and so does the other user, unless the reader turned read receipts off or
+// either blocked the other. origin is the WebSocket request that read, or nil.
+// Errors are *MessagingError.
+func (s *MessagingService) MarkConversationRead(readerID, otherUserID, upToMessageID int64, origin *wsRequest) (*ReadResult, error) {
+	if upToMessageID <= 0 {
+		return nil, messagingError(http.StatusBadRequest, models.WSErrBadRequest, "up_to_message_id is required")
+	}
+	if otherUserID <= 0 || otherUserID == readerID {
+		return nil, messagingError(http.StatusBadRequest, models.WSErrBadRequest, "Invalid user ID")
+	}
+
+	user1ID, user2ID, side := conversationSide(readerID, otherUserID)
+	result := &ReadResult{ReadAt: time.Now()}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting read transaction for user %d: %v", readerID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Failed to mark conversation as read")
+	}
+	defer tx.Rollback()
+
+	// A conversation whose messages predate its row gets one built from them;
+	// without messages there is nothing to read
+	_, err = tx.Exec(`
+		INSERT INTO conversations (user1_id, user2_id, last_message_id, updated_at,
+		user1_unread_count, user2_unread_count, user1_last_read_id, user2_last_read_id)
+		SELECT ?, ?, MAX(id), MAX(created_at),
+		COALESCE(SUM(receiver_id = ? AND is_read = FALSE), 0),
+		COALESCE(SUM(receiver_id = ? AND is_read = FALSE), 0),
+		COALESCE(MAX(CASE WHEN receiver_id = ? AND is_read = TRUE THEN id END), 0),
+		COALESCE(MAX(CASE WHEN receiver_id = ? AND is_read = TRUE THEN id END), 0)
+		FROM private_messages
+		WHERE (sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)
+		HAVING COUNT(*) > 0
+		ON CONFLICT(user1_id, user2_id) DO NOTHING
+	`, user1ID, user2ID, user1ID, user2ID, user1ID, user2ID, user1ID, user2ID, user2ID, user1ID)
+	if err != nil {
+		log.Printf("Error creating conversation of %d and %d: %v", readerID, otherUserID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Database error")
+	}
+	var conversationID int64
+	err = tx.QueryRow("SELECT id FROM conversations WHERE user1_id = ? AND user2_id = ?", user1ID, user2ID).Scan(&conversationID)
+	if err == sql.ErrNoRows {
+		return nil, messagingError(http.StatusNotFound, models.WSErrNotFound, "Conversation not found")
+	}
+	if err != nil {
+		log.Printf("Error finding conversation of %d and %d: %v", readerID, otherUserID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Database error")
+	}
+
+	res, err := tx.Exec(`
+		UPDATE private_messages SET is_read = TRUE, read_at = ?
+		WHERE sender_id = ? AND receiver_id = ? AND id <= ? AND is_read = FALSE
+	`, result.ReadAt, otherUserID, readerID, upToMessageID)
+	if err != nil {
+		log.Printf("Error marking messages from %d to %d as read: %v", otherUserID, readerID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Failed to mark conversation as read")
+	}
+	result.Marked, _ = res.RowsAffected()
+
+	_, err = tx.Exec(`
+		UPDATE conversations SET
+		`+side+`_unread_count = (
+			SELECT COUNT(*) FROM private_messages
+			WHERE sender_id = ? AND receiver_id = ? AND is_read = FALSE
+		),
+		`+side+`_last_read_id = MAX(`+side+`_last_read_id, (
+			SELECT COALESCE(MAX(id), 0) FROM private_messages
+			WHERE sender_id = ? AND receiver_id = ? AND is_read = TRUE
+		))
+		WHERE id = ?
+	`, otherUserID, readerID, otherUserID, readerID, conversationID)
+	if err != nil {
+		log.Printf("Error updating conversation reads for user %d: %v", readerID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Failed to mark conversation as read")
+	}
+	err = tx.QueryRow("SELECT "+side+"_last_read_id FROM conversations WHERE id = ?", conversationID).Scan(&result.LastReadID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error saving conversation reads for user %d: %v", readerID, err)
+		return nil, messagingError(http.StatusInternalServerError, models.WSErrInternal, "Failed to mark conversation as read")
+	}
+
+	result.UnreadCount, err = s.UnreadCount(readerID)
+	if err != nil {
+		log.Printf("Error counting unread messages for user %d: %v", readerID, err)
+	}
+	if result.Marked > 0 {
+		s.announceRead(readerID, otherUserID, result, origin)
+	}
+	return result, nil
+}
+
+// announceRead sends a conversation_read for a read that moved the marker. Every
+// device of the reader gets it along with their unread count; the other user
+// gets it only if the reader sends read receipts.
+func (s *MessagingService) announceRead(readerID, otherUserID int64, result *ReadResult, origin *wsRequest) {
+	event := models.WSConversationRead{
+		ReaderID:          readerID,
+		OtherUserID:       otherUserID,
+		LastReadMessageID: result.LastReadID,
+		ReadAt:            result.ReadAt,
+	}
+	broadcastToUser(readerID, WSMessage{Type: "conversation_read", Data: event}, origin)
+	BroadcastToUser(readerID, "unread_messages_count", models.WSUnreadMessagesCount{
+		UnreadCount: result.UnreadCount,
+	})
+
+	if !s.readReceiptsEnabled(readerID) {
+		return
+	}
+	if blocked, err := isBlockedBetween(readerID, otherUserID); err != nil || blocked {
+		return
+	}
+	BroadcastToUser(otherUserID, "conversation_read", event)
+}
+
+// readReceiptsEnabled reports whether userID lets others see when they read
+// messages. When in doubt it says no.
+func (s *MessagingService) readReceiptsEnabled(userID int64) bool {
+	var enabled bool
+	if err := s.DB.QueryRow("SELECT read_receipts FROM users WHERE id = ?", userID).Scan(&enabled); err != nil {
+		log.Printf("Error checking read receipts setting of user %d: %v", userID, err)
+		return false
+	}
+	return enabled
+}
+
+// UnreadCount returns how many direct messages userID has not read, from the
+// conversations' counters.
+func (s *MessagingService) UnreadCount(userID int64) (int, error) {
+	var count int
+	err := s.DB.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN user1_id = ? THEN user1_unread_count ELSE user2_unread_count END), 0)
+		FROM conversations
+		WHERE user1_id = ? OR user2_id = ?
+	`, userID, userID, userID).Scan(&count)
+	return count, err
+}
+
+// BackfillConversations rebuilds the conversations table from private_messages:
+// every pair of users who exchanged messages gets a row, with its last message,
+// unread counts and read markers. Migration 000029 does the same when it adds the
+// counters; this repairs counters that drifted since (run the server with
+// -backfill-conversations) and is safe to run again.
+func (s *MessagingService) BackfillConversations() (int64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO conversations (user1_id, user2_id, last_message_id, updated_at)
+		SELECT MIN(sender_id, receiver_id), MAX(sender_id, receiver_id), MAX(id), MAX(created_at)
+		FROM private_messages
+		WHERE sender_id != receiver_id
+		GROUP BY MIN(sender_id, receiver_id), MAX(sender_id, receiver_id)
+		ON CONFLICT(user1_id, user2_id) DO UPDATE SET
+		last_message_id = excluded.last_message_id,
+		updated_at = excluded.updated_at
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("creating conversations: %w", err)
+	}
+
+	res, err := tx.Exec(`
+		UPDATE conversations SET
+		user1_unread_count = (
+			SELECT COUNT(*) FROM private_messages
+			WHERE sender_id = conversations.user2_id AND receiver_id = conversations.user1_id AND is_read = FALSE
+		),
+		user2_unread_count = (
+			SELECT COUNT(*) FROM private_messages
+			WHERE sender_id = conversations.user1_id AND receiver_id = conversations.user2_id AND is_read = FALSE
+		),
+		user1_last_read_id = (
+			SELECT COALESCE(MAX(id), 0) FROM private_messages
+			WHERE sender_id = conversations.user2_id AND receiver_id = conversations.user1_id AND is_read = TRUE
+		),
+		user2_last_read_id = (
+			SELECT COALESCE(MAX(id), 0) FROM private_messages
+			WHERE sender_id = conversations.user1_id AND receiver_id = conversations.user2_id AND is_read = TRUE
+		)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("counting unread messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
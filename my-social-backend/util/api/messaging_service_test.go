@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// sendOutcome is what sending a direct message left behind.
+type sendOutcome struct {
+	status int    // the HTTP status, over REST
+	code   string // the error code, or "" if the message was sent, over the WebSocket
+	rows   []string
+	events []string // "user:type", as received and as logged
+}
+
+// sendCase sets up two users and sends content from sender to the user that to
+// picks. The message should be refused with status and code, or, if code is "",
+// stored and pushed to the receiver if pushed is set.
+type sendCase struct {
+	name    string
+	setup   func(t *testing.T, sender, receiver int64)
+	to      func(sender, receiver int64) int64
+	content string
+	status  int
+	code    string
+	pushed  bool
+}
+
+func followEachOther(t *testing.T, sender, receiver int64) {
+	follow(t, sender, receiver)
+	follow(t, receiver, sender)
+}
+
+// POST /messages/{receiverID} and the WebSocket direct_message request go through
+// MessagingService, so they must answer, store and push exactly the same.
+func TestSendDirectMessageTransportsAgree(t *testing.T) {
+	toReceiver := func(_, receiver int64) int64 { return receiver }
+	tests := []sendCase{
+		{"sent", followEachOther, toReceiver, "hello", http.StatusCreated, "", true},
+		{"unknown receiver", followEachOther, func(_, receiver int64) int64 { return receiver + 100 }, "hello", http.StatusNotFound, models.WSErrNotFound, false},
+		{"self", followEachOther, func(sender, _ int64) int64 { return sender }, "hello", http.StatusBadRequest, models.WSErrBadRequest, false},
+		{"blocked", func(t *testing.T, sender, receiver int64) {
+			followEachOther(t, sender, receiver)
+			database.DB.Exec("INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)", receiver, sender)
+		}, toReceiver, "hello", http.StatusForbidden, models.WSErrForbidden, false},
+		{"no follow", func(*testing.T, int64, int64) {}, toReceiver, "hello", http.StatusForbidden, models.WSErrForbidden, false},
+		{"empty content", followEachOther, toReceiver, "  ", http.StatusBadRequest, models.WSErrBadRequest, false},
+		{"muted conversation", func(t *testing.T, sender, receiver int64) {
+			followEachOther(t, sender, receiver)
+			database.DB.Exec("INSERT INTO mutes (user_id, target_type, target_id) VALUES (?, 'conversation', ?)", receiver, sender)
+		}, toReceiver, "hello", http.StatusCreated, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each transport gets its own database and connections
+			var rest, ws sendOutcome
+			t.Run("rest", func(t *testing.T) { rest = sendOver(t, tt, "rest") })
+			t.Run("ws", func(t *testing.T) { ws = sendOver(t, tt, "ws") })
+
+			if rest.status != tt.status {
+				t.Errorf("REST status %d, want %d", rest.status, tt.status)
+			}
+			if ws.code != tt.code {
+				t.Errorf("WebSocket error %q, want %q", ws.code, tt.code)
+			}
+			if !reflect.DeepEqual(rest.rows, ws.rows) {
+				t.Errorf("stored rows differ:\nREST: %q\nWS:   %q", rest.rows, ws.rows)
+			}
+			if !reflect.DeepEqual(rest.events, ws.events) {
+				t.Errorf("events differ:\nREST: %q\nWS:   %q", rest.events, ws.events)
+			}
+			if stored := strings.HasPrefix(rest.rows[0], "message "); stored != (tt.code == "") {
+				t.Errorf("stored rows %q, want a message stored: %v", rest.rows, tt.code == "")
+			}
+			if pushed := slices.Contains(rest.events, "receiver:new_message"); pushed != tt.pushed {
+				t.Errorf("events %q, want new_message pushed: %v", rest.events, tt.pushed)
+			}
+		})
+	}
+}
+
+// sendOver runs tt in a new database, sending over transport ("rest" or "ws")
+// while both users are connected.
+func sendOver(t *testing.T, tt sendCase, transport string) sendOutcome {
+	newTestDB(t)
+	sender, receiver := createTestUser(t, "sender"), createTestUser(t, "receiver")
+	tt.setup(t, sender, receiver)
+	to := tt.to(sender, receiver)
+	conns := map[string]*realtimeConn{"sender": connectTestClient(t, sender), "receiver": connectTestClient(t, receiver)}
+
+	var out sendOutcome
+	switch transport {
+	case "rest":
+		body, _ := json.Marshal(models.SendMessageRequest{Content: tt.content})
+		r := httptest.NewRequest(http.MethodPost, "/messages/"+strconv.FormatInt(to, 10), strings.NewReader(string(body)))
+		r.SetPathValue("receiverID", strconv.FormatInt(to, 10))
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, sender))
+		w := httptest.NewRecorder()
+		SendMessageHandler(w, r)
+		out.status = w.Code
+	case "ws":
+		raw, _ := json.Marshal(map[string]interface{}{
+			"type": "direct_message",
+			"id":   "send-1",
+			"data": models.WSDirectMessageRequest{ReceiverID: to, Content: tt.content},
+		})
+		dispatchWSRequest(sender, &WSClient{realtimeConn: conns["sender"]}, raw)
+	}
+
+	for _, name := range []string{"sender", "receiver"} {
+		for _, msg := range drain(t, conns[name]) {
+			if msg.Type == "error" {
+				var data models.WSErrorData
+				json.Unmarshal(msg.Data, &data)
+				out.code = data.Code
+				continue
+			}
+			out.events = append(out.events, name+":"+msg.Type)
+		}
+	}
+
+	rows, err := database.DB.Query("SELECT user_id, type FROM user_events ORDER BY user_id, seq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int64
+		var msgType string
+		rows.Scan(&userID, &msgType)
+		out.events = append(out.events, fmt.Sprintf("logged %d:%s", userID, msgType))
+	}
+
+	rows, err = database.DB.Query("SELECT sender_id, receiver_id, content, is_read FROM private_messages ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var from, to int64
+		var content string
+		var read bool
+		rows.Scan(&from, &to, &content, &read)
+		out.rows = append(out.rows, fmt.Sprintf("message %d->%d %q read=%v", from, to, content, read))
+	}
+	var conversations int
+	database.DB.QueryRow("SELECT COUNT(*) FROM conversations").Scan(&conversations)
+	out.rows = append(out.rows, fmt.Sprintf("%d conversation(s)", conversations))
+	rows, err = database.DB.Query("SELECT user1_id, user2_id, COALESCE(last_message_id, 0), user1_unread_count, user2_unread_count FROM conversations ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user1, user2, last, unread1, unread2 int64
+		rows.Scan(&user1, &user2, &last, &unread1, &unread2)
+		out.rows = append(out.rows, fmt.Sprintf("conversation %d/%d last=%d unread=%d/%d", user1, user2, last, unread1, unread2))
+	}
+	return out
+}
+
+// Concurrent sends in one conversation each bump the counter once and leave the
+// newest message as the last one.
+func TestStoreConcurrentSends(t *testing.T) {
+	newTestDB(t)
+	sender, receiver := createTestUser(t, "sender"), createTestUser(t, "receiver")
+	s := NewMessagingService(database.DB)
+
+	const n = 20
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			_, err := s.store(sender, receiver, fmt.Sprintf("message %d", i), time.Now())
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("store: %v", err)
+		}
+	}
+
+	var lastID, newestID int64
+	var unread int
+	user1, user2, side := conversationSide(receiver, sender)
+	err := database.DB.QueryRow("SELECT last_message_id, "+side+"_unread_count FROM conversations WHERE user1_id = ? AND user2_id = ?", user1, user2).Scan(&lastID, &unread)
+	if err != nil {
+		t.Fatalf("loading the conversation: %v", err)
+	}
+	database.DB.QueryRow("SELECT MAX(id) FROM private_messages").Scan(&newestID)
+	if lastID != newestID {
+		t.Errorf("last_message_id = %d, want the newest message %d", lastID, newestID)
+	}
+	if unread != n {
+		t.Errorf("unread count = %d, want %d", unread, n)
+	}
+	if count, err := s.UnreadCount(receiver); err != nil || count != n {
+		t.Errorf("UnreadCount = %d (%v), want %d", count, err, n)
+	}
+}
+
+// Reading a conversation whose row is missing builds the row from its messages.
+func TestMarkConversationReadWithoutConversationRow(t *testing.T) {
+	newTestDB(t)
+	reader, other := createTestUser(t, "reader"), createTestUser(t, "other")
+	followEachOther(t, reader, other)
+	s := NewMessagingService(database.DB)
+
+	var lastID int64
+	for _, m := range []struct{ from, to int64 }{{other, reader}, {reader, other}, {other, reader}, {other, reader}} {
+		sent, err := s.SendDirectMessage(m.from, m.to, "hi", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastID = sent.ID
+	}
+	database.DB.Exec("DELETE FROM conversations")
+
+	result, err := s.MarkConversationRead(reader, other, lastID-1, nil)
+	if err != nil {
+		t.Fatalf("MarkConversationRead: %v", err)
+	}
+	if result.Marked != 2 || result.LastReadID != lastID-1 || result.UnreadCount != 1 {
+		t.Errorf("got %+v, want 2 marked, last read %d and 1 unread", result, lastID-1)
+	}
+
+	user1, user2, side := conversationSide(reader, other)
+	otherSide := "user1"
+	if side == "user1" {
+		otherSide = "user2"
+	}
+	var last, readerUnread, otherUnread int64
+	err = database.DB.QueryRow("SELECT last_message_id, "+side+"_unread_count, "+otherSide+"_unread_count FROM conversations WHERE user1_id = ? AND user2_id = ?",
+		user1, user2).Scan(&last, &readerUnread, &otherUnread)
+	if err != nil {
+		t.Fatalf("loading the conversation: %v", err)
+	}
+	if last != lastID || readerUnread != 1 || otherUnread != 1 {
+		t.Errorf("conversation has last message %d and unread %d (reader) / %d (other); want %d, 1 / 1", last, readerUnread, otherUnread, lastID)
+	}
+
+	// Without any message there is still nothing to read
+	stranger := createTestUser(t, "stranger")
+	_, err = s.MarkConversationRead(reader, stranger, lastID, nil)
+	var merr *MessagingError
+	if !errors.As(err, &merr) || merr.Status != http.StatusNotFound {
+		t.Errorf("reading a conversation without messages: got %v, want a 404", err)
+	}
+}
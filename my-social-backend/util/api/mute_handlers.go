@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// Things a user can mute. Mutes only change what the muting user is shown or
+// pushed; the muted party is never told and nothing changes for them.
+const (
+	muteUser         = "user"         // hide their posts from the feed and their activity notifications
+	muteConversation = "conversation" // no pushes for direct messages from them
+	muteGroupChat    = "group_chat"   // no pushes for the group's chat messages
+)
+
+// activeMuteClause is the SQL condition (on the mutes table) for mutes that have
+// not expired.
+const activeMuteClause = "(muted_until IS NULL OR muted_until > ?)"
+
+// isMuted reports whether userID currently has the given target muted.
+func isMuted(userID int64, targetType string, targetID int64) (bool, error) {
+	var muted bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM mutes
+            WHERE user_id = ? AND target_type = ? AND target_id = ? AND `+activeMuteClause+`
+        )
+    `, userID, targetType, targetID, time.Now().UTC()).Scan(&muted)
+	return muted, err
+}
+
+// shouldPush reports whether a push about targetType/targetID should be sent to
+// userID. Errors are logged and treated as not muted, so a failing lookup never
+// swallows messages.
+func shouldPush(userID int64, targetType string, targetID int64) bool {
+	muted, err := isMuted(userID, targetType, targetID)
+	if err != nil {
+		log.Printf("Error checking %s mute %d for user %d: %v", targetType, targetID, userID, err)
+		return true
+	}
+	return !muted
+}
+
+// notMutedClause returns a SQL condition that is true when viewerID has not muted
+// the user in userColumn.
+func notMutedClause(userColumn string, viewerID int64) (string, []interface{}) {
+	clause := `NOT EXISTS(
+            SELECT 1 FROM mutes
+            WHERE user_id = ? AND target_type = 'user' AND target_id = ` + userColumn + ` AND ` + activeMuteClause + `
+        )`
+	return clause, []interface{}{viewerID, time.Now().UTC()}
+}
+
+// MuteUserHandler hides a user's posts from the feed and stops notifications about
+// their activity, without unfollowing them.
+// POST /users/{targetUserID}/mute
+func MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := muteTargetUser(w, r, "targetUserID")
+	if ok {
+		saveMute(w, r, userID, muteUser, targetID)
+	}
+}
+
+// UnmuteUserHandler removes a user mute.
+// DELETE /users/{targetUserID}/mute
+func UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := muteTargetUser(w, r, "targetUserID")
+	if ok {
+		deleteMute(w, userID, muteUser, targetID)
+	}
+}
+
+// MuteConversationHandler stops pushes for direct messages from another user. The
+// messages are still stored and show up in the conversation.
+// POST /conversations/{otherUserID}/mute
+func MuteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := muteTargetUser(w, r, "otherUserID")
+	if ok {
+		saveMute(w, r, userID, muteConversation, targetID)
+	}
+}
+
+// UnmuteConversationHandler removes a conversation mute.
+// DELETE /conversations/{otherUserID}/mute
+func UnmuteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := muteTargetUser(w, r, "otherUserID")
+	if ok {
+		deleteMute(w, userID, muteConversation, targetID)
+	}
+}
+
+// MuteGroupChatHandler stops group message notifications for a group the user is a
+// member of. Chat messages are still delivered.
+// POST /groups/{groupID}/chat/mute
+func MuteGroupChatHandler(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := muteTargetGroup(w, r)
+	if ok {
+		saveMute(w, r, userID, muteGroupChat, groupID)
+	}
+}
+
+// UnmuteGroupChatHandler removes a group chat mute.
+// DELETE /groups/{groupID}/chat/mute
+func UnmuteGroupChatHandler(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := muteTargetGroup(w, r)
+	if ok {
+		deleteMute(w, userID, muteGroupChat, groupID)
+	}
+}
+
+// GetMutesHandler lists the authenticated user's active mutes.
+// GET /mutes
+func GetMutesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT target_type, target_id, muted_until, created_at
+        FROM mutes
+        WHERE user_id = ? AND `+activeMuteClause+`
+        ORDER BY created_at DESC
+    `, userID, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error querying mutes for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch mutes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var mutes []models.MuteResponse
+	for rows.Next() {
+		var m models.MuteResponse
+		var until sql.NullTime
+		if err := rows.Scan(&m.TargetType, &m.TargetID, &until, &m.CreatedAt); err != nil {
+			log.Printf("Error scanning mute for user %d: %v", userID, err)
+			continue
+		}
+		if until.Valid {
+			m.Until = &until.Time
+		}
+		mutes = append(mutes, m)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating mutes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mutes == nil {
+		mutes = []models.MuteResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mutes)
+}
+
+// muteTargetUser resolves the authenticated user and the user ID in the given path
+// value. It writes the error response itself and returns ok=false on failure.
+func muteTargetUser(w http.ResponseWriter, r *http.Request, pathValue string) (userID, targetID int64, ok bool) {
+	userID, ok = r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	targetID, err := strconv.ParseInt(r.PathValue(pathValue), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID in URL path", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if targetID == userID {
+		http.Error(w, "Cannot mute yourself", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var exists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", targetID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Database error checking user: "+err.Error(), http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return userID, targetID, true
+}
+
+// muteTargetGroup resolves the authenticated user and the group in the path, which
+// they must be an accepted member of. It writes the error response itself and
+// returns ok=false on failure.
+func muteTargetGroup(w http.ResponseWriter, r *http.Request) (userID, groupID int64, ok bool) {
+	userID, ok = r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID in URL path", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var isMember bool
+	err = database.DB.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND status = 'accepted')
+    `, groupID, userID).Scan(&isMember)
+	if err != nil {
+		http.Error(w, "Database error checking membership: "+err.Error(), http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if !isMember {
+		http.Error(w, "Not a group member", http.StatusForbidden)
+		return 0, 0, false
+	}
+	return userID, groupID, true
+}
+
+// saveMute creates or updates a mute from the optional request body and writes the
+// resulting mute as the response.
+func saveMute(w http.ResponseWriter, r *http.Request, userID int64, targetType string, targetID int64) {
+	var req models.MuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var until interface{}
+	if req.Until != nil {
+		if !req.Until.After(now) {
+			http.Error(w, "until must be in the future", http.StatusBadRequest)
+			return
+		}
+		until = req.Until.UTC()
+	}
+
+	_, err := database.DB.Exec(`
+        INSERT INTO mutes (user_id, target_type, target_id, muted_until, created_at)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT(user_id, target_type, target_id) DO UPDATE SET
+        muted_until = excluded.muted_until, created_at = excluded.created_at
+    `, userID, targetType, targetID, until, now.UTC())
+	if err != nil {
+		log.Printf("Error muting %s %d for user %d: %v", targetType, targetID, userID, err)
+		http.Error(w, "Failed to mute", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MuteResponse{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Until:      req.Until,
+		CreatedAt:  now,
+	})
+}
+
+// deleteMute removes a mute, including an expired one.
+func deleteMute(w http.ResponseWriter, userID int64, targetType string, targetID int64) {
+	result, err := database.DB.Exec("DELETE FROM mutes WHERE user_id = ? AND target_type = ? AND target_id = ?", userID, targetType, targetID)
+	if err != nil {
+		log.Printf("Error unmuting %s %d for user %d: %v", targetType, targetID, userID, err)
+		http.Error(w, "Failed to unmute", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "Not muted", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unmuted"})
+}
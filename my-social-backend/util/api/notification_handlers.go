@@ -194,6 +194,9 @@ func (nh *NotificationHelpers) CreateFollowAcceptedNotification(requesterID, acc
 // CreateDirectFollowNotification creates a notification when someone follows a public user directly
 func (nh *NotificationHelpers) CreateDirectFollowNotification(followerID, targetUserID int) {
 	log.Printf("Creating direct follow notification from user %d to user %d", followerID, targetUserID)
+	if !shouldPush(int64(targetUserID), muteUser, int64(followerID)) {
+		return
+	}
 
 	// Get follower's username for the message
 	var followerUsername string
@@ -232,6 +235,10 @@ func (nh *NotificationHelpers) CreatePostLikeNotification(likerID, postOwnerID,
 	if likerID == postOwnerID {
 		return
 	}
+	// Don't notify about users the owner muted
+	if !shouldPush(int64(postOwnerID), muteUser, int64(likerID)) {
+		return
+	}
 
 	// Get liker's username for the message
 	var likerUsername string
@@ -266,6 +273,10 @@ func (nh *NotificationHelpers) CreatePostCommentNotification(commenterID, postOw
 	if commenterID == postOwnerID {
 		return
 	}
+	// Don't notify about users the owner muted
+	if !shouldPush(int64(postOwnerID), muteUser, int64(commenterID)) {
+		return
+	}
 
 	// Get commenter's username for the message
 	var commenterUsername string
@@ -294,6 +305,69 @@ func (nh *NotificationHelpers) CreatePostCommentNotification(commenterID, postOw
 	}
 }
 
+// CreatePollClosedNotification tells a poll's creator that voting has ended
+func (nh *NotificationHelpers) CreatePollClosedNotification(creatorID, pollID, totalVoters int) {
+	notificationService := models.NewNotificationService(database.DB)
+
+	req := models.CreateNotificationRequest{
+		UserID:      creatorID,
+		Type:        "poll_closed",
+		Title:       "Poll Closed",
+		Message:     "Your poll has closed with " + strconv.Itoa(totalVoters) + " voter(s)",
+		RelatedID:   &pollID,
+		RelatedType: stringPtr("poll"),
+	}
+
+	err := notificationService.CreateNotification(req)
+	if err == nil {
+		// Send real-time notification via WebSocket. The creator also gets the
+		// results as a "poll_closed" event, so the notification goes under its own type.
+		BroadcastNotificationToUser(creatorID, "poll_closed_notification", req)
+	}
+}
+
+// CreateFollowRequestsApprovedNotification tells a user who made their account public
+// how many pending follow requests were approved, as a single notification
+func (nh *NotificationHelpers) CreateFollowRequestsApprovedNotification(userID, approved int) {
+	notificationService := models.NewNotificationService(database.DB)
+
+	req := models.CreateNotificationRequest{
+		UserID:      userID,
+		Type:        "follow_requests_approved",
+		Title:       "Follow Requests Approved",
+		Message:     "Your account is now public, so " + strconv.Itoa(approved) + " pending follow request(s) were approved",
+		RelatedID:   &userID,
+		RelatedType: stringPtr("user"),
+	}
+
+	err := notificationService.CreateNotification(req)
+	if err == nil {
+		// Send real-time notification via WebSocket
+		BroadcastNotificationToUser(userID, "follow_requests_approved", req)
+	}
+}
+
+// CreateReviewFollowersNotification asks a user who made their account private to
+// review the followers who can now see their private content
+func (nh *NotificationHelpers) CreateReviewFollowersNotification(userID, followers int) {
+	notificationService := models.NewNotificationService(database.DB)
+
+	req := models.CreateNotificationRequest{
+		UserID:      userID,
+		Type:        "review_followers",
+		Title:       "Review Your Followers",
+		Message:     "Your account is now private. Review your " + strconv.Itoa(followers) + " follower(s) and remove anyone who shouldn't see your posts",
+		RelatedID:   &userID,
+		RelatedType: stringPtr("user"),
+	}
+
+	err := notificationService.CreateNotification(req)
+	if err == nil {
+		// Send real-time notification via WebSocket
+		BroadcastNotificationToUser(userID, "review_followers", req)
+	}
+}
+
 // Helper function to create string pointers
 func stringPtr(s string) *string {
 	return &s
@@ -302,13 +376,13 @@ func stringPtr(s string) *string {
 // BroadcastNotificationToUser sends a real-time notification via WebSocket
 func BroadcastNotificationToUser(userID int, notificationType string, notification models.CreateNotificationRequest) {
 	// Use the existing BroadcastToUser function from ws_handlers.go
-	data := map[string]interface{}{
-		"type":         notification.Type,
-		"title":        notification.Title,
-		"message":      notification.Message,
-		"related_id":   notification.RelatedID,
-		"related_type": notification.RelatedType,
-		"actor_id":     notification.ActorID,
+	data := models.WSNotification{
+		Type:        notification.Type,
+		Title:       notification.Title,
+		Message:     notification.Message,
+		RelatedID:   notification.RelatedID,
+		RelatedType: notification.RelatedType,
+		ActorID:     notification.ActorID,
 	}
 
 	BroadcastToUser(int64(userID), notificationType, data)
@@ -329,8 +403,8 @@ func BroadcastUnreadCountToUser(userID int) {
 	}
 
 	// Broadcast the count update
-	data := map[string]interface{}{
-		"unread_count": count,
+	data := models.WSNotificationCount{
+		UnreadCount: count,
 	}
 
 	BroadcastToUser(int64(userID), "notification_count_update", data)
@@ -0,0 +1,435 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// pollCloserInterval is how often the poll closer looks for polls past their close time.
+const pollCloserInterval = 30 * time.Second
+
+// validatePollRequest checks a poll attachment and returns its trimmed options.
+// publishAt is when the post goes live, for scheduled posts; the poll may not
+// close before anyone can see it. The returned message is empty when the poll
+// is valid.
+func validatePollRequest(req *models.CreatePollRequest, publishAt *time.Time) ([]string, string) {
+	if len(req.Options) < models.PollMinOptions || len(req.Options) > models.PollMaxOptions {
+		return nil, "A poll must have between 2 and 10 options"
+	}
+
+	seen := make(map[string]bool, len(req.Options))
+	options := make([]string, 0, len(req.Options))
+	for _, option := range req.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, "Poll options cannot be empty"
+		}
+		key := strings.ToLower(option)
+		if seen[key] {
+			return nil, "Poll options must be unique"
+		}
+		seen[key] = true
+		options = append(options, option)
+	}
+
+	if req.ClosesAt != nil && !req.ClosesAt.After(time.Now()) {
+		return nil, "Poll closes_at must be in the future"
+	}
+	if req.ClosesAt != nil && publishAt != nil && !req.ClosesAt.After(*publishAt) {
+		return nil, "Poll closes_at must be after the post's publish_at"
+	}
+	return options, ""
+}
+
+// createPoll stores a validated poll for the post or group post identified by
+// ownerColumn/ownerID as part of the caller's transaction.
+func createPoll(tx *sql.Tx, ownerColumn string, ownerID, creatorID int64, req *models.CreatePollRequest, options []string) (int64, error) {
+	var closesAt *time.Time
+	if req.ClosesAt != nil {
+		utc := req.ClosesAt.UTC()
+		closesAt = &utc
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO polls ("+ownerColumn+", creator_id, multiple_choice, closes_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		ownerID, creatorID, req.MultipleChoice, closesAt, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, option := range options {
+		if _, err := tx.Exec("INSERT INTO poll_options (poll_id, text, position) VALUES (?, ?, ?)", pollID, option, i); err != nil {
+			return 0, err
+		}
+	}
+	return pollID, nil
+}
+
+// deletePollsFor removes the polls (with their options, votes and notifications)
+// attached to the given post or group post.
+func deletePollsFor(ex sqlExecer, ownerColumn string, ownerID int64) error {
+	pollIDs := "SELECT id FROM polls WHERE " + ownerColumn + " = ?"
+	statements := []string{
+		"DELETE FROM poll_votes WHERE poll_id IN (" + pollIDs + ")",
+		"DELETE FROM poll_options WHERE poll_id IN (" + pollIDs + ")",
+		"DELETE FROM notifications WHERE related_type = 'poll' AND related_id IN (" + pollIDs + ")",
+		"DELETE FROM polls WHERE " + ownerColumn + " = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := ex.Exec(stmt, ownerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPollFor returns the poll attached to a post or group post as seen by viewerID,
+// or nil if there is none.
+func loadPollFor(ownerColumn string, ownerID, viewerID int64) (*models.PollResponse, error) {
+	var pollID int64
+	err := database.DB.QueryRow("SELECT id FROM polls WHERE "+ownerColumn+" = ?", ownerID).Scan(&pollID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadPoll(pollID, viewerID)
+}
+
+// loadPoll builds the poll response for viewerID, hiding results until the viewer
+// has voted, the poll has closed, or the viewer is the poll's creator.
+func loadPoll(pollID, viewerID int64) (*models.PollResponse, error) {
+	var poll models.PollResponse
+	var postID, groupPostID sql.NullInt64
+	var closesAt, closedAt sql.NullTime
+	err := database.DB.QueryRow(`
+        SELECT id, post_id, group_post_id, creator_id, multiple_choice, closes_at, closed_at, created_at
+        FROM polls WHERE id = ?
+    `, pollID).Scan(&poll.ID, &postID, &groupPostID, &poll.CreatorID, &poll.MultipleChoice, &closesAt, &closedAt, &poll.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if postID.Valid {
+		poll.PostID = &postID.Int64
+	}
+	if groupPostID.Valid {
+		poll.GroupPostID = &groupPostID.Int64
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+	}
+	if closedAt.Valid {
+		poll.ClosedAt = &closedAt.Time
+	}
+	poll.IsClosed = isPollClosed(closesAt, closedAt)
+
+	poll.UserVotes = []int64{}
+	if viewerID != 0 {
+		voteRows, err := database.DB.Query("SELECT option_id FROM poll_votes WHERE poll_id = ? AND user_id = ?", pollID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		for voteRows.Next() {
+			var optionID int64
+			if err := voteRows.Scan(&optionID); err == nil {
+				poll.UserVotes = append(poll.UserVotes, optionID)
+			}
+		}
+		voteRows.Close()
+	}
+	poll.ResultsVisible = poll.IsClosed || viewerID == poll.CreatorID || len(poll.UserVotes) > 0
+
+	rows, err := database.DB.Query(`
+        SELECT o.id, o.text, o.position, (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)
+        FROM poll_options o
+        WHERE o.poll_id = ?
+        ORDER BY o.position ASC
+    `, pollID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var option models.PollOptionResponse
+		var voteCount int
+		if err := rows.Scan(&option.ID, &option.Text, &option.Position, &voteCount); err != nil {
+			return nil, err
+		}
+		if poll.ResultsVisible {
+			option.VoteCount = &voteCount
+		}
+		poll.Options = append(poll.Options, option)
+	}
+
+	if poll.ResultsVisible {
+		var totalVoters int
+		err := database.DB.QueryRow("SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_id = ?", pollID).Scan(&totalVoters)
+		if err != nil {
+			return nil, err
+		}
+		poll.TotalVoters = &totalVoters
+	}
+	return &poll, nil
+}
+
+// isPollClosed treats a poll as closed once its close time has passed, even if
+// the poll closer has not run yet.
+func isPollClosed(closesAt, closedAt sql.NullTime) bool {
+	return closedAt.Valid || (closesAt.Valid && !closesAt.Time.After(time.Now()))
+}
+
+// canAccessPoll reports whether userID can see (and vote on) a poll: the post must be
+// visible to them, or they must be an accepted member of the group post's group.
+func canAccessPoll(postID, groupPostID sql.NullInt64, userID int64) (bool, error) {
+	if postID.Valid {
+		return canViewPost(postID.Int64, userID)
+	}
+	return canViewGroupPost(groupPostID.Int64, userID)
+}
+
+// pollForRequest loads the poll named in the URL path and checks that userID can access it.
+// It writes the error response itself and returns ok=false on failure.
+func pollForRequest(w http.ResponseWriter, r *http.Request, userID int64) (pollID int64, multipleChoice, closed bool, ok bool) {
+	pollID, err := strconv.ParseInt(r.PathValue("pollID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return 0, false, false, false
+	}
+
+	var postID, groupPostID sql.NullInt64
+	var closesAt, closedAt sql.NullTime
+	err = database.DB.QueryRow("SELECT post_id, group_post_id, multiple_choice, closes_at, closed_at FROM polls WHERE id = ?", pollID).
+		Scan(&postID, &groupPostID, &multipleChoice, &closesAt, &closedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Poll not found", http.StatusNotFound)
+			return 0, false, false, false
+		}
+		log.Printf("Error loading poll %d: %v", pollID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false, false, false
+	}
+
+	allowed, err := canAccessPoll(postID, groupPostID, userID)
+	if err != nil {
+		log.Printf("Error checking access to poll %d for user %d: %v", pollID, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false, false, false
+	}
+	if !allowed {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return 0, false, false, false
+	}
+	return pollID, multipleChoice, isPollClosed(closesAt, closedAt), true
+}
+
+// GetPollHandler returns a poll as seen by the authenticated user.
+// GET /polls/{pollID}
+func GetPollHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pollID, _, _, ok := pollForRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	writePollResponse(w, pollID, userID)
+}
+
+// VotePollHandler records the authenticated user's vote, replacing any previous vote.
+// POST /polls/{pollID}/votes
+func VotePollHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pollID, multipleChoice, closed, ok := pollForRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	if closed {
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	}
+
+	var req models.PollVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.OptionIDs) == 0 {
+		http.Error(w, "At least one option is required", http.StatusBadRequest)
+		return
+	}
+	if !multipleChoice && len(req.OptionIDs) > 1 {
+		http.Error(w, "This poll allows only one choice", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Voting replaces the user's previous choice(s)
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", pollID, userID); err != nil {
+		log.Printf("Error clearing votes on poll %d for user %d: %v", pollID, userID, err)
+		http.Error(w, "Failed to record vote", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[int64]bool, len(req.OptionIDs))
+	for _, optionID := range req.OptionIDs {
+		if seen[optionID] {
+			http.Error(w, "Duplicate option in vote", http.StatusBadRequest)
+			return
+		}
+		seen[optionID] = true
+
+		var belongs bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM poll_options WHERE id = ? AND poll_id = ?)", optionID, pollID).Scan(&belongs); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !belongs {
+			http.Error(w, "Option does not belong to this poll", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := tx.Exec("INSERT INTO poll_votes (poll_id, option_id, user_id, created_at) VALUES (?, ?, ?, ?)", pollID, optionID, userID, now); err != nil {
+			log.Printf("Error saving vote on poll %d for user %d: %v", pollID, userID, err)
+			http.Error(w, "Failed to record vote", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit vote", http.StatusInternalServerError)
+		return
+	}
+
+	go BroadcastPollUpdate(pollID, "poll_results_updated")
+	writePollResponse(w, pollID, userID)
+}
+
+// UnvotePollHandler removes the authenticated user's vote from a poll.
+// DELETE /polls/{pollID}/votes
+func UnvotePollHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pollID, _, closed, ok := pollForRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	if closed {
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", pollID, userID)
+	if err != nil {
+		log.Printf("Error removing votes on poll %d for user %d: %v", pollID, userID, err)
+		http.Error(w, "Failed to remove vote", http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "You have not voted on this poll", http.StatusNotFound)
+		return
+	}
+
+	go BroadcastPollUpdate(pollID, "poll_results_updated")
+	writePollResponse(w, pollID, userID)
+}
+
+func writePollResponse(w http.ResponseWriter, pollID, viewerID int64) {
+	poll, err := loadPoll(pollID, viewerID)
+	if err != nil {
+		log.Printf("Error loading poll %d: %v", pollID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// closeDuePolls closes every open poll whose close time has passed. Polls on
+// drafts and scheduled posts wait until the post is published.
+func closeDuePolls() {
+	rows, err := database.DB.Query(`
+        SELECT id FROM polls
+        WHERE closed_at IS NULL AND closes_at IS NOT NULL AND closes_at <= ?
+          AND (post_id IS NULL OR post_id IN (SELECT id FROM posts WHERE status = 'published'))
+    `, time.Now().UTC())
+	if err != nil {
+		log.Printf("Poll closer: error querying due polls: %v", err)
+		return
+	}
+
+	var dueIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			dueIDs = append(dueIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, pollID := range dueIDs {
+		closePoll(pollID)
+	}
+}
+
+// closePoll marks a poll closed, tells its creator and pushes the final results.
+func closePoll(pollID int64) {
+	result, err := database.DB.Exec("UPDATE polls SET closed_at = ? WHERE id = ? AND closed_at IS NULL", time.Now().UTC(), pollID)
+	if err != nil {
+		log.Printf("Poll closer: error closing poll %d: %v", pollID, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return
+	}
+
+	var creatorID int64
+	var totalVoters int
+	err = database.DB.QueryRow(`
+        SELECT creator_id, (SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_id = polls.id)
+        FROM polls WHERE id = ?
+    `, pollID).Scan(&creatorID, &totalVoters)
+	if err != nil {
+		log.Printf("Poll closer: error loading poll %d: %v", pollID, err)
+		return
+	}
+
+	NotificationHelper.CreatePollClosedNotification(int(creatorID), int(pollID), totalVoters)
+	BroadcastPollUpdate(pollID, "poll_closed")
+	log.Printf("Poll %d closed with %d voter(s)", pollID, totalVoters)
+}
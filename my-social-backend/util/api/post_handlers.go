@@ -40,25 +40,87 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate privacy level (0=public, 1=followers, 2=close_friends)
+	// Validate privacy level (0=public, 1=followers, 2=audience lists)
 	if req.Privacy < 0 || req.Privacy > 2 {
 		http.Error(w, "Invalid privacy level", http.StatusBadRequest)
 		return
 	}
+	if req.Privacy != 2 && len(req.AudienceListIDs) > 0 {
+		http.Error(w, "audience_list_ids requires privacy 2", http.StatusBadRequest)
+		return
+	}
+
+	// Work out the publication state (published immediately unless told otherwise)
+	status := req.Status
+	if status == "" {
+		status = models.PostStatusPublished
+		if req.PublishAt != nil {
+			status = models.PostStatusScheduled
+		}
+	}
 
 	now := time.Now()
-	stmt, err := database.DB.Prepare(`
-        INSERT INTO posts (user_id, content, image_path, privacy, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?)
-    `)
+	var publishAt *time.Time
+	switch status {
+	case models.PostStatusPublished:
+		// publish_at stays NULL for posts that go live right away
+	case models.PostStatusDraft:
+		// Drafts carry no publish time until they are scheduled or published
+	case models.PostStatusScheduled:
+		if req.PublishAt == nil {
+			http.Error(w, "publish_at is required for scheduled posts", http.StatusBadRequest)
+			return
+		}
+		if !req.PublishAt.After(now) {
+			http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		utc := req.PublishAt.UTC()
+		publishAt = &utc
+	default:
+		http.Error(w, "Invalid status. Must be 'draft', 'scheduled' or 'published'.", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the optional poll before anything is written
+	var pollOptions []string
+	if req.Poll != nil {
+		var msg string
+		pollOptions, msg = validatePollRequest(req.Poll, publishAt)
+		if msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	media, errStatus, msg := resolveMediaAttachments(userID, req.Media, req.ImagePath)
+	if msg != "" {
+		http.Error(w, msg, errStatus)
+		return
+	}
+
+	var audience []int64
+	if req.Privacy == 2 {
+		audience, errStatus, msg = resolvePostAudience(userID, req.AudienceListIDs)
+		if msg != "" {
+			http.Error(w, msg, errStatus)
+			return
+		}
+	}
+
+	// The post, its media, its audience and its poll are created together
+	tx, err := database.DB.Begin()
 	if err != nil {
-		http.Error(w, "Failed to prepare statement: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Error preparing insert post statement: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting post transaction: %v", err)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	result, err := stmt.Exec(userID, req.Content, req.ImagePath, req.Privacy, now, now)
+	result, err := tx.Exec(`
+        INSERT INTO posts (user_id, content, privacy, status, publish_at, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, userID, req.Content, req.Privacy, status, publishAt, now, now)
 	if err != nil {
 		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
 		log.Printf("Error inserting post for user %d: %v", userID, err)
@@ -72,43 +134,43 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var authorUsername string
-	var authorFirstName, authorLastName, authorAvatar sql.NullString
-	err = database.DB.QueryRow("SELECT username, first_name, last_name, avatar FROM users WHERE id = ?", userID).Scan(&authorUsername, &authorFirstName, &authorLastName, &authorAvatar)
-	if err != nil {
-		log.Printf("Error fetching user details for author %d of new post %d: %v", userID, postID, err)
-		authorUsername = "unknown"
-	}
-
-	// Prepare the post response
-	postResp := models.PostResponse{
-		ID:              postID,
-		UserID:          userID,
-		AuthorUsername:  authorUsername,
-		AuthorFirstName: authorFirstName.String,
-		AuthorLastName:  authorLastName.String,
-		AuthorAvatar:    authorAvatar.String,
-		Content:         req.Content,
-		ImagePath:       req.ImagePath,
-		Privacy:         req.Privacy,
-		CreatedAt:       now,
-		UpdatedAt:       now,
-	}
-
-	// Broadcast the new post to all online users except the author
-	// Import the BroadcastToUser and activeConnections from ws_handlers.go
-	// Only send to users who are allowed to see the post (privacy check)
-	// For simplicity, broadcast to all online users except the author
-	// (You can refine this to match your privacy logic if needed)
-	// Import: "reda-social-network/util/api/ws_handlers"
-	// Use: ws_handlers.BroadcastToUser
-	// But since both are in package api, just call BroadcastToUser
-	for onlineUserID := range activeConnections {
-		if onlineUserID == userID {
-			continue
+	if err := attachMedia(tx, attachToPost, postID, media); err != nil {
+		writeAttachMediaError(w, err)
+		log.Printf("Error attaching media to post %d: %v", postID, err)
+		return
+	}
+
+	if err := setPostAudience(tx, postID, audience); err != nil {
+		http.Error(w, "Failed to set post audience", http.StatusInternalServerError)
+		log.Printf("Error setting audience of post %d: %v", postID, err)
+		return
+	}
+
+	if req.Poll != nil {
+		if _, err := createPoll(tx, attachToPost, postID, userID, req.Poll, pollOptions); err != nil {
+			http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+			log.Printf("Error creating poll for post %d: %v", postID, err)
+			return
 		}
-		// Optionally: check if onlineUserID is allowed to see this post (privacy)
-		BroadcastToUser(onlineUserID, "new_post", postResp)
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create post", http.StatusInternalServerError)
+		log.Printf("Error committing post for user %d: %v", userID, err)
+		return
+	}
+
+	postResp, err := fetchPostResponse(postID)
+	if err != nil {
+		http.Error(w, "Failed to load created post: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error loading new post %d: %v", postID, err)
+		return
+	}
+
+	if status == models.PostStatusPublished {
+		onPostPublished(postResp)
+	} else {
+		log.Printf("User %d saved post %d as %s", userID, postID, status)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -116,6 +178,68 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(postResp)
 }
 
+// onPostPublished runs the side effects of a post going live. It is shared by
+// CreatePostHandler, PublishPostHandler and the post scheduler so that a post
+// behaves the same no matter how it was published; anything else that should
+// happen on publication (such as notifications) belongs here.
+func onPostPublished(post models.PostResponse) {
+	// Other users see the poll without results until they vote
+	if post.Poll != nil {
+		poll, err := loadPollFor(attachToPost, post.ID, 0)
+		if err != nil {
+			log.Printf("Error loading poll for post %d: %v", post.ID, err)
+		}
+		post.Poll = poll
+	}
+
+	// Broadcast the new post to all online users except the author who are
+	// allowed to see it (privacy and blocks) and haven't muted the author
+	onlineIDs := onlineUserIDs()
+
+	for _, onlineUserID := range onlineIDs {
+		if onlineUserID == post.UserID {
+			continue
+		}
+		if visible, err := canViewPost(post.ID, onlineUserID); err != nil || !visible {
+			continue
+		}
+		if !shouldPush(onlineUserID, muteUser, post.UserID) {
+			continue
+		}
+		BroadcastToUser(onlineUserID, "new_post", post)
+	}
+}
+
+// fetchPostResponse loads a single post with its author details, media and poll.
+// The poll is as its author sees it.
+func fetchPostResponse(postID int64) (models.PostResponse, error) {
+	var p models.PostResponse
+	var firstName, lastName, avatar sql.NullString
+	var publishAt sql.NullTime
+	err := database.DB.QueryRow(`
+        SELECT p.id, p.user_id, u.username, u.first_name, u.last_name, u.avatar, p.content, p.privacy,
+               p.status, p.publish_at, p.created_at, p.updated_at
+        FROM posts p
+        JOIN users u ON p.user_id = u.id
+        WHERE p.id = ?
+    `, postID).Scan(&p.ID, &p.UserID, &p.AuthorUsername, &firstName, &lastName, &avatar, &p.Content, &p.Privacy,
+		&p.Status, &publishAt, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	p.AuthorFirstName = firstName.String
+	p.AuthorLastName = lastName.String
+	p.AuthorAvatar = avatar.String
+	if publishAt.Valid {
+		p.PublishAt = &publishAt.Time
+	}
+	if err := loadPostMedia(&p); err != nil {
+		return p, err
+	}
+	p.Poll, err = loadPollFor(attachToPost, p.ID, p.UserID)
+	return p, err
+}
+
 // GetPostsHandler handles fetching all posts.
 // Enhanced to include like counts and whether the current user liked each post.
 func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
@@ -126,19 +250,19 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 
 	currentUserID, _ := util.GetUserIDFromRequest(r)
 
+	visibility, visibilityArgs := postVisibilityClause(currentUserID)
+	// Muted users keep their follow, but their posts stay out of the feed
+	notMuted, muteArgs := notMutedClause("p.user_id", currentUserID)
 	query := `
-        SELECT p.id, p.user_id, u.username, u.first_name, u.last_name, u.avatar, p.content, p.image_path, p.privacy, p.created_at, p.updated_at,
+        SELECT p.id, p.user_id, u.username, u.first_name, u.last_name, u.avatar, p.content, p.privacy, p.created_at, p.updated_at,
                (SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id AND l.is_like = true) as like_count,
                (SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id AND l.is_like = false) as dislike_count
         FROM posts p
         JOIN users u ON p.user_id = u.id
-        WHERE 
-            (p.privacy = 0) OR  -- Public posts
-            (p.privacy = 1 AND (p.user_id = ? OR EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accept'))) OR  -- Followers only posts
-            (p.privacy = 2 AND (p.user_id = ? OR EXISTS(SELECT 1 FROM close_friends WHERE user_id = p.user_id AND close_friend_id = ?)))  -- Close friends only posts
+        WHERE p.status = 'published' AND ` + visibility + ` AND ` + notMuted + `
         ORDER BY p.created_at DESC
     `
-	rows, err := database.DB.Query(query, currentUserID, currentUserID, currentUserID, currentUserID)
+	rows, err := database.DB.Query(query, append(visibilityArgs, muteArgs...)...)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		log.Printf("Error querying posts with author and like count: %v", err)
@@ -149,8 +273,8 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	var posts []models.PostResponse // Use models.PostResponse
 	for rows.Next() {
 		var p models.PostResponse // Use models.PostResponse
-		var firstName, lastName, avatar, imagePath sql.NullString
-		if err := rows.Scan(&p.ID, &p.UserID, &p.AuthorUsername, &firstName, &lastName, &avatar, &p.Content, &imagePath, &p.Privacy, &p.CreatedAt, &p.UpdatedAt, &p.LikeCount, &p.DislikeCount); err != nil {
+		var firstName, lastName, avatar sql.NullString
+		if err := rows.Scan(&p.ID, &p.UserID, &p.AuthorUsername, &firstName, &lastName, &avatar, &p.Content, &p.Privacy, &p.CreatedAt, &p.UpdatedAt, &p.LikeCount, &p.DislikeCount); err != nil {
 			http.Error(w, "Error scanning post row: "+err.Error(), http.StatusInternalServerError)
 			log.Printf("Error scanning post with author/like count: %v", err)
 			return
@@ -160,7 +284,10 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 		p.AuthorFirstName = firstName.String
 		p.AuthorLastName = lastName.String
 		p.AuthorAvatar = avatar.String
-		p.ImagePath = imagePath.String
+
+		if err := loadPostMedia(&p); err != nil {
+			log.Printf("Error loading media for post %d: %v", p.ID, err)
+		}
 
 		if currentUserID != 0 {
 			// Check if user liked this post
@@ -175,6 +302,12 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		poll, err := loadPollFor(attachToPost, p.ID, currentUserID)
+		if err != nil {
+			log.Printf("Error loading poll for post %d: %v", p.ID, err)
+		}
+		p.Poll = poll
+
 		posts = append(posts, p)
 	}
 
@@ -218,8 +351,7 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the post exists and get its details
 	var postUserID int64
-	var imagePath sql.NullString
-	err = database.DB.QueryRow("SELECT user_id, image_path FROM posts WHERE id = ?", postID).Scan(&postUserID, &imagePath)
+	err = database.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&postUserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Post not found", http.StatusNotFound)
@@ -263,6 +395,34 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Delete the post's poll along with its votes
+	if err = deletePollsFor(tx, attachToPost, postID); err != nil {
+		log.Printf("Error deleting poll for post %d: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Detach the post's media; uploads no other post uses are removed after the commit
+	mediaIDs, err := attachedMediaIDs(attachToPost, postID)
+	if err != nil {
+		log.Printf("Error loading media for post %d: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err = deleteMediaFor(tx, attachToPost, postID); err != nil {
+		log.Printf("Error deleting media for post %d: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the lists the post was shared with
+	_, err = tx.Exec("DELETE FROM post_audiences WHERE post_id = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting audience of post %d: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	// Delete notifications related to this post
 	_, err = tx.Exec("DELETE FROM notifications WHERE related_id = ? AND related_type IN ('post', 'like', 'comment')", postID)
 	if err != nil {
@@ -300,21 +460,7 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If there was an image associated with the post, optionally delete it from the filesystem
-	if imagePath.Valid && imagePath.String != "" {
-		// Note: You might want to implement file deletion logic here
-		// For safety, we're not automatically deleting files in this implementation
-		// You can add file deletion logic if needed:
-		//
-		// import "os"
-		// import "path/filepath"
-		//
-		// fullPath := filepath.Join("uploads", imagePath.String)
-		// if err := os.Remove(fullPath); err != nil {
-		//     log.Printf("Warning: Could not delete image file %s: %v", fullPath, err)
-		// }
-		log.Printf("Post %d deleted successfully. Image file %s was not automatically removed from filesystem.", postID, imagePath.String)
-	}
+	removeUnreferencedMedia(r.Context(), mediaIDs)
 
 	log.Printf("User %d successfully deleted post %d", userID, postID)
 
@@ -326,3 +472,208 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		"post_id": postID,
 	})
 }
+
+// ListDraftPostsHandler returns the authenticated user's unpublished drafts.
+// GET /posts/drafts
+func ListDraftPostsHandler(w http.ResponseWriter, r *http.Request) {
+	listOwnPostsByStatus(w, r, models.PostStatusDraft, "p.updated_at DESC")
+}
+
+// ListScheduledPostsHandler returns the authenticated user's scheduled posts, soonest first.
+// GET /posts/scheduled
+func ListScheduledPostsHandler(w http.ResponseWriter, r *http.Request) {
+	listOwnPostsByStatus(w, r, models.PostStatusScheduled, "p.publish_at ASC")
+}
+
+// listOwnPostsByStatus writes the authenticated user's posts with the given status.
+// Unpublished posts are never listed for anyone but their author.
+func listOwnPostsByStatus(w http.ResponseWriter, r *http.Request, status string, orderBy string) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized: User ID not found in session context.", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT p.id, p.user_id, u.username, u.first_name, u.last_name, u.avatar, p.content, p.privacy,
+               p.status, p.publish_at, p.created_at, p.updated_at
+        FROM posts p
+        JOIN users u ON p.user_id = u.id
+        WHERE p.user_id = ? AND p.status = ?
+        ORDER BY `+orderBy, userID, status)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error querying %s posts for user %d: %v", status, userID, err)
+		return
+	}
+	defer rows.Close()
+
+	var posts []models.PostResponse
+	for rows.Next() {
+		var p models.PostResponse
+		var firstName, lastName, avatar sql.NullString
+		var publishAt sql.NullTime
+		if err := rows.Scan(&p.ID, &p.UserID, &p.AuthorUsername, &firstName, &lastName, &avatar, &p.Content, &p.Privacy,
+			&p.Status, &publishAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			log.Printf("Error scanning %s post for user %d: %v", status, userID, err)
+			continue
+		}
+		p.AuthorFirstName = firstName.String
+		p.AuthorLastName = lastName.String
+		p.AuthorAvatar = avatar.String
+		if publishAt.Valid {
+			p.PublishAt = &publishAt.Time
+		}
+		if err := loadPostMedia(&p); err != nil {
+			log.Printf("Error loading media for post %d: %v", p.ID, err)
+		}
+		if p.Poll, err = loadPollFor(attachToPost, p.ID, userID); err != nil {
+			log.Printf("Error loading poll for post %d: %v", p.ID, err)
+		}
+		posts = append(posts, p)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating post rows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if posts == nil {
+		posts = []models.PostResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// PublishPostHandler publishes a draft or scheduled post now, or (re)schedules it
+// when a future publish_at is given.
+// POST /posts/{postID}/publish
+func PublishPostHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized: User ID not found in session context.", http.StatusUnauthorized)
+		return
+	}
+
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.PublishPostRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var postUserID int64
+	var status string
+	err = database.DB.QueryRow("SELECT user_id, status FROM posts WHERE id = ?", postID).Scan(&postUserID, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error checking post %d for publishing: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if postUserID != userID {
+		// Unpublished posts are invisible to everyone else, so don't reveal they exist
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if status == models.PostStatusPublished {
+		http.Error(w, "Post is already published", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	scheduled := req.PublishAt != nil && req.PublishAt.After(now)
+	goLive := now
+	if scheduled {
+		goLive = *req.PublishAt
+	}
+
+	// The post's poll may not close before the post goes live
+	var pollClosesFirst bool
+	err = database.DB.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM polls WHERE post_id = ? AND closes_at IS NOT NULL AND closes_at <= ?)
+    `, postID, goLive.UTC()).Scan(&pollClosesFirst)
+	if err != nil {
+		log.Printf("Error checking poll of post %d: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if pollClosesFirst && scheduled {
+		http.Error(w, "publish_at must be before the post's poll closes", http.StatusBadRequest)
+		return
+	}
+	if pollClosesFirst {
+		http.Error(w, "The post's poll has already closed", http.StatusBadRequest)
+		return
+	}
+
+	if scheduled {
+		_, err = database.DB.Exec("UPDATE posts SET status = 'scheduled', publish_at = ?, updated_at = ? WHERE id = ?",
+			req.PublishAt.UTC(), now, postID)
+		if err != nil {
+			log.Printf("Error scheduling post %d: %v", postID, err)
+			http.Error(w, "Failed to schedule post", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d scheduled post %d for %s", userID, postID, req.PublishAt.UTC().Format(time.RFC3339))
+	} else {
+		published, err := publishPost(postID, status)
+		if err != nil {
+			log.Printf("Error publishing post %d: %v", postID, err)
+			http.Error(w, "Failed to publish post", http.StatusInternalServerError)
+			return
+		}
+		if !published {
+			// The scheduler got there first
+			http.Error(w, "Post is already published", http.StatusConflict)
+			return
+		}
+	}
+
+	postResp, err := fetchPostResponse(postID)
+	if err != nil {
+		log.Printf("Error loading post %d after publishing: %v", postID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(postResp)
+}
+
+// publishPost flips a draft or scheduled post to published and runs the
+// publication side effects. fromStatus guards against publishing twice when the
+// scheduler and a user race; the returned bool is false if nothing changed.
+func publishPost(postID int64, fromStatus string) (bool, error) {
+	now := time.Now()
+	// The post appears in feeds as of the moment it goes live
+	result, err := database.DB.Exec(`
+        UPDATE posts SET status = 'published', created_at = ?, updated_at = ?
+        WHERE id = ? AND status = ?
+    `, now, now, postID, fromStatus)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	post, err := fetchPostResponse(postID)
+	if err != nil {
+		return true, err
+	}
+	onPostPublished(post)
+	log.Printf("Post %d by user %d published", postID, post.UserID)
+	return true, nil
+}
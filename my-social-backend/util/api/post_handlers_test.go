@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// A draft can't go live, now or later, once its poll has closed.
+func TestPublishPostPollClosesFirst(t *testing.T) {
+	tests := []struct {
+		name     string
+		closesIn time.Duration
+		body     string
+		status   int
+	}{
+		{"now, poll still open", time.Hour, "", http.StatusOK},
+		{"now, poll closed", -time.Minute, "", http.StatusBadRequest},
+		{"scheduled before the poll closes", 2 * time.Hour, `{"publish_at":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, http.StatusOK},
+		{"scheduled after the poll closes", 30 * time.Minute, `{"publish_at":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			userID := createTestUser(t, "author")
+			res, err := database.DB.Exec("INSERT INTO posts (user_id, content, status) VALUES (?, 'vote!', 'draft')", userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			postID, _ := res.LastInsertId()
+			_, err = database.DB.Exec("INSERT INTO polls (post_id, creator_id, closes_at) VALUES (?, ?, ?)",
+				postID, userID, time.Now().Add(tt.closesIn).UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := strconv.FormatInt(postID, 10)
+			r := httptest.NewRequest(http.MethodPost, "/posts/"+id+"/publish", strings.NewReader(tt.body))
+			r.SetPathValue("postID", id)
+			r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+			w := httptest.NewRecorder()
+			PublishPostHandler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("got %d %s, want %d", w.Code, strings.TrimSpace(w.Body.String()), tt.status)
+			}
+
+			var status string
+			database.DB.QueryRow("SELECT status FROM posts WHERE id = ?", postID).Scan(&status)
+			if tt.status != http.StatusOK && status != models.PostStatusDraft {
+				t.Errorf("refused post is %s, want it left a draft", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/models"
+)
+
+// Columns that link attachments (polls, media) to a post or to a group post.
+const (
+	attachToPost      = "post_id"
+	attachToGroupPost = "group_post_id"
+)
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// resolveMediaAttachments validates the media userID wants to attach and returns it in
+// display order. legacyPath is the deprecated image_path field, used only when no media
+// list is given. On failure it returns the HTTP status and message to send.
+func resolveMediaAttachments(userID int64, items []models.AttachMediaRequest, legacyPath string) ([]models.AttachMediaRequest, int, string) {
+	if len(items) == 0 && legacyPath != "" {
+		var mediaID int64
+		err := database.DB.QueryRow("SELECT id FROM media_uploads WHERE file_path = ? AND user_id = ?", legacyPath, userID).Scan(&mediaID)
+		if err == sql.ErrNoRows {
+			return nil, http.StatusBadRequest, "image_path does not match one of your uploads"
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Database error"
+		}
+		items = []models.AttachMediaRequest{{MediaID: mediaID}}
+	}
+
+	if len(items) > models.PostMaxMedia {
+		return nil, http.StatusBadRequest, fmt.Sprintf("A post can have at most %d media items", models.PostMaxMedia)
+	}
+
+	seen := make(map[int64]bool, len(items))
+	resolved := make([]models.AttachMediaRequest, 0, len(items))
+	for _, item := range items {
+		if seen[item.MediaID] {
+			return nil, http.StatusBadRequest, "The same media item cannot be attached twice"
+		}
+		seen[item.MediaID] = true
+
+		item.AltText = strings.TrimSpace(item.AltText)
+		if len(item.AltText) > models.MediaMaxAltLength {
+			return nil, http.StatusBadRequest, fmt.Sprintf("Alt text cannot be longer than %d characters", models.MediaMaxAltLength)
+		}
+
+		var uploaderID int64
+		err := database.DB.QueryRow("SELECT user_id FROM media_uploads WHERE id = ?", item.MediaID).Scan(&uploaderID)
+		if err == sql.ErrNoRows {
+			return nil, http.StatusBadRequest, fmt.Sprintf("Media %d not found", item.MediaID)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Database error"
+		}
+		if uploaderID != userID {
+			return nil, http.StatusForbidden, "You can only attach your own uploads"
+		}
+		resolved = append(resolved, item)
+	}
+	return resolved, 0, ""
+}
+
+// attachMedia links resolved media to a post or group post as part of the caller's
+// transaction. It fails with errMediaGone if an upload was deleted since it was
+// resolved.
+func attachMedia(tx *sql.Tx, ownerColumn string, ownerID int64, items []models.AttachMediaRequest) error {
+	for i, item := range items {
+		// Retain first, so a deleted upload is never linked
+		if err := retainMedia(tx, item.MediaID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO post_media ("+ownerColumn+", media_id, position, alt_text) VALUES (?, ?, ?, ?)",
+			ownerID, item.MediaID, i, item.AltText,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAttachMediaError reports an attachMedia failure: a conflict if an upload
+// disappeared in the meantime, a server error otherwise.
+func writeAttachMediaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMediaGone) {
+		http.Error(w, "An attached upload no longer exists; upload it again", http.StatusConflict)
+		return
+	}
+	http.Error(w, "Failed to attach media", http.StatusInternalServerError)
+}
+
+// deleteMediaFor detaches all media from a post or group post. Uploads left without
+// references are removed by removeUnreferencedMedia once the deletion is committed.
+func deleteMediaFor(ex sqlExecer, ownerColumn string, ownerID int64) error {
+	_, err := ex.Exec(`
+        UPDATE media_uploads
+        SET ref_count = ref_count - 1,
+            unreferenced_since = CASE WHEN ref_count <= 1 THEN ? ELSE unreferenced_since END
+        WHERE id IN (SELECT media_id FROM post_media WHERE `+ownerColumn+` = ?) AND ref_count > 0
+    `, time.Now().UTC(), ownerID)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec("DELETE FROM post_media WHERE "+ownerColumn+" = ?", ownerID)
+	return err
+}
+
+// attachedMediaIDs returns the uploads attached to a post or group post.
+func attachedMediaIDs(ownerColumn string, ownerID int64) ([]int64, error) {
+	rows, err := database.DB.Query("SELECT media_id FROM post_media WHERE "+ownerColumn+" = ?", ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// canViewMedia reports whether viewerID may fetch the upload stored at url (the
+// original or one of its variants): they uploaded it, or it is attached to a post
+// or group post they can see. Unknown URLs are not viewable.
+func canViewMedia(url string, viewerID int64) (bool, error) {
+	var mediaID, uploaderID int64
+	err := database.DB.QueryRow(
+		"SELECT id, user_id FROM media_uploads WHERE file_path = ? OR thumbnail_path = ? OR medium_path = ?",
+		url, url, url,
+	).Scan(&mediaID, &uploaderID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if viewerID == 0 {
+		return false, nil
+	}
+	if uploaderID == viewerID {
+		return true, nil
+	}
+
+	rows, err := database.DB.Query("SELECT post_id, group_post_id FROM post_media WHERE media_id = ?", mediaID)
+	if err != nil {
+		return false, err
+	}
+	var owners [][2]sql.NullInt64
+	for rows.Next() {
+		var postID, groupPostID sql.NullInt64
+		if err := rows.Scan(&postID, &groupPostID); err != nil {
+			rows.Close()
+			return false, err
+		}
+		owners = append(owners, [2]sql.NullInt64{postID, groupPostID})
+	}
+	rows.Close()
+
+	for _, owner := range owners {
+		var visible bool
+		if owner[0].Valid {
+			visible, err = canViewPost(owner[0].Int64, viewerID)
+		} else {
+			visible, err = canViewGroupPost(owner[1].Int64, viewerID)
+		}
+		if err != nil || visible {
+			return visible, err
+		}
+	}
+	return false, nil
+}
+
+// loadMediaFor returns the media attached to a post or group post in display order.
+func loadMediaFor(ownerColumn string, ownerID int64) ([]models.PostMediaResponse, error) {
+	rows, err := database.DB.Query(`
+        SELECT pm.media_id, m.file_path, COALESCE(m.thumbnail_path, ''), COALESCE(m.medium_path, ''),
+               m.mime_type, m.width, m.height, pm.position, pm.alt_text
+        FROM post_media pm
+        JOIN media_uploads m ON m.id = pm.media_id
+        WHERE pm.`+ownerColumn+` = ?
+        ORDER BY pm.position ASC
+    `, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []models.PostMediaResponse{}
+	for rows.Next() {
+		var item models.PostMediaResponse
+		if err := rows.Scan(&item.MediaID, &item.ImagePath, &item.ThumbnailPath, &item.MediumPath, &item.MimeType, &item.Width, &item.Height, &item.Position, &item.AltText); err != nil {
+			return nil, err
+		}
+		media = append(media, item)
+	}
+	return media, rows.Err()
+}
+
+// loadPostMedia fills in a post's media and the legacy image_path (its first item).
+func loadPostMedia(p *models.PostResponse) error {
+	media, err := loadMediaFor(attachToPost, p.ID)
+	if err != nil {
+		p.Media = []models.PostMediaResponse{}
+		return err
+	}
+	p.Media = media
+	if len(media) > 0 {
+		p.ImagePath = media[0].ImagePath
+	}
+	return nil
+}
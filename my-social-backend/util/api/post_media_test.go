@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"reda-social-network/database"
+	"reda-social-network/models"
+)
+
+// createTestUpload records an unreferenced upload by userID and returns its ID.
+func createTestUpload(t *testing.T, userID int64, path string) int64 {
+	t.Helper()
+	res, err := database.DB.Exec(
+		"INSERT INTO media_uploads (user_id, file_path, mime_type, unreferenced_since) VALUES (?, ?, 'image/png', CURRENT_TIMESTAMP)",
+		userID, path,
+	)
+	if err != nil {
+		t.Fatalf("creating upload %s: %v", path, err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// An upload deleted between resolveMediaAttachments and the post's transaction
+// must not be linked to the post.
+func TestAttachMediaDeletedUpload(t *testing.T) {
+	newTestDB(t)
+	useTestMediaStore(t)
+	userID := createTestUser(t, "poster")
+	kept := createTestUpload(t, userID, "/uploads/posts/kept.png")
+	gone := createTestUpload(t, userID, "/uploads/posts/gone.png")
+	items, status, msg := resolveMediaAttachments(userID, []models.AttachMediaRequest{{MediaID: kept}, {MediaID: gone}}, "")
+	if status != 0 {
+		t.Fatalf("resolving media: %d %s", status, msg)
+	}
+
+	removeUnreferencedMedia(t.Context(), []int64{gone}) // as the sweeper would
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := attachMedia(tx, attachToPost, 1, items); !errors.Is(err, errMediaGone) {
+		t.Fatalf("attachMedia: got %v, want errMediaGone", err)
+	}
+	tx.Rollback()
+
+	var links, refs int
+	database.DB.QueryRow("SELECT COUNT(*) FROM post_media").Scan(&links)
+	database.DB.QueryRow("SELECT ref_count FROM media_uploads WHERE id = ?", kept).Scan(&refs)
+	if links != 0 || refs != 0 {
+		t.Errorf("after the failed attach: %d post_media row(s), kept upload ref_count %d; want none and 0", links, refs)
+	}
+}
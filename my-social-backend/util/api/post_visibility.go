@@ -0,0 +1,50 @@
+package api
+
+import (
+	"reda-social-network/database"
+)
+
+// postVisibilityClause returns a SQL condition (and its arguments) that limits
+// rows of the posts table aliased as p to the ones viewerID is allowed to see.
+// Unpublished posts (drafts and scheduled posts) are only visible to their author,
+// and posts by users who blocked the viewer (or whom the viewer blocked) are hidden.
+func postVisibilityClause(viewerID int64) (string, []interface{}) {
+	notBlocked, blockArgs := notBlockedClause("p.user_id", viewerID)
+	clause := `
+        (p.status = 'published' OR p.user_id = ?) AND (
+            (p.privacy = 0) OR  -- Public posts
+            (p.privacy = 1 AND (p.user_id = ? OR EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accept'))) OR  -- Followers only posts
+            (p.privacy = 2 AND (p.user_id = ? OR EXISTS(  -- Posts shared with audience lists (close friends by default)
+                SELECT 1 FROM post_audiences pa
+                JOIN audience_list_members alm ON alm.list_id = pa.list_id
+                WHERE pa.post_id = p.id AND alm.member_id = ?
+            )))
+        ) AND ` + notBlocked
+	args := []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID}
+	return clause, append(args, blockArgs...)
+}
+
+// canViewPost reports whether the post exists and viewerID is allowed to see it.
+func canViewPost(postID, viewerID int64) (bool, error) {
+	clause, args := postVisibilityClause(viewerID)
+	var visible bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ? AND "+clause+")",
+		append([]interface{}{postID}, args...)...,
+	).Scan(&visible)
+	return visible, err
+}
+
+// canViewGroupPost reports whether viewerID is an accepted member of the group the
+// group post belongs to.
+func canViewGroupPost(groupPostID, viewerID int64) (bool, error) {
+	var isMember bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM group_posts gp
+            JOIN group_members gm ON gm.group_id = gp.group_id
+            WHERE gp.id = ? AND gm.user_id = ? AND gm.status = 'accepted'
+        )
+    `, groupPostID, viewerID).Scan(&isMember)
+	return isMember, err
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"reda-social-network/database"
+)
+
+// What to do with pending follow requests when an account goes public.
+const (
+	pendingRequestsAccept = "accept" // approve them all (the default)
+	pendingRequestsKeep   = "keep"   // leave them for the user to handle one by one
+)
+
+// onPrivacyChanged runs after a user's account switches between public and private.
+// Going public approves the pending follow requests unless the user chose to keep
+// them; going private optionally asks the user to review their current followers.
+func onPrivacyChanged(userID int64, isPrivate bool, pendingRequests string, reviewFollowers bool) {
+	if !isPrivate {
+		if pendingRequests == pendingRequestsKeep {
+			return
+		}
+		approved, err := acceptPendingFollowRequests(userID)
+		if err != nil {
+			log.Printf("Error approving pending follow requests for user %d: %v", userID, err)
+			return
+		}
+		if len(approved) == 0 {
+			return
+		}
+		log.Printf("User %d went public; approved %d pending follow request(s)", userID, len(approved))
+
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Error creating follow approval notifications: %v", r)
+				}
+			}()
+			// Each requester hears about their own request; the account owner gets a
+			// single summary instead of one notification per requester
+			for _, followerID := range approved {
+				NotificationHelper.CreateFollowAcceptedNotification(int(followerID), int(userID))
+			}
+			NotificationHelper.CreateFollowRequestsApprovedNotification(int(userID), len(approved))
+		}()
+		return
+	}
+
+	if !reviewFollowers {
+		return
+	}
+	var followers int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM followers WHERE followed_id = ? AND status = 'accept'", userID).Scan(&followers)
+	if err != nil {
+		log.Printf("Error counting followers of user %d: %v", userID, err)
+		return
+	}
+	if followers == 0 {
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Error creating review followers notification: %v", r)
+			}
+		}()
+		NotificationHelper.CreateReviewFollowersNotification(int(userID), followers)
+	}()
+}
+
+// acceptPendingFollowRequests approves every pending follow request to userID and
+// removes the now stale request notifications. It returns the approved followers.
+func acceptPendingFollowRequests(userID int64) ([]int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT follower_id FROM followers WHERE followed_id = ? AND status = 'pending'", userID)
+	if err != nil {
+		return nil, err
+	}
+	var followerIDs []int64
+	for rows.Next() {
+		var followerID int64
+		if err := rows.Scan(&followerID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		followerIDs = append(followerIDs, followerID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(followerIDs) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec("UPDATE followers SET status = 'accept', updated_at = ? WHERE followed_id = ? AND status = 'pending'", time.Now(), userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM notifications WHERE user_id = ? AND type = 'follow_request'", userID); err != nil {
+		return nil, err
+	}
+	return followerIDs, tx.Commit()
+}
@@ -41,6 +41,25 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 
 	loggedInUserID, errAuth := util.GetUserIDFromRequest(r)
 
+	viewerID := loggedInUserID
+	if errAuth != nil {
+		viewerID = 0
+	}
+
+	// What the viewer may see is decided by the profile policy
+	policy, err := loadProfilePolicy(targetUserID, viewerID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error V2 profile (policy) for viewer %d to target %d: %v", viewerID, targetUserID, err)
+		http.Error(w, "Database error checking profile visibility (V2)", http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows || !policy.canView() {
+		// Profiles are hidden between users who have blocked each other
+		http.Error(w, "User not found (V2)", http.StatusNotFound)
+		return
+	}
+	canViewFullContent := policy.canViewContent()
+
 	// --- 1. Fetch Basic User Information ---
 	var basicInfo models.UserBasicInfoV2
 	var firstName, lastName, avatar, aboutMe, dobStr, email sql.NullString
@@ -77,33 +96,38 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 	basicInfo.Email = email.String // Email is part of UserBasicInfoV2
 	basicInfo.CreatedAt = createdAt
 	basicInfo.IsPrivate = isPrivate
+	// Drop what the policy hides: everything but basic info on private profiles the
+	// viewer doesn't follow, and fields the owner restricted
+	policy.redactBasicInfo(&basicInfo)
 
 	// --- 2. Fetch User Stats ---
 	var stats models.UserStatsV2
-	// Fetch followers count
-	err = database.DB.QueryRow(`SELECT COUNT(*) FROM followers WHERE followed_id = ? AND status = 'accept'`, targetUserID).Scan(&stats.FollowersCount)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error V2 profile (followers count) for ID %d: %v", targetUserID, err)
-		// Potentially return error or log and continue with 0
-	}
-	// Fetch following count
-	err = database.DB.QueryRow(`SELECT COUNT(*) FROM followers WHERE follower_id = ? AND status = 'accept'`, targetUserID).Scan(&stats.FollowingCount)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error V2 profile (following count) for ID %d: %v", targetUserID, err)
-	}
-	// Fetch posts count - corrected to use user_id
-	err = database.DB.QueryRow(`SELECT COUNT(*) FROM posts WHERE user_id = ?`, targetUserID).Scan(&stats.PostsCount)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error V2 profile (posts count) for ID %d: %v", targetUserID, err)
+	if canViewFullContent {
+		// Fetch followers count
+		err = database.DB.QueryRow(`SELECT COUNT(*) FROM followers WHERE followed_id = ? AND status = 'accept'`, targetUserID).Scan(&stats.FollowersCount)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error V2 profile (followers count) for ID %d: %v", targetUserID, err)
+			// Potentially return error or log and continue with 0
+		}
+		// Fetch following count
+		err = database.DB.QueryRow(`SELECT COUNT(*) FROM followers WHERE follower_id = ? AND status = 'accept'`, targetUserID).Scan(&stats.FollowingCount)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error V2 profile (following count) for ID %d: %v", targetUserID, err)
+		}
+		// Fetch posts count - corrected to use user_id
+		err = database.DB.QueryRow(`SELECT COUNT(*) FROM posts WHERE user_id = ? AND status = 'published'`, targetUserID).Scan(&stats.PostsCount)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error V2 profile (posts count) for ID %d: %v", targetUserID, err)
+		}
 	}
 
 	// --- 3. Determine Relationship (if viewer is logged in and not viewing own profile) ---
 	var relationship *models.UserRelationshipV2
-	if errAuth == nil && loggedInUserID != 0 && loggedInUserID != targetUserID {
+	if viewerID != 0 && viewerID != targetUserID {
 		rel := models.UserRelationshipV2{}
 		var followStatus sql.NullString
 		errFollow := database.DB.QueryRow(`SELECT status FROM followers WHERE follower_id = ? AND followed_id = ?`,
-			loggedInUserID, targetUserID).Scan(&followStatus)
+			viewerID, targetUserID).Scan(&followStatus)
 
 		if errFollow == nil {
 			switch followStatus.String {
@@ -113,46 +137,38 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 				rel.HasPendingRequestFromViewer = true
 			}
 		} else if errFollow != sql.ErrNoRows {
-			log.Printf("Error V2 profile (relationship) for viewer %d to target %d: %v", loggedInUserID, targetUserID, errFollow)
+			log.Printf("Error V2 profile (relationship) for viewer %d to target %d: %v", viewerID, targetUserID, errFollow)
 		}
 
 		// Check if target user is in viewer's close friends
-		var isCloseFriend bool
-		errCloseFriend := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM close_friends WHERE user_id = ? AND close_friend_id = ?)`,
-			loggedInUserID, targetUserID).Scan(&isCloseFriend)
+		isCloseFriend, errCloseFriend := isCloseFriendOf(viewerID, targetUserID)
 		if errCloseFriend == nil {
 			rel.IsCloseFriend = isCloseFriend
 		} else {
-			log.Printf("Error V2 profile (close friend check) for viewer %d to target %d: %v", loggedInUserID, targetUserID, errCloseFriend)
+			log.Printf("Error V2 profile (close friend check) for viewer %d to target %d: %v", viewerID, targetUserID, errCloseFriend)
 		}
 
 		relationship = &rel
 	}
 
-	// --- Privacy Check & Post Fetching ---
+	// --- 4. Fetch Posts and Groups ---
 	var posts []models.PostResponse
-	canViewFullContent := true
-
-	if basicInfo.IsPrivate && loggedInUserID != targetUserID {
-		if relationship == nil || !relationship.IsFollowedByViewer {
-			canViewFullContent = false
-		}
-	}
-
+	var groups []models.UserGroupV2
 	if canViewFullContent {
-		// Corrected postsQuery to use user_id and match actual posts table schema
-		// Also corrected like_count and user_liked subqueries for likes table schema
+		// Only posts the viewer may see (per-post privacy still applies)
+		visibility, visibilityArgs := postVisibilityClause(viewerID)
 		postsQuery := `
-            SELECT p.id, p.user_id, u.username, p.content, p.image_path, p.created_at, p.updated_at,
+            SELECT p.id, p.user_id, u.username, p.content, p.created_at, p.updated_at,
                    (SELECT COUNT(*) FROM likes WHERE post_id = p.id) as like_count,
                    CASE WHEN ? != 0 THEN EXISTS(SELECT 1 FROM likes WHERE post_id = p.id AND user_id = ?) ELSE FALSE END as user_liked
             FROM posts p
             JOIN users u ON p.user_id = u.id
-            WHERE p.user_id = ? 
+            WHERE p.user_id = ? AND p.status = 'published' AND ` + visibility + `
             ORDER BY p.created_at DESC
             LIMIT 20`
 
-		postRows, err_posts := database.DB.Query(postsQuery, loggedInUserID, loggedInUserID, targetUserID)
+		postArgs := append([]interface{}{viewerID, viewerID, targetUserID}, visibilityArgs...)
+		postRows, err_posts := database.DB.Query(postsQuery, postArgs...)
 		if err_posts != nil {
 			log.Printf("Error V2 profile (posts) for ID %d: %v", targetUserID, err_posts)
 		} else {
@@ -161,7 +177,7 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 				var p models.PostResponse
 				// Scan for columns that exist in the posts table and are selected
 				if err_scan := postRows.Scan(
-					&p.ID, &p.UserID, &p.AuthorUsername, &p.Content, &p.ImagePath, &p.CreatedAt, &p.UpdatedAt,
+					&p.ID, &p.UserID, &p.AuthorUsername, &p.Content, &p.CreatedAt, &p.UpdatedAt,
 					&p.LikeCount, &p.UserLiked,
 				); err_scan != nil {
 					log.Printf("Error scanning post for V2 profile (user %d): %v", targetUserID, err_scan)
@@ -169,16 +185,42 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 				}
 				// Title and Privacy are in PostResponse model but not in current posts table schema,
 				// so they will remain as their zero values (empty string, 0).
+				if err_media := loadPostMedia(&p); err_media != nil {
+					log.Printf("Error loading media for post %d: %v", p.ID, err_media)
+				}
 				posts = append(posts, p)
 			}
 			if err_iter := postRows.Err(); err_iter != nil {
 				log.Printf("Error V2 profile (iterating posts) for ID %d: %v", targetUserID, err_iter)
 			}
 		}
+
+		groupRows, err_groups := database.DB.Query(`
+            SELECT g.id, g.title, gm.role
+            FROM group_members gm
+            JOIN groups g ON g.id = gm.group_id
+            WHERE gm.user_id = ? AND gm.status = 'accepted'
+            ORDER BY g.title ASC`, targetUserID)
+		if err_groups != nil {
+			log.Printf("Error V2 profile (groups) for ID %d: %v", targetUserID, err_groups)
+		} else {
+			defer groupRows.Close()
+			for groupRows.Next() {
+				var g models.UserGroupV2
+				if err_scan := groupRows.Scan(&g.ID, &g.Title, &g.Role); err_scan != nil {
+					log.Printf("Error scanning group for V2 profile (user %d): %v", targetUserID, err_scan)
+					continue
+				}
+				groups = append(groups, g)
+			}
+		}
 	}
 	if posts == nil {
 		posts = []models.PostResponse{}
 	}
+	if groups == nil {
+		groups = []models.UserGroupV2{}
+	}
 
 	// --- Compose Response ---
 	response := models.UserProfileV2Response{
@@ -186,21 +228,8 @@ func GetUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 		Stats:        stats,
 		Relationship: relationship,
 		Posts:        posts,
-	}
-
-	if !canViewFullContent {
-		response.Posts = []models.PostResponse{} // Clear posts if profile is private and not followed
-		// Optionally, limit other user info for private profiles not followed
-		response.User = models.UserBasicInfoV2{
-			ID:        basicInfo.ID,
-			Username:  basicInfo.Username,
-			Avatar:    basicInfo.Avatar,    // Show avatar even for private
-			IsPrivate: basicInfo.IsPrivate, // Indicate it's private
-			FirstName: basicInfo.FirstName, // Show names even for private
-			LastName:  basicInfo.LastName,
-		}
-		// Stats might also be hidden or limited for private profiles
-		// response.Stats = models.UserStatsV2{}
+		Groups:       groups,
+		Sections:     policy.sections(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -226,12 +255,29 @@ func UpdateUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 		DateOfBirth string `json:"dateOfBirth"`
 		IsPrivate   bool   `json:"isPrivate"`
 		Avatar      string `json:"avatar"`
+		// Only used when the account goes public: "accept" (default) approves
+		// pending follow requests, "keep" leaves them pending
+		PendingRequests string `json:"pendingRequests"`
+		// Only used when the account goes private: ask the user to review followers
+		ReviewFollowers bool `json:"reviewFollowers"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
 		return
 	}
+	switch updateData.PendingRequests {
+	case "":
+		updateData.PendingRequests = pendingRequestsAccept
+	case pendingRequestsAccept, pendingRequestsKeep:
+	default:
+		http.Error(w, "pendingRequests must be 'accept' or 'keep'", http.StatusBadRequest)
+		return
+	}
+
+	var previousAvatar string
+	var wasPrivate bool
+	database.DB.QueryRow("SELECT COALESCE(avatar, ''), COALESCE(is_private, FALSE) FROM users WHERE id = ?", loggedInUserID).Scan(&previousAvatar, &wasPrivate)
 
 	// Update user profile in database
 	updateQuery := `UPDATE users SET 
@@ -263,6 +309,13 @@ func UpdateUserProfileV2Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Track which avatar upload the profile uses; a replaced one is deleted right away
+	replaceAvatarReference(r.Context(), loggedInUserID, previousAvatar, updateData.Avatar)
+
+	if wasPrivate != updateData.IsPrivate {
+		onPrivacyChanged(loggedInUserID, updateData.IsPrivate, updateData.PendingRequests, updateData.ReviewFollowers)
+	}
+
 	// Fetch and return the updated profile
 	GetUserProfileV2Handler(w, r)
 }
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// Who can see an optional profile field. The field setting applies on top of the
+// account's privacy: on a private account "everyone" still means followers only.
+const (
+	fieldVisibleToEveryone  = "everyone"
+	fieldVisibleToFollowers = "followers"
+	fieldVisibleToOnlyMe    = "only_me"
+)
+
+// Optional profile fields with their own visibility setting.
+const (
+	profileFieldEmail       = "email"
+	profileFieldDateOfBirth = "date_of_birth"
+	profileFieldAboutMe     = "about_me"
+)
+
+// profilePolicy decides what of ownerID's profile viewerID may see. Every handler
+// that exposes profile data should go through it rather than checking is_private
+// or follows by hand.
+type profilePolicy struct {
+	ownerID    int64
+	viewerID   int64 // 0 for anonymous viewers
+	isSelf     bool
+	isPrivate  bool
+	isFollower bool // viewer has an accepted follow of the owner
+	blocked    bool // either user blocked the other
+	fields     map[string]string
+}
+
+// loadProfilePolicy loads the policy for viewerID looking at ownerID's profile. It
+// returns sql.ErrNoRows if the owner doesn't exist.
+func loadProfilePolicy(ownerID, viewerID int64) (*profilePolicy, error) {
+	p := &profilePolicy{ownerID: ownerID, viewerID: viewerID, isSelf: ownerID == viewerID}
+	err := database.DB.QueryRow(`
+        SELECT COALESCE(is_private, FALSE),
+               EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = users.id AND status = 'accept')
+        FROM users WHERE id = ?
+    `, viewerID, ownerID).Scan(&p.isPrivate, &p.isFollower)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isSelf && viewerID != 0 {
+		if p.blocked, err = isBlockedBetween(viewerID, ownerID); err != nil {
+			return nil, err
+		}
+	}
+	if p.fields, err = loadFieldVisibility(ownerID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// canView reports whether the profile is visible at all. Blocked users see nothing.
+func (p *profilePolicy) canView() bool {
+	return !p.blocked
+}
+
+// canViewContent reports whether the gated sections (posts, stats, follower and
+// following lists, groups) are visible. Private profiles only show basic info to
+// non-followers.
+func (p *profilePolicy) canViewContent() bool {
+	if !p.canView() {
+		return false
+	}
+	return p.isSelf || !p.isPrivate || p.isFollower
+}
+
+// canViewField reports whether an optional profile field is visible.
+func (p *profilePolicy) canViewField(field string) bool {
+	if p.isSelf {
+		return true
+	}
+	if !p.canViewContent() {
+		return false
+	}
+	switch p.fields[field] {
+	case fieldVisibleToOnlyMe:
+		return false
+	case fieldVisibleToFollowers:
+		return p.isFollower
+	default:
+		return true
+	}
+}
+
+// sections reports which gated sections are visible, for clients to render.
+func (p *profilePolicy) sections() models.ProfileSectionsV2 {
+	visible := p.canViewContent()
+	return models.ProfileSectionsV2{
+		Posts:     visible,
+		Stats:     visible,
+		Followers: visible,
+		Following: visible,
+		Groups:    visible,
+	}
+}
+
+// redactBasicInfo clears the fields of info the viewer isn't allowed to see.
+// Username, names, avatar and the privacy flag are always visible.
+func (p *profilePolicy) redactBasicInfo(info *models.UserBasicInfoV2) {
+	if !p.canViewContent() {
+		*info = models.UserBasicInfoV2{
+			ID:        info.ID,
+			Username:  info.Username,
+			FirstName: info.FirstName,
+			LastName:  info.LastName,
+			Avatar:    info.Avatar,
+			IsPrivate: info.IsPrivate,
+		}
+		return
+	}
+	if !p.canViewField(profileFieldEmail) {
+		info.Email = ""
+	}
+	if !p.canViewField(profileFieldDateOfBirth) {
+		info.DateOfBirth = ""
+	}
+	if !p.canViewField(profileFieldAboutMe) {
+		info.AboutMe = ""
+	}
+}
+
+// loadFieldVisibility returns userID's field settings, keyed by field. Fields
+// without a row default to fieldVisibleToEveryone.
+func loadFieldVisibility(userID int64) (map[string]string, error) {
+	fields := map[string]string{
+		profileFieldEmail:       fieldVisibleToEveryone,
+		profileFieldDateOfBirth: fieldVisibleToEveryone,
+		profileFieldAboutMe:     fieldVisibleToEveryone,
+	}
+	rows, err := database.DB.Query("SELECT field, visibility FROM profile_field_visibility WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var field, visibility string
+		if err := rows.Scan(&field, &visibility); err != nil {
+			return nil, err
+		}
+		fields[field] = visibility
+	}
+	return fields, rows.Err()
+}
+
+// requireProfileContent loads the policy for the viewer of r looking at ownerID and
+// checks the gated sections are visible. It writes the error response itself and
+// returns false if they aren't.
+func requireProfileContent(w http.ResponseWriter, r *http.Request, ownerID int64) bool {
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	policy, err := loadProfilePolicy(ownerID, viewerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error loading profile policy of user %d for viewer %d: %v", ownerID, viewerID, err)
+		http.Error(w, "Database error checking profile visibility", http.StatusInternalServerError)
+		return false
+	}
+	if !policy.canView() {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	if !policy.canViewContent() {
+		http.Error(w, "This account is private", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetProfileFieldVisibilityHandler returns the authenticated user's field visibility settings.
+// GET /users/me/field-visibility
+func GetProfileFieldVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fields, err := loadFieldVisibility(userID)
+	if err != nil {
+		log.Printf("Error loading field visibility for user %d: %v", userID, err)
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ProfileFieldVisibility{
+		Email:       fields[profileFieldEmail],
+		DateOfBirth: fields[profileFieldDateOfBirth],
+		AboutMe:     fields[profileFieldAboutMe],
+	})
+}
+
+// UpdateProfileFieldVisibilityHandler changes the authenticated user's field visibility
+// settings. Fields left empty keep their current setting.
+// PUT /users/me/field-visibility
+func UpdateProfileFieldVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProfileFieldVisibility
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]string{
+		profileFieldEmail:       req.Email,
+		profileFieldDateOfBirth: req.DateOfBirth,
+		profileFieldAboutMe:     req.AboutMe,
+	}
+	for field, visibility := range updates {
+		switch visibility {
+		case "", fieldVisibleToEveryone, fieldVisibleToFollowers, fieldVisibleToOnlyMe:
+		default:
+			http.Error(w, field+" must be 'everyone', 'followers' or 'only_me'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for field, visibility := range updates {
+		if visibility == "" {
+			continue
+		}
+		_, err := tx.Exec(`
+            INSERT INTO profile_field_visibility (user_id, field, visibility) VALUES (?, ?, ?)
+            ON CONFLICT(user_id, field) DO UPDATE SET visibility = excluded.visibility
+        `, userID, field, visibility)
+		if err != nil {
+			log.Printf("Error saving %s visibility for user %d: %v", field, userID, err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+
+	GetProfileFieldVisibilityHandler(w, r)
+}
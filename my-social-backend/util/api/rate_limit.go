@@ -0,0 +1,131 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"reda-social-network/config"
+)
+
+// rateLimitPruneInterval is how often idle rate limit buckets are dropped.
+const rateLimitPruneInterval = 5 * time.Minute
+
+// rateAction is a kind of send that is rate limited per user. The WebSocket and
+// REST ways of doing the same thing share one action, and so one budget.
+type rateAction string
+
+const (
+	rateDirectMessage rateAction = "direct_message"
+	rateGroupMessage  rateAction = "group_message"
+	rateTyping        rateAction = "typing_indicator"
+)
+
+// wsRateLimitedRequests maps the WebSocket requests that are rate limited to
+// their action.
+var wsRateLimitedRequests = map[string]rateAction{
+	"direct_message":   rateDirectMessage,
+	"group_message":    rateGroupMessage,
+	"typing_indicator": rateTyping,
+}
+
+// rateLimit is a token bucket's size and refill rate.
+type rateLimit struct {
+	perMinute int
+	burst     int
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateKey struct {
+	userID int64
+	action rateAction
+}
+
+// rateLimiter keeps a token bucket per user and action. Buckets live in memory,
+// so with several instances each one applies the limits on its own.
+type rateLimiter struct {
+	limits map[rateAction]rateLimit
+
+	mu      sync.Mutex
+	buckets map[rateKey]*tokenBucket
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		limits: map[rateAction]rateLimit{
+			rateDirectMessage: {perMinute: cfg.MessagesPerMinute, burst: cfg.MessageBurst},
+			rateGroupMessage:  {perMinute: cfg.GroupPerMinute, burst: cfg.GroupBurst},
+			rateTyping:        {perMinute: cfg.TypingPerMinute, burst: cfg.TypingBurst},
+		},
+		buckets: make(map[rateKey]*tokenBucket),
+	}
+}
+
+// sendLimiter limits the messages and typing indicators users send.
+var sendLimiter = newRateLimiter(config.App.RateLimit)
+
+// refill adds the tokens earned since the bucket was last updated.
+func (lim rateLimit) refill(b *tokenBucket, now time.Time) {
+	elapsed := now.Sub(b.updated).Minutes()
+	b.tokens = math.Min(float64(lim.burst), b.tokens+elapsed*float64(lim.perMinute))
+	b.updated = now
+}
+
+// allow takes a token from userID's bucket for action. It returns 0 if the user
+// may go ahead, or how long until a token is available.
+func (l *rateLimiter) allow(userID int64, action rateAction) time.Duration {
+	lim, ok := l.limits[action]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := rateKey{userID, action}
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: float64(lim.burst), updated: now}
+		l.buckets[key] = b
+	}
+	lim.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	missing := (1 - b.tokens) / float64(lim.perMinute)
+	return time.Duration(missing * float64(time.Minute))
+}
+
+// prune drops the buckets that have filled up again; they are no different from
+// a new one.
+func (l *rateLimiter) prune() {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		lim := l.limits[key.action]
+		lim.refill(b, now)
+		if b.tokens >= float64(lim.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// allowRESTSend applies the limit for action to a REST request. When it is
+// exceeded it answers 429 with a Retry-After header and returns false.
+func allowRESTSend(w http.ResponseWriter, userID int64, action rateAction) bool {
+	wait := sendLimiter.allow(userID, action)
+	if wait == 0 {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+	return false
+}
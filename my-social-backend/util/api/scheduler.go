@@ -0,0 +1,74 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"reda-social-network/database"
+)
+
+// postSchedulerInterval is how often the scheduler looks for posts that are due.
+const postSchedulerInterval = 30 * time.Second
+
+// StartBackgroundJobs launches the in-process periodic jobs. Every job reads its
+// work from the database on each run, so anything that fell due while the server
+// was down is picked up by the first run after a restart.
+func StartBackgroundJobs() {
+	startPeriodicJob("post scheduler", postSchedulerInterval, publishDuePosts)
+	startPeriodicJob("poll closer", pollCloserInterval, closeDuePolls)
+	startPeriodicJob("upload sweeper", orphanSweepInterval, sweepOrphanedUploads)
+	startPeriodicJob("suggestion refresher", suggestionRefreshInterval, refreshSuggestions)
+	startPeriodicJob("event log pruner", eventPrunerInterval, pruneUserEvents)
+	startPeriodicJob("rate limit pruner", rateLimitPruneInterval, sendLimiter.prune)
+}
+
+// startPeriodicJob runs job once immediately and then every interval on its own goroutine.
+// A panicking run is logged and does not stop later runs.
+func startPeriodicJob(name string, interval time.Duration, job func()) {
+	go func() {
+		runJob := func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Background job %q panicked: %v", name, r)
+				}
+			}()
+			job()
+		}
+
+		runJob()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runJob()
+		}
+	}()
+	log.Printf("Started background job %q (every %s)", name, interval)
+}
+
+// publishDuePosts publishes every scheduled post whose publish_at has passed.
+func publishDuePosts() {
+	rows, err := database.DB.Query(`
+        SELECT id FROM posts
+        WHERE status = 'scheduled' AND publish_at <= ?
+        ORDER BY publish_at ASC
+    `, time.Now().UTC())
+	if err != nil {
+		log.Printf("Post scheduler: error querying due posts: %v", err)
+		return
+	}
+
+	var dueIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			dueIDs = append(dueIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, postID := range dueIDs {
+		if _, err := publishPost(postID, "scheduled"); err != nil {
+			log.Printf("Post scheduler: error publishing post %d: %v", postID, err)
+		}
+	}
+}
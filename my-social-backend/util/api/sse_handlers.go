@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+const (
+	// sseKeepAlive is how often an idle event stream gets a comment line, so
+	// proxies don't close it.
+	sseKeepAlive = 25 * time.Second
+	// sseRetry is how long a disconnected EventSource waits before reconnecting.
+	sseRetry = 5 * time.Second
+)
+
+// EventStreamHandler streams the user's realtime events as Server-Sent Events, for
+// clients that can't open a WebSocket. It carries every server message a WebSocket
+// gets: the event name is the message type and the data is the same JSON
+// envelope. Events kept for replay have their seq as the event ID, so a
+// reconnecting EventSource sends Last-Event-ID and gets what it missed
+// (?last_event_id= does the same for a first connection). The stream is one-way;
+// clients send through the REST endpoints.
+// GET /events/stream
+func EventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastSeq := int64(-1)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		n, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastSeq = n
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		log.Printf("Event stream for user %d: cannot flush: %v", userID, err)
+		return
+	}
+
+	conn := newRealtimeConn(r.RemoteAddr, nil)
+	defer conn.Close()
+
+	if hub.Register(userID, conn) {
+		BroadcastUserStatusChange(userID, true)
+	}
+	log.Printf("User %d connected via event stream", userID)
+	defer func() {
+		if hub.Unregister(userID, conn) {
+			BroadcastUserStatusChange(userID, false)
+		}
+		log.Printf("User %d disconnected from event stream", userID)
+	}()
+
+	seq, err := currentEventSeq(userID)
+	if err != nil {
+		log.Printf("Error loading event seq for user %d: %v", userID, err)
+	}
+	conn.WriteJSON(WSMessage{
+		Type: "connected",
+		Data: models.WSConnected{Status: "connected", Seq: seq, Version: models.WSProtocolVersion},
+	})
+	checkAndSendOfflineMessageNotifications(userID, conn)
+	if lastSeq >= 0 {
+		// The replay waits for room in the queue, which this goroutine drains
+		go replayUserEvents(userID, conn, lastSeq, "")
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-conn.done:
+			return
+		case q := <-conn.send:
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := writeSSEEvent(w, q); err != nil {
+				log.Printf("Event stream write error for user %d: %v", userID, err)
+				return
+			}
+		case <-keepAlive.C:
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes q as one event. Encoded JSON never contains a newline, so
+// the envelope fits on a single data line.
+func writeSSEEvent(w io.Writer, q queuedMessage) error {
+	var buf bytes.Buffer
+	if q.seq > 0 {
+		fmt.Fprintf(&buf, "id: %d\n", q.seq)
+	}
+	if q.msgType != "" {
+		fmt.Fprintf(&buf, "event: %s\n", q.msgType)
+	}
+	buf.WriteString("data: ")
+	buf.Write(q.data)
+	buf.WriteString("\n\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+// Weights used to rank follow suggestions. Being followed by people you follow is
+// the strongest signal, then sharing a group, then having interacted with them.
+const (
+	suggestionMutualWeight      = 3
+	suggestionGroupWeight       = 2
+	suggestionInteractionWeight = 1
+)
+
+const (
+	// suggestionCacheSize is how many suggestions are kept per user.
+	suggestionCacheSize = 50
+	// suggestionRefreshInterval is how often cached suggestions are recomputed.
+	suggestionRefreshInterval = 30 * time.Minute
+	defaultSuggestionLimit    = 20
+)
+
+// suggestionExclusionClause returns a SQL condition that is false for users who
+// must not be suggested to userID: people they already follow or asked to follow,
+// anyone blocked in either direction and suggestions they dismissed.
+func suggestionExclusionClause(userColumn string, userID int64) (string, []interface{}) {
+	notBlocked, blockArgs := notBlockedClause(userColumn, userID)
+	clause := userColumn + ` != ?
+        AND NOT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ` + userColumn + `)
+        AND NOT EXISTS(SELECT 1 FROM suggestion_dismissals WHERE user_id = ? AND suggested_user_id = ` + userColumn + `)
+        AND ` + notBlocked
+	return clause, append([]interface{}{userID, userID, userID}, blockArgs...)
+}
+
+// computeSuggestions ranks candidates for userID and replaces their cached
+// suggestions with the top ones. It records when it ran in
+// users.suggestions_computed_at, so an empty result is cached too.
+func computeSuggestions(userID int64) error {
+	exclusion, exclusionArgs := suggestionExclusionClause("c.candidate", userID)
+	query := `
+        WITH mutual AS (
+            SELECT f2.followed_id AS candidate, COUNT(*) AS n
+            FROM followers f1
+            JOIN followers f2 ON f2.follower_id = f1.followed_id
+            WHERE f1.follower_id = ? AND f1.status = 'accept' AND f2.status = 'accept'
+            GROUP BY f2.followed_id
+        ), shared_groups AS (
+            SELECT gm2.user_id AS candidate, COUNT(*) AS n
+            FROM group_members gm1
+            JOIN group_members gm2 ON gm2.group_id = gm1.group_id
+            WHERE gm1.user_id = ? AND gm1.status = 'accepted' AND gm2.status = 'accepted'
+            GROUP BY gm2.user_id
+        ), interactions AS (
+            SELECT candidate, COUNT(*) AS n FROM (
+                SELECT p.user_id AS candidate FROM likes l JOIN posts p ON p.id = l.post_id WHERE l.user_id = ?
+                UNION ALL
+                SELECT l.user_id FROM likes l JOIN posts p ON p.id = l.post_id WHERE p.user_id = ?
+                UNION ALL
+                SELECT p.user_id FROM comments cm JOIN posts p ON p.id = cm.post_id WHERE cm.user_id = ?
+                UNION ALL
+                SELECT cm.user_id FROM comments cm JOIN posts p ON p.id = cm.post_id WHERE p.user_id = ?
+            )
+            GROUP BY candidate
+        ), candidates AS (
+            SELECT candidate FROM mutual
+            UNION SELECT candidate FROM shared_groups
+            UNION SELECT candidate FROM interactions
+        )
+        SELECT c.candidate, COALESCE(m.n, 0), COALESCE(g.n, 0), COALESCE(i.n, 0)
+        FROM candidates c
+        LEFT JOIN mutual m ON m.candidate = c.candidate
+        LEFT JOIN shared_groups g ON g.candidate = c.candidate
+        LEFT JOIN interactions i ON i.candidate = c.candidate
+        WHERE ` + exclusion + `
+        ORDER BY ? * COALESCE(m.n, 0) + ? * COALESCE(g.n, 0) + ? * COALESCE(i.n, 0) DESC, c.candidate ASC
+        LIMIT ?`
+	args := []interface{}{userID, userID, userID, userID, userID, userID}
+	args = append(args, exclusionArgs...)
+	args = append(args, suggestionMutualWeight, suggestionGroupWeight, suggestionInteractionWeight, suggestionCacheSize)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	type candidate struct {
+		id                                 int64
+		mutual, sharedGroups, interactions int
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.mutual, &c.sharedGroups, &c.interactions); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM follow_suggestions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, c := range candidates {
+		score := suggestionMutualWeight*c.mutual + suggestionGroupWeight*c.sharedGroups + suggestionInteractionWeight*c.interactions
+		_, err := tx.Exec(`
+            INSERT INTO follow_suggestions (user_id, suggested_user_id, score, mutual_follows, shared_groups, interactions, computed_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)
+        `, userID, c.id, score, c.mutual, c.sharedGroups, c.interactions, now)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET suggestions_computed_at = ? WHERE id = ?", now, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refreshSuggestions recomputes the cached suggestions of every user who has had
+// them computed, including those who had none. Other users get them computed on
+// their next request.
+func refreshSuggestions() {
+	rows, err := database.DB.Query("SELECT id FROM users WHERE suggestions_computed_at IS NOT NULL")
+	if err != nil {
+		log.Printf("Suggestion refresher: error querying users: %v", err)
+		return
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		if err := computeSuggestions(userID); err != nil {
+			log.Printf("Suggestion refresher: error computing suggestions for user %d: %v", userID, err)
+		}
+	}
+}
+
+// GetFollowSuggestionsHandler returns "people you may know" for the authenticated user.
+// Suggestions come from the cache; follows, requests, blocks and dismissals made since
+// it was computed are applied when reading it.
+// GET /users/suggestions?limit=20
+func GetFollowSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := defaultSuggestionLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > suggestionCacheSize {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(suggestionCacheSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var computedAt sql.NullTime
+	if err := database.DB.QueryRow("SELECT suggestions_computed_at FROM users WHERE id = ?", userID).Scan(&computedAt); err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !computedAt.Valid {
+		if err := computeSuggestions(userID); err != nil {
+			log.Printf("Error computing suggestions for user %d: %v", userID, err)
+			http.Error(w, "Failed to compute suggestions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	exclusion, exclusionArgs := suggestionExclusionClause("s.suggested_user_id", userID)
+	rows, err := database.DB.Query(`
+        SELECT u.id, u.username, u.first_name, u.last_name, u.avatar, COALESCE(u.is_private, FALSE),
+               s.mutual_follows, s.shared_groups, s.interactions
+        FROM follow_suggestions s
+        JOIN users u ON u.id = s.suggested_user_id
+        WHERE s.user_id = ? AND `+exclusion+`
+        ORDER BY s.score DESC, u.id ASC
+        LIMIT ?
+    `, append(append([]interface{}{userID}, exclusionArgs...), limit)...)
+	if err != nil {
+		log.Printf("Error querying suggestions for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch suggestions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var suggestions []models.FollowSuggestionResponse
+	for rows.Next() {
+		var s models.FollowSuggestionResponse
+		var firstName, lastName, avatar sql.NullString
+		if err := rows.Scan(&s.ID, &s.Username, &firstName, &lastName, &avatar, &s.IsPrivate,
+			&s.MutualFollows, &s.SharedGroups, &s.Interactions); err != nil {
+			log.Printf("Error scanning suggestion for user %d: %v", userID, err)
+			continue
+		}
+		s.FirstName = firstName.String
+		s.LastName = lastName.String
+		s.Avatar = avatar.String
+		suggestions = append(suggestions, s)
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating suggestions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if suggestions == nil {
+		suggestions = []models.FollowSuggestionResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// DismissSuggestionHandler stops a user from being suggested to the authenticated user.
+// POST /users/suggestions/{suggestedUserID}/dismiss
+func DismissSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	suggestedUserID, err := strconv.ParseInt(r.PathValue("suggestedUserID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID in URL path", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", suggestedUserID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Database error checking user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+        INSERT OR IGNORE INTO suggestion_dismissals (user_id, suggested_user_id, created_at)
+        VALUES (?, ?, ?)
+    `, userID, suggestedUserID, time.Now())
+	if err == nil {
+		_, err = database.DB.Exec("DELETE FROM follow_suggestions WHERE user_id = ? AND suggested_user_id = ?", userID, suggestedUserID)
+	}
+	if err != nil {
+		log.Printf("Error dismissing suggestion %d for user %d: %v", suggestedUserID, userID, err)
+		http.Error(w, "Failed to dismiss suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Suggestion dismissed"})
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"reda-social-network/database"
+	"reda-social-network/middleware"
+	"reda-social-network/models"
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 50
+)
+
+// How well a user matched the directory query, best first.
+const (
+	directoryMatchExact     = 0 // username equals the query
+	directoryMatchPrefix    = 1 // a name starts with the query
+	directoryMatchSubstring = 2 // a name contains the query
+	directoryMatchFuzzy     = 3 // a name contains the query's characters in order
+)
+
+// directorySearchFields are the user columns the directory query is matched against.
+var directorySearchFields = []string{
+	"LOWER(u.username)",
+	"LOWER(COALESCE(u.nickname, ''))",
+	"LOWER(COALESCE(u.first_name, ''))",
+	"LOWER(COALESCE(u.last_name, ''))",
+	"LOWER(COALESCE(u.first_name, '') || ' ' || COALESCE(u.last_name, ''))",
+}
+
+// escapeLike escapes the LIKE wildcards in s, for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// directoryMatchClause returns a SQL condition that is true when any search field
+// matches pattern.
+func directoryMatchClause(pattern string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, field := range directorySearchFields {
+		conds = append(conds, field+` LIKE ? ESCAPE '\'`)
+		args = append(args, pattern)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// encodeDirectoryCursor and decodeDirectoryCursor convert the position after the
+// last user of a page to and from the opaque cursor handed to clients.
+func encodeDirectoryCursor(rank int, username string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(rank) + ":" + username))
+}
+
+func decodeDirectoryCursor(cursor string) (int, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", false
+	}
+	rankStr, username, found := strings.Cut(string(raw), ":")
+	if !found {
+		return 0, "", false
+	}
+	rank, err := strconv.Atoi(rankStr)
+	if err != nil {
+		return 0, "", false
+	}
+	return rank, username, true
+}
+
+// SearchUsersHandler lists users for the authenticated user, best matches first.
+// Without q every user is listed by username. Users who blocked the viewer never
+// appear. With not_in_group set the list is an invite picker for that group: people
+// already in (or invited to, or asking to join) the group, users the viewer blocked
+// and private accounts without a follow either way are left out.
+// GET /users?q=&cursor=&limit=20&not_in_group={groupID}
+func SearchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok || viewerID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultDirectoryLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxDirectoryLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxDirectoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// Users who blocked the viewer are hidden; the ones the viewer blocked are
+	// listed (and flagged) so they can be found again to unblock
+	conds := []string{
+		"u.id != ?",
+		"NOT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = u.id AND blocked_id = ?)",
+	}
+	args := []interface{}{viewerID, viewerID}
+
+	rankExpr := strconv.Itoa(directoryMatchExact)
+	var rankArgs []interface{}
+	if q := strings.ToLower(strings.TrimSpace(query.Get("q"))); q != "" {
+		escaped := escapeLike(q)
+		prefix, prefixArgs := directoryMatchClause(escaped + "%")
+		substring, substringArgs := directoryMatchClause("%" + escaped + "%")
+		var fuzzy strings.Builder
+		fuzzy.WriteString("%")
+		for _, c := range q {
+			fuzzy.WriteString(escapeLike(string(c)) + "%")
+		}
+		fuzzyMatch, fuzzyArgs := directoryMatchClause(fuzzy.String())
+
+		rankExpr = `CASE
+            WHEN LOWER(u.username) = ? THEN ` + strconv.Itoa(directoryMatchExact) + `
+            WHEN ` + prefix + ` THEN ` + strconv.Itoa(directoryMatchPrefix) + `
+            WHEN ` + substring + ` THEN ` + strconv.Itoa(directoryMatchSubstring) + `
+            ELSE ` + strconv.Itoa(directoryMatchFuzzy) + ` END`
+		rankArgs = append([]interface{}{q}, prefixArgs...)
+		rankArgs = append(rankArgs, substringArgs...)
+
+		// The fuzzy pattern matches everything the others do
+		conds = append(conds, fuzzyMatch)
+		args = append(args, fuzzyArgs...)
+	}
+
+	if groupStr := query.Get("not_in_group"); groupStr != "" {
+		groupID, err := strconv.ParseInt(groupStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid not_in_group", http.StatusBadRequest)
+			return
+		}
+		var isMember bool
+		err = database.DB.QueryRow(`
+            SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND status = 'accepted')
+        `, groupID, viewerID).Scan(&isMember)
+		if err != nil {
+			http.Error(w, "Database error checking membership: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !isMember {
+			http.Error(w, "Only group members can invite", http.StatusForbidden)
+			return
+		}
+		notBlocked, blockArgs := notBlockedClause("u.id", viewerID)
+		conds = append(conds,
+			"NOT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = u.id)",
+			notBlocked,
+			`(NOT COALESCE(u.is_private, FALSE) OR EXISTS(
+                SELECT 1 FROM followers
+                WHERE status = 'accept' AND ((follower_id = ? AND followed_id = u.id) OR (follower_id = u.id AND followed_id = ?))
+            ))`,
+		)
+		args = append(args, groupID)
+		args = append(args, blockArgs...)
+		args = append(args, viewerID, viewerID)
+	}
+
+	cursorCond := ""
+	var cursorArgs []interface{}
+	if cursor := query.Get("cursor"); cursor != "" {
+		rank, username, ok := decodeDirectoryCursor(cursor)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursorCond = "WHERE match_rank > ? OR (match_rank = ? AND username > ?)"
+		cursorArgs = []interface{}{rank, rank, username}
+	}
+
+	sqlQuery := `
+        SELECT id, username, first_name, last_name, nickname, avatar, is_private, match_rank,
+               EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = m.id AND status = 'accept'),
+               EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = m.id AND status = 'pending'),
+               EXISTS(SELECT 1 FROM followers WHERE follower_id = m.id AND followed_id = ? AND status = 'accept'),
+               EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = m.id),
+               (SELECT COUNT(*) FROM followers f1
+                JOIN followers f2 ON f2.follower_id = f1.followed_id
+                WHERE f1.follower_id = ? AND f1.status = 'accept'
+                  AND f2.followed_id = m.id AND f2.status = 'accept')
+        FROM (
+            SELECT u.id, u.username, u.first_name, u.last_name, u.nickname, u.avatar,
+                   COALESCE(u.is_private, FALSE) AS is_private, ` + rankExpr + ` AS match_rank
+            FROM users u
+            WHERE ` + strings.Join(conds, " AND ") + `
+        ) m
+        ` + cursorCond + `
+        ORDER BY match_rank ASC, username ASC
+        LIMIT ?`
+	queryArgs := []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID}
+	queryArgs = append(queryArgs, rankArgs...)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, cursorArgs...)
+	queryArgs = append(queryArgs, limit+1)
+
+	rows, err := database.DB.Query(sqlQuery, queryArgs...)
+	if err != nil {
+		log.Printf("Error searching users for viewer %d: %v", viewerID, err)
+		http.Error(w, "Failed to search users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp := models.UserDirectoryResponse{Users: []models.UserCard{}}
+	var lastRank int
+	for rows.Next() {
+		var c models.UserCard
+		var firstName, lastName, nickname, avatar sql.NullString
+		var rank int
+		if err := rows.Scan(&c.ID, &c.Username, &firstName, &lastName, &nickname, &avatar, &c.IsPrivate, &rank,
+			&c.Relationship.IsFollowing, &c.Relationship.FollowPending, &c.Relationship.FollowsViewer,
+			&c.Relationship.Blocked, &c.Relationship.MutualCount); err != nil {
+			log.Printf("Error scanning user card for viewer %d: %v", viewerID, err)
+			http.Error(w, "Failed to search users", http.StatusInternalServerError)
+			return
+		}
+		if len(resp.Users) == limit {
+			// One more row than asked for: there is a next page
+			last := resp.Users[limit-1]
+			resp.NextCursor = encodeDirectoryCursor(lastRank, last.Username)
+			break
+		}
+		c.FirstName = firstName.String
+		c.LastName = lastName.String
+		c.Nickname = nickname.String
+		c.Avatar = avatar.String
+		resp.Users = append(resp.Users, c)
+		lastRank = rank
+	}
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
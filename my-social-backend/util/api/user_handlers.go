@@ -9,6 +9,7 @@ import (
 )
 
 // GET /users/available-for-invite - get users that can be invited
+// Deprecated: use GET /users?not_in_group={groupID}, which is paginated and searchable
 func GetAvailableUsersHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok || userID == 0 {
@@ -22,13 +23,19 @@ func GetAvailableUsersHandler(w http.ResponseWriter, r *http.Request) {
 		Avatar   string `json:"avatar,omitempty"`
 	}
 
-	// Get all users except the current user
+	// Get all users except the current user, users blocked in either direction and
+	// private accounts with no follow between them and the current user
+	notBlocked, blockArgs := notBlockedClause("users.id", userID)
 	rows, err := database.DB.Query(`
 		SELECT id, username, COALESCE(avatar, '') as avatar
 		FROM users 
-		WHERE id != ?
+		WHERE id != ? AND `+notBlocked+`
+		AND (NOT COALESCE(is_private, FALSE) OR EXISTS(
+			SELECT 1 FROM followers
+			WHERE status = 'accept' AND ((follower_id = ? AND followed_id = users.id) OR (follower_id = users.id AND followed_id = ?))
+		))
 		ORDER BY username ASC
-	`, userID)
+	`, append(append([]interface{}{userID}, blockArgs...), userID, userID)...)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"reda-social-network/config"
+	"reda-social-network/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendQueueSize is how many outbound messages a connection may have queued.
+	wsSendQueueSize = 256
+	// wsWriteWait is how long a single write may take before the connection is dropped.
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long the client may stay silent (no pong, no message).
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is how often the server pings; it must be less than wsPongWait.
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+// Low-priority events are cheap to lose: a newer one replaces them soon, or the
+// client can ask again. They are dropped once a connection's queue is half full;
+// anything else that doesn't fit disconnects the client.
+var wsLowPriorityEvents = map[string]bool{
+	"typing_indicator":  true,
+	"user_online":       true,
+	"user_offline":      true,
+	"post_like_updated": true,
+}
+
+var (
+	errWSClientClosed  = errors.New("websocket client closed")
+	errWSClientTooSlow = errors.New("websocket client too slow")
+)
+
+// Outbound queue metrics, served on /debug/vars by the internal debug listener.
+var (
+	wsDroppedMessages = expvar.NewInt("ws_dropped_messages")
+	wsSlowDisconnects = expvar.NewInt("ws_slow_disconnects")
+)
+
+func init() {
+	expvar.Publish("ws_queues", expvar.Func(func() interface{} {
+		connections, queued, maxDepth := 0, 0, 0
+		wsConnections.forEach(func(_ int64, conn *realtimeConn) {
+			depth := len(conn.send)
+			connections++
+			queued += depth
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		})
+		return map[string]int{"connections": connections, "queued": queued, "max_depth": maxDepth}
+	}))
+}
+
+// queuedMessage is an encoded message waiting to be written. Type and seq are
+// kept for transports that frame them separately, like event streams.
+type queuedMessage struct {
+	msgType string
+	seq     int64
+	data    []byte
+}
+
+// realtimeConn is the outbound side of one of a user's realtime connections, a
+// WebSocket (WSClient) or an event stream (EventStreamHandler). Messages are queued and
+// written by the connection's own writer, so a slow client never blocks the
+// sender.
+type realtimeConn struct {
+	send      chan queuedMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	peer      string // remote address, for logs
+	closeFn   func() // closes the underlying connection
+
+	// While a replay is being written, new messages are held back so that they
+	// follow the replayed events; see beginReplay.
+	replayMu  sync.Mutex
+	replaying bool
+	held      []queuedMessage
+}
+
+func newRealtimeConn(peer string, closeFn func()) *realtimeConn {
+	return &realtimeConn{
+		send:    make(chan queuedMessage, wsSendQueueSize),
+		done:    make(chan struct{}),
+		peer:    peer,
+		closeFn: closeFn,
+	}
+}
+
+// encodeQueued marshals v for the queue. A WSMessage is stamped with the protocol
+// version.
+func encodeQueued(v interface{}) (queuedMessage, error) {
+	var q queuedMessage
+	if msg, ok := v.(WSMessage); ok {
+		msg.Version = models.WSProtocolVersion
+		q.msgType, q.seq = msg.Type, msg.Seq
+		v = msg
+	}
+	data, err := json.Marshal(v)
+	q.data = data
+	return q, err
+}
+
+// WriteJSON queues v for the client. A WSMessage is subject to the drop policy
+// for its type; see wsLowPriorityEvents.
+func (c *realtimeConn) WriteJSON(v interface{}) error {
+	q, err := encodeQueued(v)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(q)
+}
+
+func (c *realtimeConn) enqueue(q queuedMessage) error {
+	select {
+	case <-c.done:
+		return errWSClientClosed
+	default:
+	}
+
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	lowPriority := wsLowPriorityEvents[q.msgType]
+	if c.replaying {
+		if len(c.held) < cap(c.send) {
+			c.held = append(c.held, q)
+			return nil
+		}
+	} else {
+		if lowPriority && len(c.send) >= cap(c.send)/2 {
+			wsDroppedMessages.Add(1)
+			return nil
+		}
+		select {
+		case c.send <- q:
+			return nil
+		default:
+		}
+	}
+	if lowPriority {
+		wsDroppedMessages.Add(1)
+		return nil
+	}
+	// The client is too far behind to catch up; let it reconnect instead
+	wsSlowDisconnects.Add(1)
+	log.Printf("Disconnecting slow realtime client %s: send queue full", c.peer)
+	c.Close()
+	return errWSClientTooSlow
+}
+
+// writeJSONWait queues v, waiting for room in the queue instead of applying the
+// drop policy. It is for bulk sends on the client's own goroutine, like a replay.
+func (c *realtimeConn) writeJSONWait(v interface{}) error {
+	q, err := encodeQueued(v)
+	if err != nil {
+		return err
+	}
+	return c.sendWait(q)
+}
+
+func (c *realtimeConn) sendWait(q queuedMessage) error {
+	select {
+	case c.send <- q:
+		return nil
+	case <-c.done:
+		return errWSClientClosed
+	}
+}
+
+// beginReplay holds back messages sent to the connection until endReplay, so
+// that events replayed with writeJSONWait in between reach the client first. It
+// lets a replay be written without holding the user's event lock.
+func (c *realtimeConn) beginReplay() {
+	c.replayMu.Lock()
+	c.replaying = true
+	c.replayMu.Unlock()
+}
+
+// endReplay writes the messages held back since beginReplay, including any that
+// arrive meanwhile, then lets new messages through again.
+func (c *realtimeConn) endReplay() {
+	for {
+		c.replayMu.Lock()
+		held := c.held
+		c.held = nil
+		if len(held) == 0 {
+			c.replaying = false
+			c.replayMu.Unlock()
+			return
+		}
+		c.replayMu.Unlock()
+
+		for _, q := range held {
+			if err := c.sendWait(q); err != nil {
+				c.replayMu.Lock()
+				c.replaying, c.held = false, nil
+				c.replayMu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// Close stops the writer and closes the connection, which ends the read loop.
+// It is safe to call more than once.
+func (c *realtimeConn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.closeFn != nil {
+			c.closeFn()
+		}
+	})
+}
+
+// WSClient is a WebSocket connection.
+type WSClient struct {
+	*realtimeConn
+	Conn *websocket.Conn
+
+	// Rate limited requests in the current minute, counted by the read loop
+	strikes      int
+	strikesSince time.Time
+}
+
+// newWSClient wraps conn and starts its writer goroutine.
+func newWSClient(conn *websocket.Conn) *WSClient {
+	c := &WSClient{
+		realtimeConn: newRealtimeConn(conn.RemoteAddr().String(), func() { conn.Close() }),
+		Conn:         conn,
+	}
+	go c.writePump()
+	return c
+}
+
+// writePump writes queued messages and periodic pings until the client closes.
+func (c *WSClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer c.Close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case q := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, q.data); err != nil {
+				log.Printf("WebSocket write error for %s: %v", c.peer, err)
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// strike records a rate limited request. After too many within a minute the
+// client is disconnected with a policy violation.
+func (c *WSClient) strike() {
+	now := time.Now()
+	if now.Sub(c.strikesSince) > time.Minute {
+		c.strikes, c.strikesSince = 0, now
+	}
+	c.strikes++
+	if c.strikes < config.App.RateLimit.WSStrikes {
+		return
+	}
+	log.Printf("Disconnecting WebSocket client %s: rate limit exceeded %d times", c.peer, c.strikes)
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+	c.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(wsWriteWait))
+	c.Close()
+}
+
+// extendReadDeadline gives the client another wsPongWait to show it is alive.
+func (c *WSClient) extendReadDeadline() {
+	c.Conn.SetReadDeadline(time.Now().Add(wsPongWait))
+}
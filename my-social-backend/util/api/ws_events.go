@@ -0,0 +1,206 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/models"
+)
+
+// Every realtime event for a user, except the low-priority ones in
+// wsLowPriorityEvents, gets the next number in that user's sequence and is kept
+// in user_events. A client that reconnects sends "resume" with the last seq it
+// saw and is sent everything after it. Events may arrive more than once (live and
+// replayed); clients ignore seqs they have already seen.
+const (
+	// eventRetention is how long events are kept for replay.
+	eventRetention = 7 * 24 * time.Hour
+	// ackedEventRetention is how long events stay after the user acked them.
+	ackedEventRetention = 24 * time.Hour
+	// eventPrunerInterval is how often expired events are deleted.
+	eventPrunerInterval = time.Hour
+	// maxResumeEvents caps a replay; a client further behind has to resync over REST.
+	maxResumeEvents = 1000
+)
+
+// userEventLocks serializes assigning and publishing a user's events so that
+// each connection receives them in seq order. Nothing that can block on a client
+// may run under them.
+var userEventLocks sync.Map // user ID -> *sync.Mutex
+
+func userEventLock(userID int64) *sync.Mutex {
+	lock, _ := userEventLocks.LoadOrStore(userID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// appendUserEvent logs an event for userID and returns its seq.
+func appendUserEvent(userID int64, msgType string, data interface{}) (int64, error) {
+	seqs, err := appendUserEvents([]int64{userID}, msgType, data)
+	return seqs[userID], err
+}
+
+// appendUserEvents logs the same event for each of userIDs, in one transaction,
+// and returns their seqs.
+func appendUserEvents(userIDs []int64, msgType string, data interface{}) (map[int64]int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	seqs := make(map[int64]int64, len(userIDs))
+	for _, userID := range userIDs {
+		var seq int64
+		err = tx.QueryRow(`
+            INSERT INTO user_event_counters (user_id, last_seq) VALUES (?, 1)
+            ON CONFLICT(user_id) DO UPDATE SET last_seq = last_seq + 1
+            RETURNING last_seq
+        `, userID).Scan(&seq)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`
+            INSERT INTO user_events (user_id, seq, type, data, created_at) VALUES (?, ?, ?, ?, ?)
+        `, userID, seq, msgType, string(payload), now)
+		if err != nil {
+			return nil, err
+		}
+		seqs[userID] = seq
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
+
+// currentEventSeq returns the seq of userID's latest event, 0 if they have none.
+func currentEventSeq(userID int64) (int64, error) {
+	var seq int64
+	err := database.DB.QueryRow("SELECT last_seq FROM user_event_counters WHERE user_id = ?", userID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// ackUserEvents records that one of userID's devices has processed everything up
+// to seq. Acked events are pruned sooner.
+func ackUserEvents(userID, seq int64) error {
+	_, err := database.DB.Exec(`
+        UPDATE user_event_counters SET acked_seq = MAX(acked_seq, ?)
+        WHERE user_id = ? AND ? <= last_seq
+    `, seq, userID, seq)
+	return err
+}
+
+// errResyncRequired means a user's events after a seq can no longer be replayed.
+var errResyncRequired = errors.New("events to replay were pruned")
+
+// replayUserEvents sends client every event of userID after lastSeq, then a
+// "resumed" message with the current seq. If some of those events were already
+// pruned (or there are too many) it sends "resync_required" instead, and the
+// client reloads its state over REST. Replies carry requestID, the ID of the
+// resume request if there was one.
+//
+// The events are read under the user's event lock and written after releasing
+// it, since writing waits for the client; the connection holds back newer
+// messages until the replay is written (see beginReplay).
+func replayUserEvents(userID int64, client *realtimeConn, lastSeq int64, requestID string) {
+	lock := userEventLock(userID)
+	lock.Lock()
+	current, events, err := loadUserEventsAfter(userID, lastSeq)
+	if err == nil && len(events) > 0 {
+		client.beginReplay()
+	}
+	lock.Unlock()
+
+	switch {
+	case err == errResyncRequired:
+		client.WriteJSON(WSMessage{Type: "resync_required", ID: requestID, Data: models.WSResyncRequired{Seq: current}})
+		return
+	case err != nil:
+		log.Printf("Error loading events for user %d: %v", userID, err)
+		client.WriteJSON(WSMessage{Type: "error", ID: requestID, Data: models.WSErrorData{Code: models.WSErrInternal, Message: "Failed to resume"}})
+		return
+	case len(events) == 0:
+		client.WriteJSON(WSMessage{Type: "resumed", ID: requestID, Data: models.WSResumed{Seq: current}})
+		return
+	}
+
+	defer client.endReplay()
+	// A replay can be larger than the send queue, so wait for room rather than
+	// treating the client as too slow
+	for _, msg := range events {
+		if err := client.writeJSONWait(msg); err != nil {
+			return
+		}
+	}
+	client.writeJSONWait(WSMessage{Type: "resumed", ID: requestID, Data: models.WSResumed{Seq: current, Replayed: len(events)}})
+}
+
+// loadUserEventsAfter returns userID's current seq and their events after
+// lastSeq, or errResyncRequired if those can't all be replayed.
+func loadUserEventsAfter(userID, lastSeq int64) (int64, []WSMessage, error) {
+	current, err := currentEventSeq(userID)
+	if err != nil || lastSeq >= current {
+		return current, nil, err
+	}
+
+	var oldest sql.NullInt64
+	if err := database.DB.QueryRow("SELECT MIN(seq) FROM user_events WHERE user_id = ?", userID).Scan(&oldest); err != nil {
+		return current, nil, err
+	}
+	if !oldest.Valid || oldest.Int64 > lastSeq+1 || current-lastSeq > maxResumeEvents {
+		return current, nil, errResyncRequired
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT seq, type, data FROM user_events
+        WHERE user_id = ? AND seq > ?
+        ORDER BY seq ASC
+    `, userID, lastSeq)
+	if err != nil {
+		return current, nil, err
+	}
+	defer rows.Close()
+	var events []WSMessage
+	for rows.Next() {
+		var msg WSMessage
+		var data string
+		if err := rows.Scan(&msg.Seq, &msg.Type, &data); err != nil {
+			log.Printf("Error scanning event for user %d: %v", userID, err)
+			continue
+		}
+		msg.Data = json.RawMessage(data)
+		events = append(events, msg)
+	}
+	return current, events, rows.Err()
+}
+
+// pruneUserEvents deletes events past their retention.
+func pruneUserEvents() {
+	now := time.Now().UTC()
+	result, err := database.DB.Exec(`
+        DELETE FROM user_events
+        WHERE created_at < ?
+           OR (created_at < ? AND seq <= (SELECT acked_seq FROM user_event_counters c WHERE c.user_id = user_events.user_id))
+    `, now.Add(-eventRetention), now.Add(-ackedEventRetention))
+	if err != nil {
+		log.Printf("Event log pruner: error deleting events: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Event log pruner: deleted %d event(s)", n)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"reda-social-network/database"
+	"reda-social-network/models"
+)
+
+// A resuming client that doesn't read must not hold up events for the user: the
+// replay waits for the client without the user's event lock, and live events
+// sent meanwhile reach the client after the replay, in seq order.
+func TestReplayDoesNotBlockBroadcasts(t *testing.T) {
+	newTestDB(t)
+	userID := createTestUser(t, "resumer")
+
+	backlog := wsSendQueueSize + 20 // more than fits in the queue
+	for i := 0; i < backlog; i++ {
+		if _, err := appendUserEvent(userID, "new_message", models.WSNewMessage{ID: int64(i)}); err != nil {
+			t.Fatalf("logging event: %v", err)
+		}
+	}
+
+	conn := connectTestClient(t, userID)
+	go replayUserEvents(userID, conn, 0, "resume-1")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(conn.send) < cap(conn.send) {
+		if time.Now().After(deadline) {
+			t.Fatal("replay did not fill the send queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		BroadcastToUser(userID, "new_message", models.WSNewMessage{ID: -1})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("BroadcastToUser blocked behind a stalled replay")
+	}
+
+	for want := int64(1); want <= int64(backlog); want++ {
+		if msg := receive(t, conn); msg.Type != "new_message" || msg.Seq != want {
+			t.Fatalf("replayed message: got %s seq %d, want new_message seq %d", msg.Type, msg.Seq, want)
+		}
+	}
+	if msg := receive(t, conn); msg.Type != "resumed" || msg.ID != "resume-1" {
+		t.Fatalf("after the replay: got %s (id %q), want resumed with the request id", msg.Type, msg.ID)
+	}
+	if msg := receive(t, conn); msg.Type != "new_message" || msg.Seq != int64(backlog)+1 {
+		t.Fatalf("live message: got %s seq %d, want new_message seq %d", msg.Type, msg.Seq, backlog+1)
+	}
+
+	// Once the replay is over, messages go straight to the queue again
+	BroadcastToUser(userID, "new_message", models.WSNewMessage{ID: -2})
+	if msg := receive(t, conn); msg.Seq != int64(backlog)+2 {
+		t.Fatalf("message after the replay: got seq %d, want %d", msg.Seq, backlog+2)
+	}
+}
+
+func TestBroadcastToGroupLogsEveryMember(t *testing.T) {
+	newTestDB(t)
+	creator := createTestUser(t, "creator")
+	members := []int64{creator, createTestUser(t, "member1"), createTestUser(t, "member2")}
+	pending := createTestUser(t, "pending")
+
+	res, err := database.DB.Exec("INSERT INTO groups (title, creator_id) VALUES ('g', ?)", creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID, _ := res.LastInsertId()
+	for _, id := range members {
+		database.DB.Exec("INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, 'accepted')", groupID, id)
+	}
+	database.DB.Exec("INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, 'pending')", groupID, pending)
+	// Members already have events of their own, so their seqs differ
+	appendUserEvent(members[1], "new_message", models.WSNewMessage{})
+
+	conns := map[int64]*realtimeConn{}
+	for _, id := range members {
+		conns[id] = connectTestClient(t, id)
+	}
+	BroadcastToGroup(groupID, "group_message", models.WSGroupMessage{GroupID: groupID, Content: "hi"}, &creator)
+
+	wantSeq := map[int64]int64{members[1]: 2, members[2]: 1}
+	for id, seq := range wantSeq {
+		var logged int64
+		err := database.DB.QueryRow("SELECT seq FROM user_events WHERE user_id = ? AND type = 'group_message'", id).Scan(&logged)
+		if err != nil || logged != seq {
+			t.Errorf("member %d: logged seq %d (%v), want %d", id, logged, err, seq)
+		}
+		if msg := receive(t, conns[id]); msg.Type != "group_message" || msg.Seq != seq {
+			t.Errorf("member %d: got %s seq %d, want group_message seq %d", id, msg.Type, msg.Seq, seq)
+		}
+	}
+	if msgs := drain(t, conns[creator]); len(msgs) != 0 {
+		t.Errorf("the excluded sender got %d message(s)", len(msgs))
+	}
+	var pendingEvents int
+	database.DB.QueryRow("SELECT COUNT(*) FROM user_events WHERE user_id = ?", pending).Scan(&pendingEvents)
+	if pendingEvents != 0 {
+		t.Errorf("a pending member got %d event(s)", pendingEvents)
+	}
+}
+
+// Concurrent events for the same users all get logged, each under its own seq,
+// even while a replay is reading the log.
+func TestAppendUserEventsConcurrently(t *testing.T) {
+	newTestDB(t)
+	users := []int64{createTestUser(t, "ann"), createTestUser(t, "ben")}
+	for i := 0; i < 2; i++ {
+		if _, err := appendUserEvents(users, "new_message", models.WSNewMessage{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A replay to a slow client keeps its query open
+	replay, err := database.DB.Query("SELECT seq FROM user_events WHERE user_id = ? ORDER BY seq", users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if !replay.Next() {
+		t.Fatal("nothing to replay")
+	}
+
+	const n = 50
+	errs := make(chan error, n)
+	results := make(chan map[int64]int64, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			seqs, err := appendUserEvents(users, "new_message", models.WSNewMessage{ID: int64(i)})
+			errs <- err
+			results <- seqs
+		}(i)
+	}
+	seen := make(map[int64]map[int64]bool)
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("appendUserEvents: %v", err)
+		}
+		for userID, seq := range <-results {
+			if seen[userID] == nil {
+				seen[userID] = make(map[int64]bool)
+			}
+			if seen[userID][seq] {
+				t.Errorf("user %d got seq %d twice", userID, seq)
+			}
+			seen[userID][seq] = true
+		}
+	}
+
+	replay.Close()
+
+	for _, userID := range users {
+		var count, maxSeq int64
+		database.DB.QueryRow("SELECT COUNT(*), COALESCE(MAX(seq), 0) FROM user_events WHERE user_id = ?", userID).Scan(&count, &maxSeq)
+		if count != n+2 || maxSeq != n+2 {
+			t.Errorf("user %d: %d event(s) logged up to seq %d, want %d", userID, count, maxSeq, n+2)
+		}
+	}
+}
@@ -3,14 +3,16 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
+	"reda-social-network/config"
 	"reda-social-network/database"
 	"reda-social-network/middleware"
+	"reda-social-network/models"
 	"reda-social-network/util"
 
 	"github.com/gorilla/websocket"
@@ -22,27 +24,10 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// Store active WebSocket connections per user
-var (
-	activeConnections = make(map[int64]*WSClient)
-	connectionsMutex  sync.RWMutex
-)
-
-// WSClient wraps a websocket.Conn and provides a mutex for safe writes
-type WSClient struct {
-	Conn       *websocket.Conn
-	writeMutex sync.Mutex
-}
-
-func (c *WSClient) WriteJSON(v interface{}) error {
-	c.writeMutex.Lock()
-	defer c.writeMutex.Unlock()
-	return c.Conn.WriteJSON(v)
-}
-
-type WSMessage struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+// onlineUserIDs returns the users with at least one open connection, on any
+// instance.
+func onlineUserIDs() []int64 {
+	return hub.OnlineUsers()
 }
 
 func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
@@ -69,345 +54,343 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
-	client := &WSClient{Conn: conn}
-	defer client.Conn.Close()
+	conn.SetReadLimit(int64(config.App.RateLimit.WSMaxFrameBytes))
+	client := newWSClient(conn)
+	defer client.Close()
+
+	// The writer pings periodically; a client that stops answering is dropped
+	client.extendReadDeadline()
+	conn.SetPongHandler(func(string) error {
+		client.extendReadDeadline()
+		return nil
+	})
 
-	// Store connection
-	connectionsMutex.Lock()
-	activeConnections[userID] = client
-	connectionsMutex.Unlock()
+	// Store connection alongside the user's other devices
+	firstConnection := hub.Register(userID, client.realtimeConn)
 
 	log.Printf("User %d connected via WebSocket", userID)
 
-	// Broadcast online status to connected followers/following
-	BroadcastUserStatusChange(userID, true)
+	// Broadcast online status to connected followers/following, unless the user
+	// was already online on another device
+	if firstConnection {
+		BroadcastUserStatusChange(userID, true)
+	}
 
-	// Clean up on disconnect
+	// Clean up on disconnect; only this connection goes, and the user is only
+	// offline once their last device disconnects
 	defer func() {
-		connectionsMutex.Lock()
-		delete(activeConnections, userID)
-		connectionsMutex.Unlock()
+		lastConnection := hub.Unregister(userID, client.realtimeConn)
 		log.Printf("User %d disconnected from WebSocket", userID)
 
-		// Broadcast offline status to connected followers/following
-		BroadcastUserStatusChange(userID, false)
+		if lastConnection {
+			BroadcastUserStatusChange(userID, false)
+		}
 	}()
 
-	// Send welcome message
+	// Send welcome message with the user's current event seq; a reconnecting
+	// client follows up with "resume" to get what it missed
+	seq, err := currentEventSeq(userID)
+	if err != nil {
+		log.Printf("Error loading event seq for user %d: %v", userID, err)
+	}
 	welcomeMsg := WSMessage{
 		Type: "connected",
-		Data: map[string]string{"status": "connected"},
+		Data: models.WSConnected{Status: "connected", Seq: seq, Version: models.WSProtocolVersion},
 	}
 	client.WriteJSON(welcomeMsg)
 
-	deliverUnreadDirectMessages(userID, client)
 	// Check for unread message notifications (group, etc.)
-	checkAndSendOfflineMessageNotifications(userID, client)
+	checkAndSendOfflineMessageNotifications(userID, client.realtimeConn)
 
 	// Listen for messages from client
 	for {
-		var msg WSMessage
-		err := conn.ReadJSON(&msg)
+		_, raw, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket read error for user %d: %v", userID, err)
 			break
 		}
+		client.extendReadDeadline()
 
-		// Handle different message types
-		switch msg.Type {
-		case "direct_message":
-			// Handle direct user-to-user messaging
-			var req struct {
-				ReceiverID int64  `json:"receiver_id"`
-				Content    string `json:"content"`
-			}
-			msgData, err := json.Marshal(msg.Data)
-			if err != nil {
-				log.Printf("Error marshaling direct message data: %v", err)
-				continue
-			}
-			if err := json.Unmarshal(msgData, &req); err != nil {
-				log.Printf("Error unmarshaling direct message: %v", err)
-				continue
-			}
-			if req.Content == "" {
-				client.WriteJSON(WSMessage{Type: "error", Data: "Message content cannot be empty"})
-				continue
-			}
-			// Save message to database
-			now := time.Now()
-			result, err := database.DB.Exec(`INSERT INTO private_messages (sender_id, receiver_id, content, created_at) VALUES (?, ?, ?, ?)`, userID, req.ReceiverID, req.Content, now)
-			if err != nil {
-				log.Printf("Error saving direct message: %v", err)
-				client.WriteJSON(WSMessage{Type: "error", Data: "Failed to save message"})
-				continue
-			}
-			messageID, _ := result.LastInsertId()
-			// Get sender username
-			var username string
-			err = database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-			if err != nil {
-				log.Printf("Error getting username: %v", err)
-				username = "Unknown"
-			}
-			// Prepare message payload
-			response := map[string]interface{}{
-				"id":          messageID,
-				"sender_id":   userID,
-				"receiver_id": req.ReceiverID,
-				"username":    username,
-				"content":     req.Content,
-				"created_at":  now,
-			}
-			// Broadcast to receiver
-			BroadcastToUser(req.ReceiverID, "direct_message", response)
-
-			// Always send updated unread count to recipient (online or offline)
-			var unreadCount int
-			err = database.DB.QueryRow(`SELECT COUNT(*) FROM private_messages WHERE receiver_id = ? AND is_read = 0`, req.ReceiverID).Scan(&unreadCount)
-			if err == nil {
-				// You can use conversation_updated or another event name
-				BroadcastToUser(req.ReceiverID, "conversation_updated", map[string]interface{}{
-					"unread_count":    unreadCount,
-					"last_message":    req.Content,
-					"message_time":    now,
-					"sender_id":       userID,
-					"sender_username": username,
-				})
-			}
+		dispatchWSRequest(userID, client, raw)
+	}
+}
 
-			// If recipient is offline, send offline_messages_notification instantly
-			connectionsMutex.RLock()
-			_, isOnline := activeConnections[req.ReceiverID]
-			connectionsMutex.RUnlock()
-			if !isOnline {
-				if unreadCount > 0 {
-					notification := WSMessage{
-						Type: "offline_messages_notification",
-						Data: map[string]interface{}{
-							"count":     unreadCount,
-							"message":   fmt.Sprintf("You have %d new message(s) while you were offline", unreadCount),
-							"timestamp": time.Now(),
-						},
-					}
-					BroadcastToUser(req.ReceiverID, "offline_messages_notification", notification.Data)
-				}
-			}
+// Handle direct user-to-user messaging
+func handleWSDirectMessage(req wsRequest, data json.RawMessage) {
+	var msg models.WSDirectMessageRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	_, err := NewMessagingService(database.DB).SendDirectMessage(req.userID, msg.ReceiverID, msg.Content, &req)
+	if err != nil {
+		var merr *MessagingError
+		if errors.As(err, &merr) {
+			req.fail(merr.Code, merr.Message)
+		} else {
+			req.fail(models.WSErrInternal, "Failed to send message")
+		}
+	}
+}
 
-			// Send confirmation to sender
-			client.WriteJSON(WSMessage{Type: "direct_message_sent", Data: response})
-		case "typing_indicator":
-			// Broadcast typing status to the other user in the conversation
-			var req struct {
-				ReceiverID int64 `json:"receiver_id"`
-				IsTyping   bool  `json:"is_typing"`
-			}
-			msgData, err := json.Marshal(msg.Data)
-			if err == nil {
-				if err := json.Unmarshal(msgData, &req); err == nil {
-					BroadcastToUser(req.ReceiverID, "typing_indicator", map[string]interface{}{
-						"sender_id": userID,
-						"is_typing": req.IsTyping,
-					})
-				}
-			}
+// Broadcast typing status to the other user in the conversation
+func handleWSTypingIndicator(req wsRequest, data json.RawMessage) {
+	var msg models.WSTypingIndicatorRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	if msg.ReceiverID <= 0 {
+		req.fail(models.WSErrBadRequest, "receiver_id is required")
+		return
+	}
+	if blocked, err := isBlockedBetween(req.userID, msg.ReceiverID); err != nil || blocked {
+		return
+	}
+	BroadcastToUser(msg.ReceiverID, "typing_indicator", models.WSTypingIndicator{
+		SenderID: req.userID,
+		IsTyping: msg.IsTyping,
+	})
+}
 
-		case "message_read":
-			// Update message as read and notify both sender and receiver
-			var req struct {
-				MessageID int64 `json:"message_id"`
-			}
-			msgData, err := json.Marshal(msg.Data)
-			if err == nil {
-				if err := json.Unmarshal(msgData, &req); err == nil {
-					// Update DB for read status
-					_, err := database.DB.Exec(`UPDATE private_messages SET is_read = 1 WHERE id = ?`, req.MessageID)
-					if err == nil {
-						// Fetch sender ID for the message
-						var senderID int64
-						err := database.DB.QueryRow(`SELECT sender_id FROM private_messages WHERE id = ?`, req.MessageID).Scan(&senderID)
-						if err == nil {
-							// Notify sender
-							BroadcastToUser(senderID, "message_read", map[string]interface{}{
-								"message_id": req.MessageID,
-								// read_at removed
-							})
-						}
-						// Notify receiver (the one who read)
-						BroadcastToUser(userID, "message_read", map[string]interface{}{
-							"message_id": req.MessageID,
-							// read_at removed
-						})
-					}
-				}
-			}
+// Mark a received message, and everything before it from the same sender, as read
+func handleWSMessageRead(req wsRequest, data json.RawMessage) {
+	var msg models.WSMessageReadRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	// Only the receiver can read a message
+	var senderID int64
+	err := database.DB.QueryRow(`SELECT sender_id FROM private_messages WHERE id = ? AND receiver_id = ?`, msg.MessageID, req.userID).Scan(&senderID)
+	if err == sql.ErrNoRows {
+		req.fail(models.WSErrNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding message %d: %v", msg.MessageID, err)
+		req.fail(models.WSErrInternal, "Failed to mark message as read")
+		return
+	}
+	_, err = NewMessagingService(database.DB).MarkConversationRead(req.userID, senderID, msg.MessageID, &req)
+	if err != nil {
+		var merr *MessagingError
+		if errors.As(err, &merr) {
+			req.fail(merr.Code, merr.Message)
+		} else {
+			req.fail(models.WSErrInternal, "Failed to mark message as read")
+		}
+	}
+}
 
-		case "heartbeat":
-			// Optionally update last-seen or keep connection alive
-			// You can update a last-seen timestamp in DB if needed
-			// For now, just acknowledge
-			client.WriteJSON(WSMessage{Type: "heartbeat_ack", Data: "ok"})
-
-		case "open_conversation":
-			// Mark conversation as open for this user (for instant delivery/read)
-			// You can store this state in memory or DB if needed
-			// For now, just acknowledge
-			client.WriteJSON(WSMessage{Type: "open_conversation_ack", Data: "ok"})
-		case "ping":
-			client.WriteJSON(WSMessage{Type: "pong", Data: "pong"})
-
-		case "request_online_status":
-			sendOnlineStatusToUser(userID, client)
-
-		case "group_message":
-			var req struct {
-				GroupID int64  `json:"group_id"`
-				Content string `json:"content"`
-			}
+func handleWSGroupMessage(req wsRequest, data json.RawMessage) {
+	var msg models.WSGroupMessageRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	userID := req.userID
+
+	// Validate user is group member
+	var isMember bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM group_members 
+            WHERE group_id = ? AND user_id = ? AND status = 'accepted'
+        )
+    `, msg.GroupID, userID).Scan(&isMember)
+
+	if err != nil || !isMember {
+		req.fail(models.WSErrForbidden, "Not a group member")
+		return
+	}
 
-			// Parse the message data
-			msgData, err := json.Marshal(msg.Data)
-			if err != nil {
-				log.Printf("Error marshaling message data: %v", err)
-				continue
-			}
+	// Validate content
+	if msg.Content == "" {
+		req.fail(models.WSErrBadRequest, "Message content cannot be empty")
+		return
+	}
 
-			if err := json.Unmarshal(msgData, &req); err != nil {
-				log.Printf("Error unmarshaling group message: %v", err)
-				continue
-			}
+	// Save message to database
+	now := time.Now()
+	result, err := database.DB.Exec(`
+        INSERT INTO group_chat_messages (group_id, sender_id, content, created_at)
+        VALUES (?, ?, ?, ?)
+    `, msg.GroupID, userID, msg.Content, now)
 
-			// Validate user is group member
-			var isMember bool
-			err = database.DB.QueryRow(`
-                SELECT EXISTS(
-                    SELECT 1 FROM group_members 
-                    WHERE group_id = ? AND user_id = ? AND status = 'accepted'
-                )
-            `, req.GroupID, userID).Scan(&isMember)
-
-			if err != nil || !isMember {
-				client.WriteJSON(WSMessage{Type: "error", Data: "Not a group member"})
-				continue
-			}
+	if err != nil {
+		log.Printf("Error saving group message: %v", err)
+		req.fail(models.WSErrInternal, "Failed to save message")
+		return
+	}
 
-			// Validate content
-			if req.Content == "" {
-				client.WriteJSON(WSMessage{Type: "error", Data: "Message content cannot be empty"})
-				continue
-			}
+	messageID, _ := result.LastInsertId()
 
-			// Save message to database
-			now := time.Now()
-			result, err := database.DB.Exec(`
-                INSERT INTO group_chat_messages (group_id, sender_id, content, created_at)
-                VALUES (?, ?, ?, ?)
-            `, req.GroupID, userID, req.Content, now)
-
-			if err != nil {
-				log.Printf("Error saving group message: %v", err)
-				client.WriteJSON(WSMessage{Type: "error", Data: "Failed to save message"})
-				continue
-			}
+	// Get sender username
+	var username string
+	err = database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	if err != nil {
+		log.Printf("Error getting username: %v", err)
+		username = "Unknown"
+	}
 
-			messageID, _ := result.LastInsertId()
+	// Prepare message payload
+	response := models.WSGroupMessage{
+		ID:        messageID,
+		GroupID:   msg.GroupID,
+		SenderID:  userID,
+		Username:  username,
+		Content:   msg.Content,
+		CreatedAt: now,
+	}
 
-			// Get sender username
-			var username string
-			err = database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-			if err != nil {
-				log.Printf("Error getting username: %v", err)
-				username = "Unknown"
-			}
+	// Broadcast the message to all group members except sender
+	BroadcastToGroup(msg.GroupID, "group_message", response, &userID)
 
-			// Prepare message payload
-			response := map[string]interface{}{
-				"id":         messageID,
-				"group_id":   req.GroupID,
-				"sender_id":  userID,
-				"username":   username,
-				"content":    req.Content,
-				"created_at": now,
+	// Broadcast a group message notification to all other online group members
+	go func() {
+		// Get all group members except sender
+		rows, err := database.DB.Query(`
+			   SELECT user_id FROM group_members 
+			   WHERE group_id = ? AND status = 'accepted' AND user_id != ?
+		   `, msg.GroupID, userID)
+		if err != nil {
+			log.Printf("Error getting group members for notification: %v", err)
+			return
+		}
+		// Read all members before notifying: logging an event writes to the
+		// database, which SQLite refuses while this query is still open
+		var memberIDs []int64
+		for rows.Next() {
+			var memberID int64
+			if err := rows.Scan(&memberID); err == nil {
+				memberIDs = append(memberIDs, memberID)
 			}
-
-			// Broadcast the message to all group members except sender
-			BroadcastToGroup(req.GroupID, "group_message", response, &userID)
-
-			// Broadcast a group message notification to all other online group members
-			go func() {
-				// Get all group members except sender
-				rows, err := database.DB.Query(`
-					   SELECT user_id FROM group_members 
-					   WHERE group_id = ? AND status = 'accepted' AND user_id != ?
-				   `, req.GroupID, userID)
-				if err != nil {
-					log.Printf("Error getting group members for notification: %v", err)
-					return
-				}
-				defer rows.Close()
-				for rows.Next() {
-					var memberID int64
-					if err := rows.Scan(&memberID); err != nil {
-						continue
-					}
-					// Only notify if online
-					if IsUserOnline(memberID) {
-						BroadcastToUser(memberID, "group_message_notification", map[string]interface{}{
-							"group_id":         req.GroupID,
-							"group_message_id": messageID,
-							"sender_id":        userID,
-							"sender_username":  username,
-							"content":          req.Content,
-							"created_at":       now,
-						})
-					}
-				}
-			}()
-
-			// Send confirmation to sender
-			client.WriteJSON(WSMessage{Type: "group_message_sent", Data: response})
-
-		default:
-			log.Printf("Unknown message type from user %d: %s", userID, msg.Type)
 		}
+		rows.Close()
+		for _, memberID := range memberIDs {
+			// Only notify if online and the group chat isn't muted
+			if IsUserOnline(memberID) && shouldPush(memberID, muteGroupChat, msg.GroupID) {
+				BroadcastToUser(memberID, "group_message_notification", models.WSGroupMessageNotification{
+					GroupID:        msg.GroupID,
+					GroupMessageID: messageID,
+					SenderID:       userID,
+					SenderUsername: username,
+					Content:        msg.Content,
+					CreatedAt:      now,
+				})
+			}
+		}
+	}()
+
+	// Send confirmation to all of the sender's devices
+	req.broadcast("group_message_sent", response)
+}
+
+// Mark conversation as open for this user (for instant delivery/read). Nothing
+// is stored yet; the request is just acknowledged.
+func handleWSOpenConversation(req wsRequest, data json.RawMessage) {
+	var msg models.WSOpenConversationRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	req.reply("open_conversation_ack", "ok")
+}
+
+func handleWSRequestOnlineStatus(req wsRequest, data json.RawMessage) {
+	var msg models.WSEmptyRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	sendOnlineStatusToUser(req)
+}
+
+// The read deadline was already extended when the message arrived; a heartbeat
+// only needs acknowledging.
+func handleWSHeartbeat(req wsRequest, data json.RawMessage) {
+	var msg models.WSEmptyRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	req.reply("heartbeat_ack", "ok")
+}
+
+func handleWSPing(req wsRequest, data json.RawMessage) {
+	var msg models.WSEmptyRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	req.reply("pong", "pong")
+}
+
+// Replay the events this device missed while disconnected
+func handleWSResume(req wsRequest, data json.RawMessage) {
+	var msg models.WSResumeRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	if msg.LastSeq < 0 {
+		req.fail(models.WSErrBadRequest, "last_seq cannot be negative")
+		return
 	}
+	replayUserEvents(req.userID, req.client.realtimeConn, msg.LastSeq, req.id)
 }
 
-// Broadcast message to a specific user
+func handleWSAck(req wsRequest, data json.RawMessage) {
+	var msg models.WSAckRequest
+	if !req.decode(data, &msg) {
+		return
+	}
+	if err := ackUserEvents(req.userID, msg.Seq); err != nil {
+		log.Printf("Error acking events for user %d: %v", req.userID, err)
+		req.fail(models.WSErrInternal, "Failed to record ack")
+	}
+}
+
+// Broadcast message to every connection of a specific user. Apart from
+// low-priority events, the message is logged first so that devices that are
+// offline (or drop before it is written) get it when they resume.
 func BroadcastToUser(receiverID int64, msgType string, data interface{}) {
-	connectionsMutex.RLock()
-	client, exists := activeConnections[receiverID]
-	connectionsMutex.RUnlock()
-
-	if exists {
-		msg := WSMessage{
-			Type: msgType,
-			Data: data,
-		}
-		err := client.WriteJSON(msg)
+	broadcastToUser(receiverID, WSMessage{Type: msgType, Data: data}, nil)
+}
+
+// broadcastToUser implements BroadcastToUser. If the message answers a request of
+// the receiver's, the connection that made it also gets the request ID.
+// Connections may be on any instance; the hub delivers to them.
+func broadcastToUser(receiverID int64, msg WSMessage, origin *wsRequest) {
+	if !wsLowPriorityEvents[msg.Type] {
+		lock := userEventLock(receiverID)
+		lock.Lock()
+		defer lock.Unlock()
+		seq, err := appendUserEvent(receiverID, msg.Type, msg.Data)
 		if err != nil {
+			log.Printf("Error logging %s event for user %d: %v", msg.Type, receiverID, err)
+		}
+		msg.Seq = seq
+	}
+	var except *realtimeConn
+	if origin != nil {
+		reply := msg
+		reply.ID = origin.id
+		if err := origin.client.WriteJSON(reply); err != nil {
 			log.Printf("Error broadcasting to user %d: %v", receiverID, err)
-			// Remove dead connection
-			connectionsMutex.Lock()
-			delete(activeConnections, receiverID)
-			connectionsMutex.Unlock()
 		}
+		except = origin.client.realtimeConn
 	}
+	hub.PublishToUser(receiverID, msg, except)
 }
 
-// Broadcast message to all members of a group
+// Broadcast message to all members of a group. Each member gets the message
+// logged in their event log, like BroadcastToUser, and the hub delivers it to
+// all of them at once.
 func BroadcastToGroup(groupID int64, msgType string, data interface{}, excludeUserID *int64) {
 	// Get all group members
 	rows, err := database.DB.Query(`
         SELECT user_id FROM group_members 
         WHERE group_id = ? AND status = 'accepted'
+        ORDER BY user_id
     `, groupID)
 	if err != nil {
 		log.Printf("Error getting group members: %v", err)
 		return
 	}
-	defer rows.Close()
-
+	var memberIDs []int64
 	for rows.Next() {
 		var memberID int64
 		if err := rows.Scan(&memberID); err != nil {
@@ -418,24 +401,40 @@ func BroadcastToGroup(groupID int64, msgType string, data interface{}, excludeUs
 		if excludeUserID != nil && memberID == *excludeUserID {
 			continue
 		}
+		memberIDs = append(memberIDs, memberID)
+	}
+	rows.Close()
 
-		BroadcastToUser(memberID, msgType, data)
+	seqs := make(map[int64]int64, len(memberIDs))
+	for _, memberID := range memberIDs {
+		seqs[memberID] = 0
+	}
+	if !wsLowPriorityEvents[msgType] && len(memberIDs) > 0 {
+		// Members are locked in ID order, so two group broadcasts can't deadlock
+		for _, memberID := range memberIDs {
+			lock := userEventLock(memberID)
+			lock.Lock()
+			defer lock.Unlock()
+		}
+		logged, err := appendUserEvents(memberIDs, msgType, data)
+		if err != nil {
+			log.Printf("Error logging %s event for group %d: %v", msgType, groupID, err)
+		}
+		for memberID, seq := range logged {
+			seqs[memberID] = seq
+		}
 	}
+	hub.PublishToGroup(groupID, seqs, WSMessage{Type: msgType, Data: data})
 }
 
 // Get online users count (optional utility)
 func GetOnlineUsersCount() int {
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-	return len(activeConnections)
+	return len(hub.OnlineUsers())
 }
 
 // Check if user is online
 func IsUserOnline(userID int64) bool {
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-	_, exists := activeConnections[userID]
-	return exists
+	return hub.IsOnline(userID)
 }
 
 // Get list of online group members
@@ -450,10 +449,12 @@ func GetOnlineGroupMembers(groupID int64) []int64 {
 	}
 	defer rows.Close()
 
-	var onlineMembers []int64
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
+	online := make(map[int64]bool)
+	for _, userID := range hub.OnlineUsers() {
+		online[userID] = true
+	}
 
+	var onlineMembers []int64
 	for rows.Next() {
 		var memberID int64
 		if err := rows.Scan(&memberID); err != nil {
@@ -461,7 +462,7 @@ func GetOnlineGroupMembers(groupID int64) []int64 {
 		}
 
 		// Check if member is online
-		if _, exists := activeConnections[memberID]; exists {
+		if online[memberID] {
 			onlineMembers = append(onlineMembers, memberID)
 		}
 	}
@@ -470,7 +471,7 @@ func GetOnlineGroupMembers(groupID int64) []int64 {
 }
 
 // checkAndSendOfflineMessageNotifications checks for unread message notifications and sends them to the user
-func checkAndSendOfflineMessageNotifications(userID int64, client *WSClient) {
+func checkAndSendOfflineMessageNotifications(userID int64, client *realtimeConn) {
 	// Query for unread message notifications
 	query := `
         SELECT COUNT(*) as count, GROUP_CONCAT(n.actor_id) as sender_ids
@@ -490,10 +491,10 @@ func checkAndSendOfflineMessageNotifications(userID int64, client *WSClient) {
 		// Send offline message notification
 		notification := WSMessage{
 			Type: "offline_messages_notification",
-			Data: map[string]interface{}{
-				"count":     count,
-				"message":   fmt.Sprintf("You have %d new message(s) while you were offline", count),
-				"timestamp": time.Now(),
+			Data: models.WSOfflineMessagesNotification{
+				Count:     count,
+				Message:   fmt.Sprintf("You have %d new message(s) while you were offline", count),
+				Timestamp: time.Now(),
 			},
 		}
 
@@ -514,17 +515,19 @@ func checkAndSendOfflineMessageNotifications(userID int64, client *WSClient) {
 	}
 }
 
-// BroadcastUserStatusChange broadcasts online/offline status to connected followers and following
+// BroadcastUserStatusChange broadcasts online/offline status to connected followers and following.
+// Users blocked in either direction are never told.
 func BroadcastUserStatusChange(userID int64, isOnline bool) {
 	// Get all users who follow this user or are followed by this user
 	var connectedUserIDs []int64
 
 	// Get followers (who should know when this user comes online)
+	notBlocked, blockArgs := notBlockedClause("f.follower_id", userID)
 	followerRows, err := database.DB.Query(`
 		SELECT f.follower_id 
 		FROM followers f 
-		WHERE f.followed_id = ? AND f.status = 'accept'
-	`, userID)
+		WHERE f.followed_id = ? AND f.status = 'accept' AND `+notBlocked,
+		append([]interface{}{userID}, blockArgs...)...)
 	if err != nil {
 		log.Printf("Error fetching followers for status broadcast: %v", err)
 		return
@@ -539,11 +542,12 @@ func BroadcastUserStatusChange(userID int64, isOnline bool) {
 	}
 
 	// Get following (who should know when this user comes online)
+	notBlocked, blockArgs = notBlockedClause("f.followed_id", userID)
 	followingRows, err := database.DB.Query(`
 		SELECT f.followed_id 
 		FROM followers f 
-		WHERE f.follower_id = ? AND f.status = 'accept'
-	`, userID)
+		WHERE f.follower_id = ? AND f.status = 'accept' AND `+notBlocked,
+		append([]interface{}{userID}, blockArgs...)...)
 	if err != nil {
 		log.Printf("Error fetching following for status broadcast: %v", err)
 		return
@@ -563,17 +567,25 @@ func BroadcastUserStatusChange(userID int64, isOnline bool) {
 		statusMessage = "user_offline"
 	}
 
+	// Mutual follows show up in both lists; tell them once
+	notified := make(map[int64]bool)
 	for _, targetUserID := range connectedUserIDs {
-		BroadcastToUser(targetUserID, statusMessage, map[string]interface{}{
-			"user_id": userID,
+		if notified[targetUserID] {
+			continue
+		}
+		notified[targetUserID] = true
+		BroadcastToUser(targetUserID, statusMessage, models.WSUserStatus{
+			UserID: userID,
 		})
 	}
 
-	log.Printf("Broadcasted %s status for user %d to %d connected users", statusMessage, userID, len(connectedUserIDs))
+	log.Printf("Broadcasted %s status for user %d to %d connected users", statusMessage, userID, len(notified))
 }
 
-// sendOnlineStatusToUser sends current online status of all chattable users to a specific user
-func sendOnlineStatusToUser(userID int64, client *WSClient) {
+// sendOnlineStatusToUser sends current online status of all chattable users to the
+// user who asked, as replies to their request
+func sendOnlineStatusToUser(req wsRequest) {
+	userID := req.userID
 	// Get all users this user can chat with (mutual follows, followers, following)
 	var chattableUserIDs []int64
 
@@ -616,27 +628,22 @@ func sendOnlineStatusToUser(userID int64, client *WSClient) {
 	}
 
 	// Check which of these users are currently online
-	connectionsMutex.RLock()
+	online := make(map[int64]bool)
+	for _, onlineUserID := range hub.OnlineUsers() {
+		online[onlineUserID] = true
+	}
 	var onlineUserIDs []int64
 	for _, chattableUserID := range chattableUserIDs {
-		if _, isOnline := activeConnections[chattableUserID]; isOnline {
+		if online[chattableUserID] {
 			onlineUserIDs = append(onlineUserIDs, chattableUserID)
 		}
 	}
-	connectionsMutex.RUnlock()
 
 	// Send online status for each online user
 	for _, onlineUserID := range onlineUserIDs {
-		statusMsg := WSMessage{
-			Type: "user_online",
-			Data: map[string]interface{}{
-				"user_id": onlineUserID,
-			},
-		}
-		if err := client.WriteJSON(statusMsg); err != nil {
-			log.Printf("Error sending online status to user %d: %v", userID, err)
-			break
-		}
+		req.reply("user_online", models.WSUserStatus{
+			UserID: onlineUserID,
+		})
 	}
 }
 
@@ -644,54 +651,48 @@ func sendOnlineStatusToUser(userID int64, client *WSClient) {
 func BroadcastLikeUpdate(postID int64, likeCount, dislikeCount int) {
 	msg := WSMessage{
 		Type: "post_like_updated",
-		Data: map[string]interface{}{
-			"post_id":       postID,
-			"like_count":    likeCount,
-			"dislike_count": dislikeCount,
+		Data: models.WSPostLikeUpdated{
+			PostID:       postID,
+			LikeCount:    likeCount,
+			DislikeCount: dislikeCount,
 		},
 	}
 
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-	for userID, client := range activeConnections {
-		if err := client.WriteJSON(msg); err != nil {
-			log.Printf("Error broadcasting like update to user %d: %v", userID, err)
-		}
+	for _, userID := range hub.OnlineUsers() {
+		hub.PublishToUser(userID, msg, nil)
 	}
 }
 
-// Deliver unread direct messages to user when they reconnect
-func deliverUnreadDirectMessages(userID int64, client *WSClient) {
-	query := `SELECT pm.id, pm.sender_id, u.username, pm.content, pm.created_at FROM private_messages pm JOIN users u ON pm.sender_id = u.id WHERE pm.receiver_id = ? AND pm.is_read = 0 ORDER BY pm.created_at ASC`
-	rows, err := database.DB.Query(query, userID)
+// BroadcastPollUpdate pushes a poll's current results to the online users who are
+// allowed to see them: its creator and everyone who has voted.
+func BroadcastPollUpdate(pollID int64, msgType string) {
+	rows, err := database.DB.Query(`
+        SELECT creator_id FROM polls WHERE id = ?
+        UNION
+        SELECT user_id FROM poll_votes WHERE poll_id = ?
+    `, pollID, pollID)
 	if err != nil {
-		log.Printf("Error fetching unread direct messages for user %d: %v", userID, err)
+		log.Printf("Error loading poll %d recipients: %v", pollID, err)
 		return
 	}
-	defer rows.Close()
-
+	var recipients []int64
 	for rows.Next() {
-		var messageID, senderID int64
-		var username, content string
-		var createdAt time.Time
-		if err := rows.Scan(&messageID, &senderID, &username, &content, &createdAt); err != nil {
-			continue
+		var userID int64
+		if err := rows.Scan(&userID); err == nil {
+			recipients = append(recipients, userID)
 		}
-		msg := WSMessage{
-			Type: "direct_message",
-			Data: map[string]interface{}{
-				"id":         messageID,
-				"sender_id":  senderID,
-				"username":   username,
-				"content":    content,
-				"created_at": createdAt,
-			},
+	}
+	rows.Close()
+
+	for _, userID := range recipients {
+		if !hub.IsOnline(userID) {
+			continue
 		}
-		// Send each unread message
-		if err := client.WriteJSON(msg); err != nil {
-			log.Printf("Error delivering offline direct message to user %d: %v", userID, err)
+		poll, err := loadPoll(pollID, userID)
+		if err != nil {
+			log.Printf("Error loading poll %d for user %d: %v", pollID, userID, err)
+			continue
 		}
-		// To mark as read when viewed, use:
-		// database.DB.Exec(`UPDATE private_messages SET is_read = 1 WHERE id = ?`, messageID)
+		BroadcastToUser(userID, msgType, poll)
 	}
 }
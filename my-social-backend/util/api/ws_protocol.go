@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"reda-social-network/models"
+)
+
+// WSMessage is the envelope of every WebSocket message; see models.WSEnvelope.
+// The protocol itself (message types and their data) is listed in models.WSEvents
+// and documented in docs/ws-protocol.md.
+type WSMessage = models.WSEnvelope
+
+// maxWSRequestIDLength caps the client-chosen request ID echoed on replies.
+const maxWSRequestIDLength = 64
+
+// wsRequest is a client request being handled on its connection's read loop.
+type wsRequest struct {
+	userID int64
+	client *WSClient
+	id     string // echoed on the replies and errors the request causes
+}
+
+// wsRequestHandlers handle the client message types. Each decodes its data into
+// the request struct listed for the type in models.WSEvents; the two must list
+// the same types (see TestWSRequestHandlersMatchProtocol).
+var wsRequestHandlers = map[string]func(req wsRequest, data json.RawMessage){
+	"direct_message":        handleWSDirectMessage,
+	"typing_indicator":      handleWSTypingIndicator,
+	"message_read":          handleWSMessageRead,
+	"group_message":         handleWSGroupMessage,
+	"open_conversation":     handleWSOpenConversation,
+	"request_online_status": handleWSRequestOnlineStatus,
+	"heartbeat":             handleWSHeartbeat,
+	"ping":                  handleWSPing,
+	"resume":                handleWSResume,
+	"ack":                   handleWSAck,
+}
+
+// dispatchWSRequest decodes one message from userID's client and hands it to the
+// handler for its type. Anything malformed is answered with an error event.
+func dispatchWSRequest(userID int64, client *WSClient, raw []byte) {
+	var env models.WSRequestEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		wsRequest{userID: userID, client: client}.fail(models.WSErrBadRequest, "Invalid message: "+err.Error())
+		return
+	}
+	req := wsRequest{userID: userID, client: client, id: env.ID}
+	if len(env.ID) > maxWSRequestIDLength {
+		req.id = ""
+		req.fail(models.WSErrBadRequest, fmt.Sprintf("id must be at most %d characters", maxWSRequestIDLength))
+		return
+	}
+	if env.Type == "" {
+		req.fail(models.WSErrBadRequest, "type is required")
+		return
+	}
+	if env.Version < 0 || env.Version > models.WSProtocolVersion {
+		req.fail(models.WSErrUnsupportedVersion, fmt.Sprintf("Unsupported protocol version %d; the server speaks version %d", env.Version, models.WSProtocolVersion))
+		return
+	}
+	handler, ok := wsRequestHandlers[env.Type]
+	if !ok {
+		req.fail(models.WSErrUnknownType, fmt.Sprintf("Unknown message type %q", env.Type))
+		return
+	}
+	if action, limited := wsRateLimitedRequests[env.Type]; limited {
+		if wait := sendLimiter.allow(userID, action); wait > 0 {
+			req.reply("error", models.WSErrorData{
+				Code:         models.WSErrRateLimited,
+				Message:      fmt.Sprintf("Too many %s requests, slow down", env.Type),
+				RetryAfterMs: wait.Milliseconds() + 1,
+			})
+			client.strike()
+			return
+		}
+	}
+	handler(req, env.Data)
+}
+
+// decode unmarshals a request's data into v, rejecting unknown fields. On failure
+// it sends a bad_request error and returns false.
+func (req wsRequest) decode(data json.RawMessage, v interface{}) bool {
+	if len(data) == 0 || string(data) == "null" {
+		data = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		req.fail(models.WSErrBadRequest, "Invalid data: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// reply sends a message to the connection that made the request.
+func (req wsRequest) reply(msgType string, data interface{}) {
+	req.client.WriteJSON(WSMessage{Type: msgType, ID: req.id, Data: data})
+}
+
+// fail sends an error event for the request.
+func (req wsRequest) fail(code, message string) {
+	req.reply("error", models.WSErrorData{Code: code, Message: message})
+}
+
+// broadcast sends a message to all of the requesting user's connections, like
+// BroadcastToUser; the connection that made the request also gets its ID.
+func (req wsRequest) broadcast(msgType string, data interface{}) {
+	broadcastToUser(req.userID, WSMessage{Type: msgType, Data: data}, &req)
+}
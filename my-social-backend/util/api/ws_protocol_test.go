@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"reda-social-network/database"
+	"reda-social-network/models"
+)
+
+// The handlers and the documented protocol must agree, or clients would be told
+// about requests the server rejects (or the reverse).
+func TestWSRequestHandlersMatchProtocol(t *testing.T) {
+	documented := make(map[string]bool)
+	for _, spec := range models.WSEvents {
+		if spec.Direction != models.WSFromClient {
+			continue
+		}
+		documented[spec.Type] = true
+		if wsRequestHandlers[spec.Type] == nil {
+			t.Errorf("websocket request %q is documented but has no handler", spec.Type)
+		}
+	}
+	for msgType := range wsRequestHandlers {
+		if !documented[msgType] {
+			t.Errorf("websocket request %q has a handler but is not in models.WSEvents", msgType)
+		}
+	}
+}
+
+// wsTestPeers is a requesting user with a client, and another user, online, they
+// follow both ways and share a group with.
+type wsTestPeers struct {
+	user, other int64
+	client      *WSClient
+	otherConn   *realtimeConn
+	groupID     int64
+	messageID   int64 // from other to user
+}
+
+func newWSTestPeers(t *testing.T) wsTestPeers {
+	t.Helper()
+	newTestDB(t)
+	p := wsTestPeers{user: createTestUser(t, "requester"), other: createTestUser(t, "other")}
+	follow(t, p.user, p.other)
+	follow(t, p.other, p.user)
+
+	res, err := database.DB.Exec("INSERT INTO groups (title, creator_id) VALUES ('g', ?)", p.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.groupID, _ = res.LastInsertId()
+	for _, id := range []int64{p.user, p.other} {
+		database.DB.Exec("INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, 'accepted')", p.groupID, id)
+	}
+
+	msg, err := NewMessagingService(database.DB).SendDirectMessage(p.other, p.user, "hi", nil)
+	if err != nil {
+		t.Fatalf("sending the message to read: %v", err)
+	}
+	p.messageID = msg.ID
+
+	p.client = &WSClient{realtimeConn: connectTestClient(t, p.user)}
+	p.otherConn = connectTestClient(t, p.other)
+	return p
+}
+
+// sendWS dispatches a request from the peers' client as its read loop would.
+func (p wsTestPeers) sendWS(t *testing.T, env map[string]interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatchWSRequest(p.user, p.client, raw)
+}
+
+// expectWSError checks that the next message on conn is an error with code,
+// answering request id.
+func expectWSError(t *testing.T, conn *realtimeConn, code, id string) {
+	t.Helper()
+	msg := receive(t, conn)
+	if msg.Type != "error" {
+		t.Fatalf("got %s %s, want an error", msg.Type, msg.Data)
+	}
+	var data models.WSErrorData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		t.Fatalf("decoding error data %s: %v", msg.Data, err)
+	}
+	if data.Code != code {
+		t.Errorf("got error %q (%s), want %q", data.Code, data.Message, code)
+	}
+	if msg.ID != id {
+		t.Errorf("error has id %q, want %q", msg.ID, id)
+	}
+}
+
+func TestDispatchWSRequest(t *testing.T) {
+	p := newWSTestPeers(t)
+
+	tests := []struct {
+		msgType string
+		data    func(p wsTestPeers) map[string]interface{}
+		reply   string // sent to the requester with its ID; "" if none is
+		// other is what the other user gets, if anything
+		other string
+	}{
+		{"direct_message", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"receiver_id": p.other, "content": "hello"}
+		}, "direct_message_sent", "new_message"},
+		{"typing_indicator", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"receiver_id": p.other, "is_typing": true}
+		}, "", "typing_indicator"},
+		{"message_read", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"message_id": p.messageID}
+		}, "conversation_read", ""},
+		{"group_message", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"group_id": p.groupID, "content": "hello group"}
+		}, "group_message_sent", "group_message_notification"},
+		{"open_conversation", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"user_id": p.other}
+		}, "open_conversation_ack", ""},
+		{"request_online_status", nil, "user_online", ""},
+		{"heartbeat", nil, "heartbeat_ack", ""},
+		{"ping", nil, "pong", ""},
+		{"resume", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"last_seq": 0}
+		}, "resumed", ""},
+		{"ack", func(p wsTestPeers) map[string]interface{} {
+			return map[string]interface{}{"seq": 0}
+		}, "", ""},
+	}
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		covered[tt.msgType] = true
+		data := func() map[string]interface{} {
+			if tt.data == nil {
+				return map[string]interface{}{}
+			}
+			return tt.data(p)
+		}
+		t.Run(tt.msgType, func(t *testing.T) {
+			t.Run("valid", func(t *testing.T) {
+				drain(t, p.client.realtimeConn)
+				drain(t, p.otherConn)
+				p.sendWS(t, map[string]interface{}{"type": tt.msgType, "id": "req-valid", "version": models.WSProtocolVersion, "data": data()})
+				if tt.reply != "" {
+					if msg := receiveType(t, p.client.realtimeConn, tt.reply); msg.ID != "req-valid" {
+						t.Errorf("%s has id %q, want the request's", tt.reply, msg.ID)
+					}
+				}
+				if tt.other != "" {
+					receiveType(t, p.otherConn, tt.other)
+				}
+				for _, msg := range drain(t, p.client.realtimeConn) {
+					if msg.Type == "error" {
+						t.Errorf("got an error: %s", msg.Data)
+					}
+				}
+			})
+			t.Run("unknown field", func(t *testing.T) {
+				drain(t, p.client.realtimeConn)
+				bad := data()
+				bad["bogus"] = 1
+				p.sendWS(t, map[string]interface{}{"type": tt.msgType, "id": "req-field", "data": bad})
+				expectWSError(t, p.client.realtimeConn, models.WSErrBadRequest, "req-field")
+			})
+			t.Run("wrong version", func(t *testing.T) {
+				drain(t, p.client.realtimeConn)
+				p.sendWS(t, map[string]interface{}{"type": tt.msgType, "id": "req-version", "version": models.WSProtocolVersion + 1, "data": data()})
+				expectWSError(t, p.client.realtimeConn, models.WSErrUnsupportedVersion, "req-version")
+			})
+			t.Run("oversized id", func(t *testing.T) {
+				drain(t, p.client.realtimeConn)
+				id := strings.Repeat("x", maxWSRequestIDLength+1)
+				p.sendWS(t, map[string]interface{}{"type": tt.msgType, "id": id, "data": data()})
+				// Too long to echo, so the error has none
+				expectWSError(t, p.client.realtimeConn, models.WSErrBadRequest, "")
+			})
+			t.Run("unknown type", func(t *testing.T) {
+				drain(t, p.client.realtimeConn)
+				p.sendWS(t, map[string]interface{}{"type": tt.msgType + "_v2", "id": "req-type", "data": data()})
+				expectWSError(t, p.client.realtimeConn, models.WSErrUnknownType, "req-type")
+			})
+		})
+	}
+	for msgType := range wsRequestHandlers {
+		if !covered[msgType] {
+			t.Errorf("no test for websocket request %q", msgType)
+		}
+	}
+}
+
+func TestDispatchWSRequestBadEnvelope(t *testing.T) {
+	p := newWSTestPeers(t)
+
+	tests := []struct {
+		name string
+		raw  string
+		code string
+		id   string
+	}{
+		{"missing type", `{"id":"req-2","data":{}}`, models.WSErrBadRequest, "req-2"},
+		{"negative version", `{"type":"ping","id":"req-3","version":-1}`, models.WSErrUnsupportedVersion, "req-3"},
+		{"not JSON", `{"type":`, models.WSErrBadRequest, ""},
+		{"data not an object", `{"type":"ping","id":"req-4","data":[1]}`, models.WSErrBadRequest, "req-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drain(t, p.client.realtimeConn)
+			dispatchWSRequest(p.user, p.client, []byte(tt.raw))
+			expectWSError(t, p.client.realtimeConn, tt.code, tt.id)
+			if msgs := drain(t, p.client.realtimeConn); len(msgs) != 0 {
+				t.Errorf("got %d more message(s) after the error", len(msgs))
+			}
+		})
+	}
+}
@@ -66,9 +66,11 @@ export default function GroupChat({ groupId, currentUserId, isConnected, onMessa
 
     // Handle errors
     onMessage('error', (data: string | GroupMessage) => {
-      if (typeof data === 'string') {
+      // Errors carry { code, message }; older servers sent a bare string
+      const message = typeof data === 'string' ? data : (data as unknown as { message?: string })?.message;
+      if (message) {
         console.error('Group chat error:', data);
-        alert(data);
+        alert(message);
       }
     });
   }, [onMessage, groupId]);
@@ -58,12 +58,12 @@ export default function MessageNotificationBadge({ children }: Props) {
       console.log('[MessageBadge] Received offline_messages_notification:', data);
       fetchUnreadCount();
     });
-    onMessage('direct_message', (data) => {
-      console.log('[MessageBadge] Received direct_message:', data);
+    onMessage('new_message', (data) => {
+      console.log('[MessageBadge] Received new_message:', data);
       fetchUnreadCount();
     });
-    onMessage('message_read', (data) => {
-      console.log('[MessageBadge] Received message_read:', data);
+    onMessage('conversation_read', (data) => {
+      console.log('[MessageBadge] Received conversation_read:', data);
       fetchUnreadCount();
     });
     onMessage('conversation_updated', (data: any) => {
@@ -86,16 +86,6 @@ export default function PrivateMessaging({ currentUserId }: PrivateMessagingProp
     });
   }, [onMessage]);
 
-  // Send 'message_read' for unread messages when chat is open or new messages arrive
-  useEffect(() => {
-  if (!selectedUser || !messages.length || !safeSendMessage) return;
-  const unread = messages.filter(m => !m.is_sent_by_viewer && !m.is_read);
-  if (unread.length > 0) {
-    unread.forEach(msg => {
-      safeSendMessage('message_read', { message_id: msg.id });
-    });
-  }
-}, [selectedUser, messages, safeSendMessage]);
   // Helper for message status icon
   function getMessageStatusIcon(message: MessageResponse) {
     // Only show green check if is_read is true
@@ -214,23 +204,27 @@ export default function PrivateMessaging({ currentUserId }: PrivateMessagingProp
         });
       }
     });
-    // Listen for message_read events from backend and update UI
-    onMessage('message_read', (data: { message_id: number }) => {
-      setMessages(prev => prev.map(m =>
-        m.id === data.message_id ? { ...m, is_read: true } : m
-      ));
-      setMessagesByUser(byUser => {
-        if (!selectedUser) return byUser;
-        const msgs = byUser[selectedUser.id] || [];
-        return {
-          ...byUser,
-          [selectedUser.id]: msgs.map(m =>
-            m.id === data.message_id ? { ...m, is_read: true } : m
-          )
-        };
-      });
+    // Listen for conversation_read events from backend and update UI: either the
+    // other user read our messages, or we read theirs on another device
+    onMessage('conversation_read', (data: { reader_id: number; other_user_id: number; last_read_message_id: number }) => {
+      if (!selectedUser) return;
+      let ourMessages: boolean;
+      if (data.reader_id === selectedUser.id && data.other_user_id === currentUserId) {
+        ourMessages = true;
+      } else if (data.reader_id === currentUserId && data.other_user_id === selectedUser.id) {
+        ourMessages = false;
+      } else {
+        return;
+      }
+      const markRead = (m: MessageResponse) =>
+        m.is_sent_by_viewer === ourMessages && m.id <= data.last_read_message_id ? { ...m, is_read: true } : m;
+      setMessages(prev => prev.map(markRead));
+      setMessagesByUser(byUser => ({
+        ...byUser,
+        [selectedUser.id]: (byUser[selectedUser.id] || []).map(markRead)
+      }));
     });
-  }, [onMessage, selectedUser]);
+  }, [onMessage, selectedUser, currentUserId]);
 
   // Listen for typing events from WebSocket
   useEffect(() => {
@@ -249,14 +243,14 @@ export default function PrivateMessaging({ currentUserId }: PrivateMessagingProp
     };
   }, [onMessage, selectedUser]);
 
-  // Send 'message_read' for unread messages when chat is open or new messages arrive
+  // Send one 'message_read' for the newest unread message when chat is open or
+  // new messages arrive; the server marks everything before it read too
   useEffect(() => {
     if (!selectedUser || !messages.length || !safeSendMessage) return;
     const unread = messages.filter(m => !m.is_sent_by_viewer && !m.is_read);
     if (unread.length > 0) {
-      unread.forEach(msg => {
-        safeSendMessage('message_read', { message_id: msg.id });
-      });
+      const newest = unread.reduce((a, b) => (b.id > a.id ? b : a));
+      safeSendMessage('message_read', { message_id: newest.id });
     }
   }, [selectedUser, messages, safeSendMessage]);
   // Auto-scroll to newest message when messages change